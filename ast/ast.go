@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"math"
 )
 
 //go:generate xdrgen -Gxb,go ast.x
@@ -16,9 +17,11 @@ const (
 	ErrDefinitionNotFound      = xerror("Definition not found")
 	ErrDefinitionNotType       = xerror("Definition not a type")
 	ErrDefinitionNotConstant   = xerror("Definition not a constant")
+	ErrDefinitionNotProgram    = xerror("Definition not a program")
 	ErrDefinitionNotConsistent = xerror("Definition not consistent with preceding definition")
 	ErrRedefinitionOfType      = xerror("Attempt to redefine type")
 	ErrRedefinitionOfConstant  = xerror("Attempt to redefine constant")
+	ErrRedefinitionOfProgram   = xerror("Attempt to redefine program")
 	ErrTypeNotRef              = xerror("Type is not of TYPE_REF")
 )
 
@@ -97,6 +100,8 @@ func (s *Specification) PutDefinition(d *Definition) (uint32, error) {
 			return 0, ErrRedefinitionOfType
 		} else if xd.Body.Kind == DEFINITION_KIND_CONSTANT {
 			return 0, ErrRedefinitionOfConstant
+		} else if xd.Body.Kind == DEFINITION_KIND_PROGRAM {
+			return 0, ErrRedefinitionOfProgram
 		}
 		s.Definitions[xdIdx] = d
 		return xdIdx, nil
@@ -156,6 +161,20 @@ func (s *Specification) GetConstant(n string) (*Constant, error) {
 	return d.Body.Constant, nil
 }
 
+// GetProgram looks up the named program, returning an error if it is not found
+func (s *Specification) GetProgram(n string) (*ProgramSpec, error) {
+	d := s.NamedDefinition(n)
+	if d == nil {
+		return nil, ErrDefinitionNotFound
+	}
+
+	if d.Body.Kind != DEFINITION_KIND_PROGRAM {
+		return nil, ErrDefinitionNotProgram
+	}
+
+	return d.Body.ProgramSpec, nil
+}
+
 // HasMember returns if a named member exists
 func (ss *StructSpec) HasMember(name string) bool {
 	for _, m := range ss.Members {
@@ -184,7 +203,7 @@ func (es *EnumSpec) HasOption(s *Specification, name string) bool {
 }
 
 // HasOption returns if a named option exists
-func (es *EnumSpec) GetValue(s *Specification, name string) (uint32, bool) {
+func (es *EnumSpec) GetValue(s *Specification, name string) (int32, bool) {
 	limit := es.Base + es.Count
 	for i := es.Base; i < limit; i++ {
 		xd := s.Definitions[i]
@@ -197,11 +216,11 @@ func (es *EnumSpec) GetValue(s *Specification, name string) (uint32, bool) {
 			return xd.Body.Constant.VEnum, true
 		}
 	}
-	return ^uint32(0), false
+	return -1, false
 }
 
 // GetName returns the canonical (first) name for the specified numeric value
-func (es *EnumSpec) GetName(s *Specification, val uint32) string {
+func (es *EnumSpec) GetName(s *Specification, val int32) string {
 	limit := es.Base + es.Count
 	for i := es.Base; i < limit; i++ {
 		xd := s.Definitions[i]
@@ -219,8 +238,9 @@ func (es *EnumSpec) GetName(s *Specification, val uint32) string {
 
 // EnumOption is a specifc option within an enum
 type EnumOption struct {
-	Name  string
-	Value uint32
+	Name       string
+	Value      int32
+	Attributes Attributes
 }
 
 // Returns a list of options
@@ -233,10 +253,11 @@ func (es *EnumSpec) GetOptions(s *Specification) []EnumOption {
 		case xd.Body.Kind != DEFINITION_KIND_CONSTANT,
 			xd.Body.Constant.Type != CONST_ENUM:
 			opts[i].Name = fmt.Sprintf("<Invalid enum %d>", es.Base+i)
-			opts[i].Value = ^uint32(0)
+			opts[i].Value = -1
 		default:
 			opts[i].Name = xd.Name
 			opts[i].Value = xd.Body.Constant.VEnum
+			opts[i].Attributes = xd.Attributes
 		}
 	}
 
@@ -244,7 +265,7 @@ func (es *EnumSpec) GetOptions(s *Specification) []EnumOption {
 }
 
 // HasOption returns if the numeric value specified is defined
-func (us *UnionSpec) HasOption(val uint32) bool {
+func (us *UnionSpec) HasOption(val int32) bool {
 	_, exists := us.Options[val]
 	return exists
 }
@@ -269,12 +290,77 @@ func (us *UnionSpec) GetMember(name string) (uint32, *Declaration) {
 	return 0, nil
 }
 
+// GetVersion returns the version with the specified name, if it exists
+func (p *ProgramSpec) GetVersion(name string) *VersionSpec {
+	for _, v := range p.Versions {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// HasVersionNumber returns if a version with the specified number exists
+func (p *ProgramSpec) HasVersionNumber(num uint32) bool {
+	for _, v := range p.Versions {
+		if v.Number == num {
+			return true
+		}
+	}
+	return false
+}
+
+// GetProcedure returns the procedure with the specified name, if it exists
+func (v *VersionSpec) GetProcedure(name string) *Procedure {
+	for _, p := range v.Procedures {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// HasProcedureNumber returns if a procedure with the specified number exists
+func (v *VersionSpec) HasProcedureNumber(num uint32) bool {
+	for _, p := range v.Procedures {
+		if p.Number == num {
+			return true
+		}
+	}
+	return false
+}
+
 // AsU32 attempts to reinterpret a constant as an unsigned 32-bit number
 func (c *Constant) AsU32() (uint32, error) {
 	if c.Type == CONST_POS_INT {
+		if c.VPosInt > math.MaxUint32 {
+			return 0, fmt.Errorf("Constant %d out of range for unsigned int", c.VPosInt)
+		}
 		return uint32(c.VPosInt), nil
 	} else if c.Type == CONST_NEG_INT {
-		return uint32(c.VNegInt), nil
+		return 0, fmt.Errorf("Constant -%d out of range for unsigned int", c.VNegInt)
+	} else if c.Type == CONST_ENUM {
+		if c.VEnum < 0 {
+			return 0, fmt.Errorf("Constant %d out of range for unsigned int", c.VEnum)
+		}
+		return uint32(c.VEnum), nil
+	} else {
+		return 0, fmt.Errorf("Can't use constant %s as integer", c.Type)
+	}
+}
+
+// AsI32 attempts to reinterpret a constant as a signed 32-bit number
+func (c *Constant) AsI32() (int32, error) {
+	if c.Type == CONST_POS_INT {
+		if c.VPosInt > math.MaxInt32 {
+			return 0, fmt.Errorf("Constant %d out of range for int", c.VPosInt)
+		}
+		return int32(c.VPosInt), nil
+	} else if c.Type == CONST_NEG_INT {
+		if c.VNegInt > -math.MinInt32 {
+			return 0, fmt.Errorf("Constant -%d out of range for int", c.VNegInt)
+		}
+		return int32(-int64(c.VNegInt)), nil
 	} else if c.Type == CONST_ENUM {
 		return c.VEnum, nil
 	} else {
@@ -327,6 +413,68 @@ func (t *Type) Resolve(s *Specification) (*Type, error) {
 	}
 }
 
+// VisitTypes calls fn for t and each type nested within it, in a depth-first
+// order. References are not followed
+func (t *Type) VisitTypes(fn func(*Type)) {
+	fn(t)
+	switch t.Kind {
+	case TYPE_STRUCT:
+		for _, m := range t.StructSpec.Members {
+			m.Type.VisitTypes(fn)
+		}
+	case TYPE_UNION:
+		t.UnionSpec.Discriminant.Type.VisitTypes(fn)
+		for _, m := range t.UnionSpec.Members {
+			m.Type.VisitTypes(fn)
+		}
+	case TYPE_TYPEDEF:
+		t.TypeDef.Type.VisitTypes(fn)
+	}
+}
+
+// VisitTypes calls fn for each type used by the definition, including those
+// nested within other types and those used in procedure signatures
+func (d *Definition) VisitTypes(fn func(*Type)) {
+	switch d.Body.Kind {
+	case DEFINITION_KIND_TYPE:
+		if d.Body.Type != nil {
+			d.Body.Type.VisitTypes(fn)
+		}
+	case DEFINITION_KIND_PROGRAM:
+		for _, v := range d.Body.ProgramSpec.Versions {
+			for _, p := range v.Procedures {
+				for _, a := range p.Arguments {
+					a.VisitTypes(fn)
+				}
+				p.Result.VisitTypes(fn)
+			}
+		}
+	}
+}
+
+// IsImported returns if the definition was imported from another specification
+func (d *Definition) IsImported() bool {
+	return d.ImportedFrom != nil
+}
+
+// GetImport returns the index of the import of the specified file, if it exists
+func (s *Specification) GetImport(file string) (uint32, bool) {
+	for i, imp := range s.Imports {
+		if imp.File == file {
+			return uint32(i), true
+		}
+	}
+	return 0, false
+}
+
+// String formats the start of the location as file:line:column
+func (l *Location) String() string {
+	if l == nil {
+		return "<unknown location>"
+	}
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Column)
+}
+
 // GetStringDefault attempts to look up the named attribute as a string,
 // or returns the specified default
 func (as Attributes) GetStringDefault(name, def string) string {
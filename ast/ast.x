@@ -14,8 +14,34 @@ struct specification {
 	[doc("Spec attributes (set using pragma directives)")]
 	attributes attributes;
 
+	[doc("Specifications imported by this one, including those imported indirectly")]
+	import_spec imports<>;
+
 	[doc("List of all definitions")]
 	definition definitions<>;
+
+	[doc("Passthrough lines (those beginning with %), which rpcgen copies to its output")]
+	passthrough passthroughs<>;
+};
+
+[doc("A passthrough line. Backends which generate C may reproduce these; others ignore them")]
+struct passthrough {
+	[doc("Text of the line, following the %")]
+	string text<>;
+	[doc("Number of definitions preceding the line")]
+	unsigned int position;
+	[doc("Location of the line in the source file")]
+	location *location;
+};
+
+[doc("A specification imported using an import directive")]
+struct import_spec {
+	[doc("Path of the import, as written in the import directive")]
+	string path<>;
+	[doc("Absolute name of the file the import was resolved to")]
+	string file<>;
+	[doc("Attributes of the imported specification")]
+	attributes attributes;
 };
 
 [doc("An attribute of an object")]
@@ -27,10 +53,25 @@ struct attribute {
 [doc("A set of attributes")]
 typedef [mode("map")] attribute attributes<>;
 
+[doc("A span of text in a source file. Lines and columns are counted from 1")]
+struct location {
+	[doc("Name of the source file")]
+	string file<>;
+	[doc("Line of the first character of the span")]
+	unsigned int line;
+	[doc("Column of the first character of the span")]
+	unsigned int column;
+	[doc("Line of the character immediately following the span")]
+	unsigned int end_line;
+	[doc("Column of the character immediately following the span")]
+	unsigned int end_column;
+};
+
 [doc("The kind of a definition")]
 enum definition_kind {
 	DEFINITION_KIND_TYPE  = 0,
 	DEFINITION_KIND_CONSTANT = 1,
+	DEFINITION_KIND_PROGRAM  = 2,
 };
 
 [doc("A top-level definition")]
@@ -39,6 +80,10 @@ struct definition {
 	string name<>;
 	[doc("The attributes of the definition")]
 	attributes attributes;
+	[doc("If the definition was imported, the index of the specification it was imported from in `imports`")]
+	unsigned int *imported_from;
+	[doc("Where the definition is located in its source file, if known")]
+	location *location;
 
 	union switch(definition_kind kind) {
 	case DEFINITION_KIND_TYPE:
@@ -47,6 +92,9 @@ struct definition {
 	case DEFINITION_KIND_CONSTANT:
 		[doc("Body, for constant definitions")]
 		constant constant;
+	case DEFINITION_KIND_PROGRAM:
+		[doc("Body, for ONC RPC program definitions")]
+		program_spec program_spec;
 	} body;
 };
 
@@ -121,6 +169,8 @@ struct declaration {
 	} modifier;
 	[doc("Field attributes")]
 	attributes attributes;
+	[doc("Where the declaration is located in its source file, if known")]
+	location *location;
 };
 
 [doc("Definition of an enum")]
@@ -135,15 +185,53 @@ struct union_spec {
 	declaration discriminant;
 	[doc("Set of union member fields")]
 	declaration members<>;
-	[doc("Mapping from values to union member. `member` is the index of the member in `members`"), mode("map")]
+	[doc("Mapping from values to union member. `member` is the index of the member in `members`. Values above the range of an int (for unsigned int discriminants) are stored as the int with the same encoding"), mode("map")]
 	struct {
-		unsigned int value;
+		int value;
 		unsigned int member;
 	} options<>;
 	[doc("If a default member is present, defines it")]
 	unsigned int *default_member;
 };
 
+[doc("An ONC RPC program, as defined in section 12 of RFC 5531")]
+struct program_spec {
+	[doc("Program number")]
+	unsigned int number;
+	[doc("Versions of the program")]
+	version_spec versions<>;
+};
+
+[doc("A version of an ONC RPC program")]
+struct version_spec {
+	[doc("The name of the version")]
+	string name<>;
+	[doc("The attributes of the version")]
+	attributes attributes;
+	[doc("Version number")]
+	unsigned int number;
+	[doc("Procedures defined by this version")]
+	procedure procedures<>;
+	[doc("Where the version is located in its source file, if known")]
+	location *location;
+};
+
+[doc("A procedure within a version of an ONC RPC program")]
+struct procedure {
+	[doc("The name of the procedure")]
+	string name<>;
+	[doc("The attributes of the procedure")]
+	attributes attributes;
+	[doc("Procedure number")]
+	unsigned int number;
+	[doc("Argument types. A procedure declared as taking void has no arguments")]
+	type arguments<>;
+	[doc("Result type")]
+	type result;
+	[doc("Where the procedure is located in its source file, if known")]
+	location *location;
+};
+
 [doc("Type of a constant. These are a subset of XDR types")]
 enum constant_kind {
 	[doc("Void (empty)")]
@@ -169,5 +257,5 @@ union constant switch(constant_kind type) {
 	case CONST_NEG_INT: unsigned hyper v_neg_int;
 	case CONST_FLOAT:   double         v_float;
 	case CONST_STRING:  string         v_string<>;
-	case CONST_ENUM:    unsigned int   v_enum;
+	case CONST_ENUM:    int            v_enum;
 };
\ No newline at end of file
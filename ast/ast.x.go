@@ -21,13 +21,265 @@ type Specification struct {
 	Magic uint64 `json:"magic"`
 	// Spec attributes (set using pragma directives)
 	Attributes Attributes `json:"attributes"`
+	// Specifications imported by this one, including those imported indirectly
+	Imports []*ImportSpec `json:"imports"`
 	// List of all definitions
 	Definitions []*Definition `json:"definitions"`
+	// Passthrough lines (those beginning with %), which rpcgen copies to its output
+	Passthroughs []*Passthrough `json:"passthroughs"`
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Specification) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedHyper(v.Magic); err != nil {
+		return err
+	}
+	if err := v.Attributes.MarshalXDR(e); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.Imports))); err != nil {
+		return err
+	}
+	for i1 := range v.Imports {
+		if v.Imports[i1] == nil {
+			return errors.New("specification.imports: value is nil")
+		}
+		if err := v.Imports[i1].MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.Definitions))); err != nil {
+		return err
+	}
+	for i2 := range v.Definitions {
+		if v.Definitions[i2] == nil {
+			return errors.New("specification.definitions: value is nil")
+		}
+		if err := v.Definitions[i2].MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.Passthroughs))); err != nil {
+		return err
+	}
+	for i3 := range v.Passthroughs {
+		if v.Passthroughs[i3] == nil {
+			return errors.New("specification.passthroughs: value is nil")
+		}
+		if err := v.Passthroughs[i3].MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Specification) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	if v.Magic, err = d.DecodeUnsignedHyper(); err != nil {
+		return err
+	}
+	if err := v.Attributes.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	c2 := n1
+	if c2 > 1024 {
+		c2 = 1024
+	}
+	v.Imports = make([]*ImportSpec, 0, c2)
+	for i3 := uint32(0); i3 < n1; i3++ {
+		var v4 *ImportSpec
+		v4 = new(ImportSpec)
+		if err := v4.UnmarshalXDR(d); err != nil {
+			return err
+		}
+		v.Imports = append(v.Imports, v4)
+	}
+	n5, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	c6 := n5
+	if c6 > 1024 {
+		c6 = 1024
+	}
+	v.Definitions = make([]*Definition, 0, c6)
+	for i7 := uint32(0); i7 < n5; i7++ {
+		var v8 *Definition
+		v8 = new(Definition)
+		if err := v8.UnmarshalXDR(d); err != nil {
+			return err
+		}
+		v.Definitions = append(v.Definitions, v8)
+	}
+	n9, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	c10 := n9
+	if c10 > 1024 {
+		c10 = 1024
+	}
+	v.Passthroughs = make([]*Passthrough, 0, c10)
+	for i11 := uint32(0); i11 < n9; i11++ {
+		var v12 *Passthrough
+		v12 = new(Passthrough)
+		if err := v12.UnmarshalXDR(d); err != nil {
+			return err
+		}
+		v.Passthroughs = append(v.Passthroughs, v12)
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Specification)
+
 // A set of attributes
 type Attributes map[string]*Constant
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v Attributes) MarshalXDR(e xdr.Encoder) error {
+	x := (map[string]*Constant)(v)
+	if err := e.EncodeUnsignedInt(uint32(len(x))); err != nil {
+		return err
+	}
+	for k1, v2 := range x {
+		if err := e.EncodeUnsignedInt(uint32(len(k1))); err != nil {
+			return err
+		}
+		if err := e.EncodeFixedOpaque([]byte(k1)); err != nil {
+			return err
+		}
+		if v2 == nil {
+			return errors.New("attributes: value is nil")
+		}
+		if err := v2.MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Attributes) UnmarshalXDR(d xdr.Decoder) error {
+	x := (*map[string]*Constant)(v)
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	(*x) = make(map[string]*Constant)
+	for i2 := uint32(0); i2 < n1; i2++ {
+		var k3 string
+		var v4 *Constant
+		n5, err := d.DecodeUnsignedInt()
+		if err != nil {
+			return err
+		}
+		b6 := []byte{}
+		for uint32(len(b6)) < n5 {
+			c7 := n5 - uint32(len(b6))
+			if c7 > 65536 {
+				c7 = 65536
+			}
+			b6 = append(b6, make([]byte, c7)...)
+			if err := d.DecodeFixedOpaque(b6[uint32(len(b6))-c7:]); err != nil {
+				return err
+			}
+		}
+		k3 = string(b6)
+		v4 = new(Constant)
+		if err := v4.UnmarshalXDR(d); err != nil {
+			return err
+		}
+		(*x)[k3] = v4
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Attributes)
+
+// A specification imported using an import directive
+type ImportSpec struct {
+	// Path of the import, as written in the import directive
+	Path string `json:"path"`
+	// Absolute name of the file the import was resolved to
+	File string `json:"file"`
+	// Attributes of the imported specification
+	Attributes Attributes `json:"attributes"`
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *ImportSpec) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(uint32(len(v.Path))); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque([]byte(v.Path)); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.File))); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque([]byte(v.File)); err != nil {
+		return err
+	}
+	if err := v.Attributes.MarshalXDR(e); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *ImportSpec) UnmarshalXDR(d xdr.Decoder) error {
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	b2 := []byte{}
+	for uint32(len(b2)) < n1 {
+		c3 := n1 - uint32(len(b2))
+		if c3 > 65536 {
+			c3 = 65536
+		}
+		b2 = append(b2, make([]byte, c3)...)
+		if err := d.DecodeFixedOpaque(b2[uint32(len(b2))-c3:]); err != nil {
+			return err
+		}
+	}
+	v.Path = string(b2)
+	n4, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	b5 := []byte{}
+	for uint32(len(b5)) < n4 {
+		c6 := n4 - uint32(len(b5))
+		if c6 > 65536 {
+			c6 = 65536
+		}
+		b5 = append(b5, make([]byte, c6)...)
+		if err := d.DecodeFixedOpaque(b5[uint32(len(b5))-c6:]); err != nil {
+			return err
+		}
+	}
+	v.File = string(b5)
+	if err := v.Attributes.UnmarshalXDR(d); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(ImportSpec)
+
 // Definition_Body is union definition.body
 type Definition_Body struct {
 	Kind DefinitionKind `xdr:"union:switch" json:"kind"`
@@ -35,6 +287,8 @@ type Definition_Body struct {
 	Type *Type `xdr:"union:0" json:"type,omitempty"`
 	// Body, for constant definitions
 	Constant *Constant `xdr:"union:1" json:"constant,omitempty"`
+	// Body, for ONC RPC program definitions
+	ProgramSpec *ProgramSpec `xdr:"union:2" json:"program_spec,omitempty"`
 }
 
 func (u *Definition_Body) UnionDiscriminant() interface{} {
@@ -45,6 +299,8 @@ func (u *Definition_Body) UnionValue() (interface{}, error) {
 	switch u.Kind {
 	case DEFINITION_KIND_CONSTANT:
 		return u.Constant, nil
+	case DEFINITION_KIND_PROGRAM:
+		return u.ProgramSpec, nil
 	case DEFINITION_KIND_TYPE:
 		return u.Type, nil
 	default:
@@ -52,31 +308,386 @@ func (u *Definition_Body) UnionValue() (interface{}, error) {
 	}
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Definition_Body) MarshalXDR(e xdr.Encoder) error {
+	if err := v.Kind.MarshalXDR(e); err != nil {
+		return err
+	}
+	switch v.Kind {
+	case DEFINITION_KIND_TYPE:
+		if v.Type == nil {
+			return errors.New("definition.body.type: value is nil")
+		}
+		if err := v.Type.MarshalXDR(e); err != nil {
+			return err
+		}
+	case DEFINITION_KIND_CONSTANT:
+		if v.Constant == nil {
+			return errors.New("definition.body.constant: value is nil")
+		}
+		if err := v.Constant.MarshalXDR(e); err != nil {
+			return err
+		}
+	case DEFINITION_KIND_PROGRAM:
+		if v.ProgramSpec == nil {
+			return errors.New("definition.body.program_spec: value is nil")
+		}
+		if err := v.ProgramSpec.MarshalXDR(e); err != nil {
+			return err
+		}
+	default:
+		return errors.New("Invalid discriminant")
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Definition_Body) UnmarshalXDR(d xdr.Decoder) error {
+	if err := v.Kind.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	switch v.Kind {
+	case DEFINITION_KIND_TYPE:
+		v.Type = new(Type)
+		if err := v.Type.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	case DEFINITION_KIND_CONSTANT:
+		v.Constant = new(Constant)
+		if err := v.Constant.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	case DEFINITION_KIND_PROGRAM:
+		v.ProgramSpec = new(ProgramSpec)
+		if err := v.ProgramSpec.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	default:
+		return errors.New("Invalid discriminant")
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Definition_Body)
+
 // A top-level definition
 type Definition struct {
 	// The name of the definition
 	Name string `json:"name"`
 	// The attributes of the definition
-	Attributes Attributes       `json:"attributes"`
-	Body       *Definition_Body `json:"body"`
+	Attributes Attributes `json:"attributes"`
+	// If the definition was imported, the index of the specification it was imported from in `imports`
+	ImportedFrom *uint32 `xdr:"opt" json:"imported_from,omitempty"`
+	// Where the definition is located in its source file, if known
+	Location *Location        `xdr:"opt" json:"location,omitempty"`
+	Body     *Definition_Body `json:"body"`
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Definition) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(uint32(len(v.Name))); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque([]byte(v.Name)); err != nil {
+		return err
+	}
+	if err := v.Attributes.MarshalXDR(e); err != nil {
+		return err
+	}
+	if err := e.EncodeBool(v.ImportedFrom != nil); err != nil {
+		return err
+	}
+	if v.ImportedFrom != nil {
+		if err := e.EncodeUnsignedInt((*v.ImportedFrom)); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeBool(v.Location != nil); err != nil {
+		return err
+	}
+	if v.Location != nil {
+		if err := v.Location.MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+	if v.Body == nil {
+		return errors.New("definition.body: value is nil")
+	}
+	if err := v.Body.MarshalXDR(e); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Definition) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	b2 := []byte{}
+	for uint32(len(b2)) < n1 {
+		c3 := n1 - uint32(len(b2))
+		if c3 > 65536 {
+			c3 = 65536
+		}
+		b2 = append(b2, make([]byte, c3)...)
+		if err := d.DecodeFixedOpaque(b2[uint32(len(b2))-c3:]); err != nil {
+			return err
+		}
+	}
+	v.Name = string(b2)
+	if err := v.Attributes.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	p4, err := d.DecodeBool()
+	if err != nil {
+		return err
+	}
+	if p4 {
+		v.ImportedFrom = new(uint32)
+		if (*v.ImportedFrom), err = d.DecodeUnsignedInt(); err != nil {
+			return err
+		}
+	} else {
+		v.ImportedFrom = nil
+	}
+	p5, err := d.DecodeBool()
+	if err != nil {
+		return err
+	}
+	if p5 {
+		v.Location = new(Location)
+		if err := v.Location.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	} else {
+		v.Location = nil
+	}
+	v.Body = new(Definition_Body)
+	if err := v.Body.UnmarshalXDR(d); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Definition)
+
+// A passthrough line. Backends which generate C may reproduce these; others ignore them
+type Passthrough struct {
+	// Text of the line, following the %
+	Text string `json:"text"`
+	// Number of definitions preceding the line
+	Position uint32 `json:"position"`
+	// Location of the line in the source file
+	Location *Location `xdr:"opt" json:"location,omitempty"`
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Passthrough) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(uint32(len(v.Text))); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque([]byte(v.Text)); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(v.Position); err != nil {
+		return err
+	}
+	if err := e.EncodeBool(v.Location != nil); err != nil {
+		return err
+	}
+	if v.Location != nil {
+		if err := v.Location.MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Passthrough) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	b2 := []byte{}
+	for uint32(len(b2)) < n1 {
+		c3 := n1 - uint32(len(b2))
+		if c3 > 65536 {
+			c3 = 65536
+		}
+		b2 = append(b2, make([]byte, c3)...)
+		if err := d.DecodeFixedOpaque(b2[uint32(len(b2))-c3:]); err != nil {
+			return err
+		}
+	}
+	v.Text = string(b2)
+	if v.Position, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+	p4, err := d.DecodeBool()
+	if err != nil {
+		return err
+	}
+	if p4 {
+		v.Location = new(Location)
+		if err := v.Location.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	} else {
+		v.Location = nil
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Passthrough)
+
+// A span of text in a source file. Lines and columns are counted from 1
+type Location struct {
+	// Name of the source file
+	File string `json:"file"`
+	// Line of the first character of the span
+	Line uint32 `json:"line"`
+	// Column of the first character of the span
+	Column uint32 `json:"column"`
+	// Line of the character immediately following the span
+	EndLine uint32 `json:"end_line"`
+	// Column of the character immediately following the span
+	EndColumn uint32 `json:"end_column"`
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Location) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(uint32(len(v.File))); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque([]byte(v.File)); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(v.Line); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(v.Column); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(v.EndLine); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(v.EndColumn); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Location) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	b2 := []byte{}
+	for uint32(len(b2)) < n1 {
+		c3 := n1 - uint32(len(b2))
+		if c3 > 65536 {
+			c3 = 65536
+		}
+		b2 = append(b2, make([]byte, c3)...)
+		if err := d.DecodeFixedOpaque(b2[uint32(len(b2))-c3:]); err != nil {
+			return err
+		}
+	}
+	v.File = string(b2)
+	if v.Line, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+	if v.Column, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+	if v.EndLine, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+	if v.EndColumn, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Location)
+
 // An attribute of an object
 type Attribute struct {
 	Name  string    `json:"name"`
 	Value *Constant `json:"value"`
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Attribute) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(uint32(len(v.Name))); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque([]byte(v.Name)); err != nil {
+		return err
+	}
+	if v.Value == nil {
+		return errors.New("attribute.value: value is nil")
+	}
+	if err := v.Value.MarshalXDR(e); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Attribute) UnmarshalXDR(d xdr.Decoder) error {
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	b2 := []byte{}
+	for uint32(len(b2)) < n1 {
+		c3 := n1 - uint32(len(b2))
+		if c3 > 65536 {
+			c3 = 65536
+		}
+		b2 = append(b2, make([]byte, c3)...)
+		if err := d.DecodeFixedOpaque(b2[uint32(len(b2))-c3:]); err != nil {
+			return err
+		}
+	}
+	v.Name = string(b2)
+	v.Value = new(Constant)
+	if err := v.Value.UnmarshalXDR(d); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Attribute)
+
 // Constant is union constant
 type Constant struct {
 	Type    ConstantKind `xdr:"union:switch" json:"type"`
-	_       struct{}     `xdr:"union:6" json:",omitempty"`
+	_       struct{}     `xdr:"union:6"`
 	VBool   bool         `xdr:"union:0" json:"v_bool,omitempty"`
 	VPosInt uint64       `xdr:"union:1" json:"v_pos_int,omitempty"`
 	VNegInt uint64       `xdr:"union:2" json:"v_neg_int,omitempty"`
 	VFloat  float64      `xdr:"union:3" json:"v_float,omitempty"`
 	VString string       `xdr:"union:4" json:"v_string,omitempty"`
-	VEnum   uint32       `xdr:"union:5" json:"v_enum,omitempty"`
+	VEnum   int32        `xdr:"union:5" json:"v_enum,omitempty"`
 }
 
 func (u *Constant) UnionDiscriminant() interface{} {
@@ -104,22 +715,120 @@ func (u *Constant) UnionValue() (interface{}, error) {
 	}
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Constant) MarshalXDR(e xdr.Encoder) error {
+	if err := v.Type.MarshalXDR(e); err != nil {
+		return err
+	}
+	switch v.Type {
+	case CONST_BOOL:
+		if err := e.EncodeBool(v.VBool); err != nil {
+			return err
+		}
+	case CONST_POS_INT:
+		if err := e.EncodeUnsignedHyper(v.VPosInt); err != nil {
+			return err
+		}
+	case CONST_NEG_INT:
+		if err := e.EncodeUnsignedHyper(v.VNegInt); err != nil {
+			return err
+		}
+	case CONST_FLOAT:
+		if err := e.EncodeDouble(v.VFloat); err != nil {
+			return err
+		}
+	case CONST_STRING:
+		if err := e.EncodeUnsignedInt(uint32(len(v.VString))); err != nil {
+			return err
+		}
+		if err := e.EncodeFixedOpaque([]byte(v.VString)); err != nil {
+			return err
+		}
+	case CONST_ENUM:
+		if err := e.EncodeInt(v.VEnum); err != nil {
+			return err
+		}
+	case CONST_VOID:
+	default:
+		return errors.New("Invalid discriminant")
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Constant) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	if err := v.Type.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	switch v.Type {
+	case CONST_BOOL:
+		if v.VBool, err = d.DecodeBool(); err != nil {
+			return err
+		}
+	case CONST_POS_INT:
+		if v.VPosInt, err = d.DecodeUnsignedHyper(); err != nil {
+			return err
+		}
+	case CONST_NEG_INT:
+		if v.VNegInt, err = d.DecodeUnsignedHyper(); err != nil {
+			return err
+		}
+	case CONST_FLOAT:
+		if v.VFloat, err = d.DecodeDouble(); err != nil {
+			return err
+		}
+	case CONST_STRING:
+		n1, err := d.DecodeUnsignedInt()
+		if err != nil {
+			return err
+		}
+		b2 := []byte{}
+		for uint32(len(b2)) < n1 {
+			c3 := n1 - uint32(len(b2))
+			if c3 > 65536 {
+				c3 = 65536
+			}
+			b2 = append(b2, make([]byte, c3)...)
+			if err := d.DecodeFixedOpaque(b2[uint32(len(b2))-c3:]); err != nil {
+				return err
+			}
+		}
+		v.VString = string(b2)
+	case CONST_ENUM:
+		if v.VEnum, err = d.DecodeInt(); err != nil {
+			return err
+		}
+	case CONST_VOID:
+	default:
+		return errors.New("Invalid discriminant")
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Constant)
+
 // The kind of a definition
-type DefinitionKind uint32
+type DefinitionKind int32
 
 const (
 	DEFINITION_KIND_TYPE     DefinitionKind = 0
 	DEFINITION_KIND_CONSTANT DefinitionKind = 1
+	DEFINITION_KIND_PROGRAM  DefinitionKind = 2
 )
 
 var xDefinitionKindValToStr = map[DefinitionKind]string{
 	DEFINITION_KIND_TYPE:     "DEFINITION_KIND_TYPE",     // 0
 	DEFINITION_KIND_CONSTANT: "DEFINITION_KIND_CONSTANT", // 1
+	DEFINITION_KIND_PROGRAM:  "DEFINITION_KIND_PROGRAM",  // 2
 }
 
 var xDefinitionKindStrToVal = map[string]DefinitionKind{
 	"DEFINITION_KIND_TYPE":     DEFINITION_KIND_TYPE,
 	"DEFINITION_KIND_CONSTANT": DEFINITION_KIND_CONSTANT,
+	"DEFINITION_KIND_PROGRAM":  DEFINITION_KIND_PROGRAM,
 }
 
 // String satisfies fmt.Stringer
@@ -152,7 +861,20 @@ func (v DefinitionKind) IsKnown() bool {
 	return ok
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v DefinitionKind) MarshalXDR(e xdr.Encoder) error {
+	return e.EncodeInt(int32(v))
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *DefinitionKind) UnmarshalXDR(d xdr.Decoder) error {
+	x, err := d.DecodeInt()
+	*v = DefinitionKind(x)
+	return err
+}
+
 var (
+	_ xdr.Marshaler            = new(DefinitionKind)
 	_ fmt.Stringer             = DefinitionKind(0)
 	_ encoding.TextMarshaler   = DefinitionKind(0)
 	_ encoding.TextUnmarshaler = new(DefinitionKind)
@@ -161,7 +883,7 @@ var (
 // Definition of a type
 type Type struct {
 	Kind       TypeKind     `xdr:"union:switch" json:"kind"`
-	_          struct{}     `xdr:"union:5,9,3,4,7,2,1,6,0,8" json:",omitempty"`
+	_          struct{}     `xdr:"union:0,1,2,3,4,5,6,7,8,9"`
 	EnumSpec   *EnumSpec    `xdr:"union:10" json:"enum_spec,omitempty"`
 	StructSpec *StructSpec  `xdr:"union:11" json:"struct_spec,omitempty"`
 	UnionSpec  *UnionSpec   `xdr:"union:12" json:"union_spec,omitempty"`
@@ -210,8 +932,152 @@ func (u *Type) UnionValue() (interface{}, error) {
 	}
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Type) MarshalXDR(e xdr.Encoder) error {
+	if err := v.Kind.MarshalXDR(e); err != nil {
+		return err
+	}
+	switch v.Kind {
+	case TYPE_VOID, TYPE_BOOL, TYPE_INT, TYPE_UNSIGNED_INT, TYPE_HYPER, TYPE_UNSIGNED_HYPER, TYPE_FLOAT, TYPE_DOUBLE, TYPE_STRING, TYPE_OPAQUE:
+	case TYPE_ENUM:
+		if v.EnumSpec == nil {
+			return errors.New("type.enum_spec: value is nil")
+		}
+		if err := v.EnumSpec.MarshalXDR(e); err != nil {
+			return err
+		}
+	case TYPE_STRUCT:
+		if v.StructSpec == nil {
+			return errors.New("type.struct_spec: value is nil")
+		}
+		if err := v.StructSpec.MarshalXDR(e); err != nil {
+			return err
+		}
+	case TYPE_UNION:
+		if v.UnionSpec == nil {
+			return errors.New("type.union_spec: value is nil")
+		}
+		if err := v.UnionSpec.MarshalXDR(e); err != nil {
+			return err
+		}
+	case TYPE_REF:
+		if err := e.EncodeUnsignedInt(v.Ref); err != nil {
+			return err
+		}
+	case TYPE_TYPEDEF:
+		if v.TypeDef == nil {
+			return errors.New("type.type_def: value is nil")
+		}
+		if err := v.TypeDef.MarshalXDR(e); err != nil {
+			return err
+		}
+	default:
+		return errors.New("Invalid discriminant")
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Type) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	if err := v.Kind.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	switch v.Kind {
+	case TYPE_VOID, TYPE_BOOL, TYPE_INT, TYPE_UNSIGNED_INT, TYPE_HYPER, TYPE_UNSIGNED_HYPER, TYPE_FLOAT, TYPE_DOUBLE, TYPE_STRING, TYPE_OPAQUE:
+	case TYPE_ENUM:
+		v.EnumSpec = new(EnumSpec)
+		if err := v.EnumSpec.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	case TYPE_STRUCT:
+		v.StructSpec = new(StructSpec)
+		if err := v.StructSpec.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	case TYPE_UNION:
+		v.UnionSpec = new(UnionSpec)
+		if err := v.UnionSpec.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	case TYPE_REF:
+		if v.Ref, err = d.DecodeUnsignedInt(); err != nil {
+			return err
+		}
+	case TYPE_TYPEDEF:
+		v.TypeDef = new(Declaration)
+		if err := v.TypeDef.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	default:
+		return errors.New("Invalid discriminant")
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Type)
+
+// An ONC RPC program, as defined in section 12 of RFC 5531
+type ProgramSpec struct {
+	// Program number
+	Number uint32 `json:"number"`
+	// Versions of the program
+	Versions []*VersionSpec `json:"versions"`
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *ProgramSpec) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(v.Number); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.Versions))); err != nil {
+		return err
+	}
+	for i1 := range v.Versions {
+		if v.Versions[i1] == nil {
+			return errors.New("program_spec.versions: value is nil")
+		}
+		if err := v.Versions[i1].MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *ProgramSpec) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	if v.Number, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	c2 := n1
+	if c2 > 1024 {
+		c2 = 1024
+	}
+	v.Versions = make([]*VersionSpec, 0, c2)
+	for i3 := uint32(0); i3 < n1; i3++ {
+		var v4 *VersionSpec
+		v4 = new(VersionSpec)
+		if err := v4.UnmarshalXDR(d); err != nil {
+			return err
+		}
+		v.Versions = append(v.Versions, v4)
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(ProgramSpec)
+
 // The kind of the type
-type TypeKind uint32
+type TypeKind int32
 
 const (
 	TYPE_VOID           TypeKind = 0
@@ -297,7 +1163,20 @@ func (v TypeKind) IsKnown() bool {
 	return ok
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v TypeKind) MarshalXDR(e xdr.Encoder) error {
+	return e.EncodeInt(int32(v))
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *TypeKind) UnmarshalXDR(d xdr.Decoder) error {
+	x, err := d.DecodeInt()
+	*v = TypeKind(x)
+	return err
+}
+
 var (
+	_ xdr.Marshaler            = new(TypeKind)
 	_ fmt.Stringer             = TypeKind(0)
 	_ encoding.TextMarshaler   = TypeKind(0)
 	_ encoding.TextUnmarshaler = new(TypeKind)
@@ -311,34 +1190,230 @@ type EnumSpec struct {
 	Count uint32 `json:"count"`
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v *EnumSpec) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(v.Base); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(v.Count); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *EnumSpec) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	if v.Base, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+	if v.Count, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(EnumSpec)
+
 // Definition of an enum
 type StructSpec struct {
 	// Set of struct members
 	Members []*Declaration `json:"members"`
 }
 
-// Mapping from values to union member. `member` is the index of the member in `members`
+// MarshalXDR satisfies xdr.Marshaler
+func (v *StructSpec) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(uint32(len(v.Members))); err != nil {
+		return err
+	}
+	for i1 := range v.Members {
+		if v.Members[i1] == nil {
+			return errors.New("struct_spec.members: value is nil")
+		}
+		if err := v.Members[i1].MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *StructSpec) UnmarshalXDR(d xdr.Decoder) error {
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	c2 := n1
+	if c2 > 1024 {
+		c2 = 1024
+	}
+	v.Members = make([]*Declaration, 0, c2)
+	for i3 := uint32(0); i3 < n1; i3++ {
+		var v4 *Declaration
+		v4 = new(Declaration)
+		if err := v4.UnmarshalXDR(d); err != nil {
+			return err
+		}
+		v.Members = append(v.Members, v4)
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(StructSpec)
+
+// Mapping from values to union member. `member` is the index of the member in `members`. Values above the range of an int (for unsigned int discriminants) are stored as the int with the same encoding
 type UnionSpec_Options struct {
-	Value  uint32 `json:"value"`
+	Value  int32  `json:"value"`
 	Member uint32 `json:"member"`
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v *UnionSpec_Options) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeInt(v.Value); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(v.Member); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *UnionSpec_Options) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	if v.Value, err = d.DecodeInt(); err != nil {
+		return err
+	}
+	if v.Member, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(UnionSpec_Options)
+
 // Definition of a union
 type UnionSpec struct {
 	// Discriminant field
 	Discriminant *Declaration `json:"discriminant"`
 	// Set of union member fields
 	Members []*Declaration `json:"members"`
-	// Mapping from values to union member. `member` is the index of the member in `members`
-	Options map[uint32]uint32 `json:"options"`
+	// Mapping from values to union member. `member` is the index of the member in `members`. Values above the range of an int (for unsigned int discriminants) are stored as the int with the same encoding
+	Options map[int32]uint32 `json:"options"`
 	// If a default member is present, defines it
 	DefaultMember *uint32 `xdr:"opt" json:"default_member,omitempty"`
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v *UnionSpec) MarshalXDR(e xdr.Encoder) error {
+	if v.Discriminant == nil {
+		return errors.New("union_spec.discriminant: value is nil")
+	}
+	if err := v.Discriminant.MarshalXDR(e); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.Members))); err != nil {
+		return err
+	}
+	for i1 := range v.Members {
+		if v.Members[i1] == nil {
+			return errors.New("union_spec.members: value is nil")
+		}
+		if err := v.Members[i1].MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.Options))); err != nil {
+		return err
+	}
+	for k2, v3 := range v.Options {
+		if err := e.EncodeInt(k2); err != nil {
+			return err
+		}
+		if err := e.EncodeUnsignedInt(v3); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeBool(v.DefaultMember != nil); err != nil {
+		return err
+	}
+	if v.DefaultMember != nil {
+		if err := e.EncodeUnsignedInt((*v.DefaultMember)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *UnionSpec) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	v.Discriminant = new(Declaration)
+	if err := v.Discriminant.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	c2 := n1
+	if c2 > 1024 {
+		c2 = 1024
+	}
+	v.Members = make([]*Declaration, 0, c2)
+	for i3 := uint32(0); i3 < n1; i3++ {
+		var v4 *Declaration
+		v4 = new(Declaration)
+		if err := v4.UnmarshalXDR(d); err != nil {
+			return err
+		}
+		v.Members = append(v.Members, v4)
+	}
+	n5, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	v.Options = make(map[int32]uint32)
+	for i6 := uint32(0); i6 < n5; i6++ {
+		var k7 int32
+		var v8 uint32
+		if k7, err = d.DecodeInt(); err != nil {
+			return err
+		}
+		if v8, err = d.DecodeUnsignedInt(); err != nil {
+			return err
+		}
+		v.Options[k7] = v8
+	}
+	p9, err := d.DecodeBool()
+	if err != nil {
+		return err
+	}
+	if p9 {
+		v.DefaultMember = new(uint32)
+		if (*v.DefaultMember), err = d.DecodeUnsignedInt(); err != nil {
+			return err
+		}
+	} else {
+		v.DefaultMember = nil
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(UnionSpec)
+
 // Modifier of the type
 type Declaration_Modifier struct {
 	Kind DeclarationModifier `xdr:"union:switch" json:"kind"`
-	_    struct{}            `xdr:"union:0,1,5" json:",omitempty"`
+	_    struct{}            `xdr:"union:0,1,5"`
 	Size uint32              `xdr:"union:2,3" json:"size,omitempty"`
 }
 
@@ -363,6 +1438,45 @@ func (u *Declaration_Modifier) UnionValue() (interface{}, error) {
 	}
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Declaration_Modifier) MarshalXDR(e xdr.Encoder) error {
+	if err := v.Kind.MarshalXDR(e); err != nil {
+		return err
+	}
+	switch v.Kind {
+	case DECLARATION_MODIFIER_NONE, DECLARATION_MODIFIER_OPTIONAL, DECLARATION_MODIFIER_UNBOUNDED:
+	case DECLARATION_MODIFIER_FIXED, DECLARATION_MODIFIER_FLEXIBLE:
+		if err := e.EncodeUnsignedInt(v.Size); err != nil {
+			return err
+		}
+	default:
+		return errors.New("Invalid discriminant")
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Declaration_Modifier) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	if err := v.Kind.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	switch v.Kind {
+	case DECLARATION_MODIFIER_NONE, DECLARATION_MODIFIER_OPTIONAL, DECLARATION_MODIFIER_UNBOUNDED:
+	case DECLARATION_MODIFIER_FIXED, DECLARATION_MODIFIER_FLEXIBLE:
+		if v.Size, err = d.DecodeUnsignedInt(); err != nil {
+			return err
+		}
+	default:
+		return errors.New("Invalid discriminant")
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Declaration_Modifier)
+
 // Field declaration
 type Declaration struct {
 	// Type of the field
@@ -373,10 +1487,94 @@ type Declaration struct {
 	Modifier *Declaration_Modifier `json:"modifier"`
 	// Field attributes
 	Attributes Attributes `json:"attributes"`
+	// Where the declaration is located in its source file, if known
+	Location *Location `xdr:"opt" json:"location,omitempty"`
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Declaration) MarshalXDR(e xdr.Encoder) error {
+	if v.Type == nil {
+		return errors.New("declaration.type: value is nil")
+	}
+	if err := v.Type.MarshalXDR(e); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.Name))); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque([]byte(v.Name)); err != nil {
+		return err
+	}
+	if v.Modifier == nil {
+		return errors.New("declaration.modifier: value is nil")
+	}
+	if err := v.Modifier.MarshalXDR(e); err != nil {
+		return err
+	}
+	if err := v.Attributes.MarshalXDR(e); err != nil {
+		return err
+	}
+	if err := e.EncodeBool(v.Location != nil); err != nil {
+		return err
+	}
+	if v.Location != nil {
+		if err := v.Location.MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Declaration) UnmarshalXDR(d xdr.Decoder) error {
+	v.Type = new(Type)
+	if err := v.Type.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	b2 := []byte{}
+	for uint32(len(b2)) < n1 {
+		c3 := n1 - uint32(len(b2))
+		if c3 > 65536 {
+			c3 = 65536
+		}
+		b2 = append(b2, make([]byte, c3)...)
+		if err := d.DecodeFixedOpaque(b2[uint32(len(b2))-c3:]); err != nil {
+			return err
+		}
+	}
+	v.Name = string(b2)
+	v.Modifier = new(Declaration_Modifier)
+	if err := v.Modifier.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	if err := v.Attributes.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	p4, err := d.DecodeBool()
+	if err != nil {
+		return err
+	}
+	if p4 {
+		v.Location = new(Location)
+		if err := v.Location.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	} else {
+		v.Location = nil
+	}
+
+	return nil
 }
 
+var _ xdr.Marshaler = new(Declaration)
+
 // How a declaration modifies its type
-type DeclarationModifier uint32
+type DeclarationModifier int32
 
 const (
 	DECLARATION_MODIFIER_NONE      DeclarationModifier = 0
@@ -432,23 +1630,277 @@ func (v DeclarationModifier) IsKnown() bool {
 	return ok
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v DeclarationModifier) MarshalXDR(e xdr.Encoder) error {
+	return e.EncodeInt(int32(v))
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *DeclarationModifier) UnmarshalXDR(d xdr.Decoder) error {
+	x, err := d.DecodeInt()
+	*v = DeclarationModifier(x)
+	return err
+}
+
 var (
+	_ xdr.Marshaler            = new(DeclarationModifier)
 	_ fmt.Stringer             = DeclarationModifier(0)
 	_ encoding.TextMarshaler   = DeclarationModifier(0)
 	_ encoding.TextUnmarshaler = new(DeclarationModifier)
 )
 
+// A version of an ONC RPC program
+type VersionSpec struct {
+	// The name of the version
+	Name string `json:"name"`
+	// The attributes of the version
+	Attributes Attributes `json:"attributes"`
+	// Version number
+	Number uint32 `json:"number"`
+	// Procedures defined by this version
+	Procedures []*Procedure `json:"procedures"`
+	// Where the version is located in its source file, if known
+	Location *Location `xdr:"opt" json:"location,omitempty"`
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *VersionSpec) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(uint32(len(v.Name))); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque([]byte(v.Name)); err != nil {
+		return err
+	}
+	if err := v.Attributes.MarshalXDR(e); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(v.Number); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.Procedures))); err != nil {
+		return err
+	}
+	for i1 := range v.Procedures {
+		if v.Procedures[i1] == nil {
+			return errors.New("version_spec.procedures: value is nil")
+		}
+		if err := v.Procedures[i1].MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeBool(v.Location != nil); err != nil {
+		return err
+	}
+	if v.Location != nil {
+		if err := v.Location.MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *VersionSpec) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	b2 := []byte{}
+	for uint32(len(b2)) < n1 {
+		c3 := n1 - uint32(len(b2))
+		if c3 > 65536 {
+			c3 = 65536
+		}
+		b2 = append(b2, make([]byte, c3)...)
+		if err := d.DecodeFixedOpaque(b2[uint32(len(b2))-c3:]); err != nil {
+			return err
+		}
+	}
+	v.Name = string(b2)
+	if err := v.Attributes.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	if v.Number, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+	n4, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	c5 := n4
+	if c5 > 1024 {
+		c5 = 1024
+	}
+	v.Procedures = make([]*Procedure, 0, c5)
+	for i6 := uint32(0); i6 < n4; i6++ {
+		var v7 *Procedure
+		v7 = new(Procedure)
+		if err := v7.UnmarshalXDR(d); err != nil {
+			return err
+		}
+		v.Procedures = append(v.Procedures, v7)
+	}
+	p8, err := d.DecodeBool()
+	if err != nil {
+		return err
+	}
+	if p8 {
+		v.Location = new(Location)
+		if err := v.Location.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	} else {
+		v.Location = nil
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(VersionSpec)
+
+// A procedure within a version of an ONC RPC program
+type Procedure struct {
+	// The name of the procedure
+	Name string `json:"name"`
+	// The attributes of the procedure
+	Attributes Attributes `json:"attributes"`
+	// Procedure number
+	Number uint32 `json:"number"`
+	// Argument types. A procedure declared as taking void has no arguments
+	Arguments []*Type `json:"arguments"`
+	// Result type
+	Result *Type `json:"result"`
+	// Where the procedure is located in its source file, if known
+	Location *Location `xdr:"opt" json:"location,omitempty"`
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Procedure) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(uint32(len(v.Name))); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque([]byte(v.Name)); err != nil {
+		return err
+	}
+	if err := v.Attributes.MarshalXDR(e); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(v.Number); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.Arguments))); err != nil {
+		return err
+	}
+	for i1 := range v.Arguments {
+		if v.Arguments[i1] == nil {
+			return errors.New("procedure.arguments: value is nil")
+		}
+		if err := v.Arguments[i1].MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+	if v.Result == nil {
+		return errors.New("procedure.result: value is nil")
+	}
+	if err := v.Result.MarshalXDR(e); err != nil {
+		return err
+	}
+	if err := e.EncodeBool(v.Location != nil); err != nil {
+		return err
+	}
+	if v.Location != nil {
+		if err := v.Location.MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Procedure) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	b2 := []byte{}
+	for uint32(len(b2)) < n1 {
+		c3 := n1 - uint32(len(b2))
+		if c3 > 65536 {
+			c3 = 65536
+		}
+		b2 = append(b2, make([]byte, c3)...)
+		if err := d.DecodeFixedOpaque(b2[uint32(len(b2))-c3:]); err != nil {
+			return err
+		}
+	}
+	v.Name = string(b2)
+	if err := v.Attributes.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	if v.Number, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+	n4, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	c5 := n4
+	if c5 > 1024 {
+		c5 = 1024
+	}
+	v.Arguments = make([]*Type, 0, c5)
+	for i6 := uint32(0); i6 < n4; i6++ {
+		var v7 *Type
+		v7 = new(Type)
+		if err := v7.UnmarshalXDR(d); err != nil {
+			return err
+		}
+		v.Arguments = append(v.Arguments, v7)
+	}
+	v.Result = new(Type)
+	if err := v.Result.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	p8, err := d.DecodeBool()
+	if err != nil {
+		return err
+	}
+	if p8 {
+		v.Location = new(Location)
+		if err := v.Location.UnmarshalXDR(d); err != nil {
+			return err
+		}
+	} else {
+		v.Location = nil
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Procedure)
+
 // Type of a constant. These are a subset of XDR types
-type ConstantKind uint32
+type ConstantKind int32
 
 const (
-	CONST_VOID    ConstantKind = 6
-	CONST_BOOL    ConstantKind = 0
+	// Void (empty)
+	CONST_VOID ConstantKind = 6
+	// Boolean
+	CONST_BOOL ConstantKind = 0
+	// Positive integer (unsigned hyper)
 	CONST_POS_INT ConstantKind = 1
+	// Negative integer (negate as a signed hyper)
 	CONST_NEG_INT ConstantKind = 2
-	CONST_FLOAT   ConstantKind = 3
-	CONST_STRING  ConstantKind = 4
-	CONST_ENUM    ConstantKind = 5
+	// Double precision floating point value
+	CONST_FLOAT ConstantKind = 3
+	// String constant
+	CONST_STRING ConstantKind = 4
+	// Enumeration value
+	CONST_ENUM ConstantKind = 5
 )
 
 var xConstantKindValToStr = map[ConstantKind]string{
@@ -501,7 +1953,20 @@ func (v ConstantKind) IsKnown() bool {
 	return ok
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v ConstantKind) MarshalXDR(e xdr.Encoder) error {
+	return e.EncodeInt(int32(v))
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *ConstantKind) UnmarshalXDR(d xdr.Decoder) error {
+	x, err := d.DecodeInt()
+	*v = ConstantKind(x)
+	return err
+}
+
 var (
+	_ xdr.Marshaler            = new(ConstantKind)
 	_ fmt.Stringer             = ConstantKind(0)
 	_ encoding.TextMarshaler   = ConstantKind(0)
 	_ encoding.TextUnmarshaler = new(ConstantKind)
@@ -0,0 +1,41 @@
+package ast
+
+import "testing"
+
+func TestConstantAsInt(t *testing.T) {
+	tests := []struct {
+		c   Constant
+		u32 uint32
+		i32 int32
+		// Whether the constant is out of range for each type
+		u32Err, i32Err bool
+	}{
+		{Constant{Type: CONST_POS_INT, VPosInt: 0}, 0, 0, false, false},
+		{Constant{Type: CONST_POS_INT, VPosInt: 0x7fffffff}, 0x7fffffff, 0x7fffffff, false, false},
+		{Constant{Type: CONST_POS_INT, VPosInt: 0x80000000}, 0x80000000, 0, false, true},
+		{Constant{Type: CONST_POS_INT, VPosInt: 0xffffffff}, 0xffffffff, 0, false, true},
+		{Constant{Type: CONST_POS_INT, VPosInt: 0x100000000}, 0, 0, true, true},
+		{Constant{Type: CONST_NEG_INT, VNegInt: 1}, 0, -1, true, false},
+		{Constant{Type: CONST_NEG_INT, VNegInt: 0x80000000}, 0, -0x80000000, true, false},
+		{Constant{Type: CONST_NEG_INT, VNegInt: 0x80000001}, 0, 0, true, true},
+		{Constant{Type: CONST_ENUM, VEnum: 3}, 3, 3, false, false},
+		{Constant{Type: CONST_ENUM, VEnum: -1}, 0, -1, true, false},
+		{Constant{Type: CONST_STRING, VString: "1"}, 0, 0, true, true},
+	}
+
+	for _, test := range tests {
+		u32, err := test.c.AsU32()
+		if (err != nil) != test.u32Err {
+			t.Errorf("%+v.AsU32(): got error %v", test.c, err)
+		} else if err == nil && u32 != test.u32 {
+			t.Errorf("%+v.AsU32(): got %d, expected %d", test.c, u32, test.u32)
+		}
+
+		i32, err := test.c.AsI32()
+		if (err != nil) != test.i32Err {
+			t.Errorf("%+v.AsI32(): got error %v", test.c, err)
+		} else if err == nil && i32 != test.i32 {
+			t.Errorf("%+v.AsI32(): got %d, expected %d", test.c, i32, test.i32)
+		}
+	}
+}
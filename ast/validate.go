@@ -0,0 +1,431 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError describes a problem found while validating a specification
+type ValidationError struct {
+	// Definition is the name of the definition the problem was found in
+	Definition string
+	// Message describes the problem
+	Message string
+	// Location is the location of the problem, if known
+	Location *Location
+}
+
+func (err *ValidationError) Error() string {
+	if err.Location != nil {
+		return fmt.Sprintf("%s: %s: %s", err.Location, err.Definition, err.Message)
+	}
+	return fmt.Sprintf("%s: %s", err.Definition, err.Message)
+}
+
+// ValidationErrors is the list of problems found while validating a
+// specification
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+type validator struct {
+	s    *Specification
+	name string
+	loc  *Location
+	errs ValidationErrors
+	// finite records which definitions have values of finite size
+	finite []bool
+}
+
+// Validate checks the specification for problems which can't be detected
+// while it is being parsed, such as references to types which are never
+// defined, types which contain themselves (including through unions, every
+// arm of which contains the type) and invalid union discriminants.
+//
+// If any problems are found, they are all returned as a ValidationErrors
+func (s *Specification) Validate() error {
+	v := &validator{s: s}
+	for _, d := range s.Definitions {
+		v.name = d.Name
+		v.loc = d.Location
+		v.definition(d)
+	}
+	v.recursion()
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+func (v *validator) errorf(path string, fmts string, params ...interface{}) {
+	msg := fmt.Sprintf(fmts, params...)
+	if path != "" {
+		msg = fmt.Sprintf("'%s': %s", path, msg)
+	}
+
+	v.errs = append(v.errs, &ValidationError{
+		Definition: v.name,
+		Message:    msg,
+		Location:   v.loc,
+	})
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func (v *validator) definition(d *Definition) {
+	switch d.Body.Kind {
+	case DEFINITION_KIND_TYPE:
+		// Types which are never defined are reported where they are referenced
+		if d.Body.Type != nil {
+			v.typ(d.Body.Type, "")
+		}
+
+	case DEFINITION_KIND_CONSTANT:
+		if d.Body.Constant == nil {
+			v.errorf("", "Constant has no value")
+		}
+
+	case DEFINITION_KIND_PROGRAM:
+		for _, ver := range d.Body.ProgramSpec.Versions {
+			for _, p := range ver.Procedures {
+				if p.Location != nil {
+					v.loc = p.Location
+				}
+
+				path := joinPath(ver.Name, p.Name)
+				for i, a := range p.Arguments {
+					v.typ(a, fmt.Sprintf("%s argument %d", path, i+1))
+				}
+				v.typ(p.Result, path+" result")
+			}
+		}
+	}
+}
+
+func (v *validator) typ(t *Type, path string) {
+	switch t.Kind {
+	case TYPE_REF:
+		if uint(t.Ref) >= uint(len(v.s.Definitions)) {
+			v.errorf(path, "Reference to nonexistent definition %d", t.Ref)
+		} else if d := v.s.Definitions[t.Ref]; d.Body.Kind != DEFINITION_KIND_TYPE {
+			v.errorf(path, "'%s' is not a type", d.Name)
+		} else if d.Body.Type == nil {
+			v.errorf(path, "Type '%s' is referenced but never defined", d.Name)
+		}
+
+	case TYPE_ENUM:
+		v.enum(t.EnumSpec, path)
+
+	case TYPE_STRUCT:
+		for _, m := range t.StructSpec.Members {
+			v.declaration(m, joinPath(path, m.Name), false)
+		}
+
+	case TYPE_UNION:
+		v.union(t.UnionSpec, path)
+
+	case TYPE_TYPEDEF:
+		v.declaration(t.TypeDef, path, false)
+	}
+}
+
+func (v *validator) declaration(d *Declaration, path string, inUnion bool) {
+	if d.Location != nil {
+		defer func(loc *Location) { v.loc = loc }(v.loc)
+		v.loc = d.Location
+	}
+
+	if d.IsVoid() {
+		if !inUnion {
+			v.errorf(path, "void may only be used in union arms")
+		}
+		return
+	}
+
+	v.typ(d.Type, path)
+
+	switch d.Type.Kind {
+	case TYPE_STRING:
+		switch d.Modifier.Kind {
+		case DECLARATION_MODIFIER_FLEXIBLE, DECLARATION_MODIFIER_UNBOUNDED:
+		default:
+			v.errorf(path, "string must be declared with a maximum length, i.e. as string<>")
+		}
+
+	case TYPE_OPAQUE:
+		switch d.Modifier.Kind {
+		case DECLARATION_MODIFIER_FIXED, DECLARATION_MODIFIER_FLEXIBLE, DECLARATION_MODIFIER_UNBOUNDED:
+		default:
+			v.errorf(path, "opaque must be declared as an array")
+		}
+	}
+}
+
+func (v *validator) enum(es *EnumSpec, path string) {
+	if uint64(es.Base)+uint64(es.Count) > uint64(len(v.s.Definitions)) {
+		v.errorf(path, "Enum values %d-%d out of range", es.Base, es.Base+es.Count)
+		return
+	}
+
+	for i := es.Base; i < es.Base+es.Count; i++ {
+		d := v.s.Definitions[i]
+		if d.Body.Kind != DEFINITION_KIND_CONSTANT || d.Body.Constant == nil || d.Body.Constant.Type != CONST_ENUM {
+			v.errorf(path, "Enum value '%s' is not an enum constant", d.Name)
+		}
+	}
+}
+
+// resolveScalar follows references and unmodified typedefs, in order to find
+// the underlying type which a type is an alias of
+func (v *validator) resolveScalar(t *Type) *Type {
+	for i := 0; i <= len(v.s.Definitions); i++ {
+		switch t.Kind {
+		case TYPE_REF:
+			_, rt, err := t.FollowRef(v.s)
+			if err != nil || rt == nil {
+				return nil
+			}
+			t = rt
+		case TYPE_TYPEDEF:
+			if t.TypeDef.Modifier.Kind != DECLARATION_MODIFIER_NONE {
+				return t
+			}
+			t = t.TypeDef.Type
+		default:
+			return t
+		}
+	}
+	return nil
+}
+
+func (v *validator) union(us *UnionSpec, path string) {
+	discPath := joinPath(path, us.Discriminant.Name)
+	v.declaration(us.Discriminant, discPath, false)
+
+	if us.Discriminant.Modifier.Kind != DECLARATION_MODIFIER_NONE {
+		v.errorf(discPath, "Union discriminant may not be an array or optional")
+	}
+
+	dt := v.resolveScalar(us.Discriminant.Type)
+	if dt != nil {
+		switch dt.Kind {
+		case TYPE_INT, TYPE_UNSIGNED_INT, TYPE_ENUM:
+		case TYPE_BOOL:
+			for val := range us.Options {
+				if val < 0 || val > 1 {
+					v.errorf(discPath, "Case %d is not a valid bool", val)
+				}
+			}
+		default:
+			v.errorf(discPath, "Union discriminant must be an int, unsigned int, bool or enum, not %s", dt.Kind)
+		}
+
+		if dt.Kind == TYPE_ENUM {
+			values := make(map[int32]bool)
+			for _, opt := range dt.EnumSpec.GetOptions(v.s) {
+				values[opt.Value] = true
+			}
+
+			for val := range us.Options {
+				if !values[val] {
+					v.errorf(discPath, "Case %d is not a value of the discriminant enum", val)
+				}
+			}
+		}
+	}
+
+	for _, m := range us.Members {
+		v.declaration(m, joinPath(path, m.Name), true)
+	}
+
+	for val, m := range us.Options {
+		if uint(m) >= uint(len(us.Members)) {
+			v.errorf(path, "Case %d refers to nonexistent member %d", val, m)
+		}
+	}
+
+	if us.DefaultMember != nil && uint(*us.DefaultMember) >= uint(len(us.Members)) {
+		v.errorf(path, "Default case refers to nonexistent member %d", *us.DefaultMember)
+	}
+}
+
+// byValue returns if a declaration contains its type by value (that is, not
+// through an optional or variable length array)
+func byValue(d *Declaration) bool {
+	switch d.Modifier.Kind {
+	case DECLARATION_MODIFIER_NONE:
+		return true
+	case DECLARATION_MODIFIER_FIXED:
+		return d.Modifier.Size > 0
+	default:
+		return false
+	}
+}
+
+// arms returns the members of a union which may be selected
+func arms(us *UnionSpec) []*Declaration {
+	var arms []*Declaration
+	for _, m := range us.Options {
+		if uint(m) < uint(len(us.Members)) {
+			arms = append(arms, us.Members[m])
+		}
+	}
+	if us.DefaultMember != nil && uint(*us.DefaultMember) < uint(len(us.Members)) {
+		arms = append(arms, us.Members[*us.DefaultMember])
+	}
+	return arms
+}
+
+// isFinite returns if the values of t have a finite size, given which
+// definitions are known to. A union is finite if any of its arms are, as a
+// value may choose that arm
+func (v *validator) isFinite(t *Type) bool {
+	switch t.Kind {
+	case TYPE_REF:
+		return uint(t.Ref) >= uint(len(v.s.Definitions)) || v.finite[t.Ref]
+	case TYPE_STRUCT:
+		for _, m := range t.StructSpec.Members {
+			if byValue(m) && !v.isFinite(m.Type) {
+				return false
+			}
+		}
+	case TYPE_UNION:
+		arms := arms(t.UnionSpec)
+		for _, m := range arms {
+			if m.IsVoid() || !byValue(m) || v.isFinite(m.Type) {
+				return true
+			}
+		}
+		return len(arms) == 0
+	case TYPE_TYPEDEF:
+		return !byValue(t.TypeDef) || v.isFinite(t.TypeDef.Type)
+	}
+	return true
+}
+
+// valueRefs returns the definitions which are contained by value (that is,
+// not through an optional or variable length array) by the type t. The arms
+// of a union are only followed if none of them are finite, as otherwise a
+// value may choose a finite arm
+func (v *validator) valueRefs(t *Type, refs []uint32) []uint32 {
+	switch t.Kind {
+	case TYPE_REF:
+		if uint(t.Ref) < uint(len(v.s.Definitions)) {
+			refs = append(refs, t.Ref)
+		}
+	case TYPE_STRUCT:
+		for _, m := range t.StructSpec.Members {
+			if byValue(m) {
+				refs = v.valueRefs(m.Type, refs)
+			}
+		}
+	case TYPE_UNION:
+		if !v.isFinite(t) {
+			for _, m := range arms(t.UnionSpec) {
+				refs = v.valueRefs(m.Type, refs)
+			}
+		}
+	case TYPE_TYPEDEF:
+		if byValue(t.TypeDef) {
+			refs = v.valueRefs(t.TypeDef.Type, refs)
+		}
+	}
+	return refs
+}
+
+// findFinite determines which definitions have values of finite size. Every
+// definition is finite except types which (perhaps through the arms of
+// unions) must contain themselves, or a type which does
+func (v *validator) findFinite() {
+	defs := v.s.Definitions
+	v.finite = make([]bool, len(defs))
+	for i, d := range defs {
+		v.finite[i] = d.Body.Kind != DEFINITION_KIND_TYPE || d.Body.Type == nil
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i, d := range defs {
+			if !v.finite[i] && v.isFinite(d.Body.Type) {
+				v.finite[i] = true
+				changed = true
+			}
+		}
+	}
+}
+
+// recursion detects types which contain themselves by value, and therefore
+// would have an infinite encoding
+func (v *validator) recursion() {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	v.findFinite()
+
+	defs := v.s.Definitions
+	state := make([]int, len(defs))
+	var stack []uint32
+
+	var visit func(i uint32)
+	visit = func(i uint32) {
+		state[i] = visiting
+		stack = append(stack, i)
+
+		var refs []uint32
+		if d := defs[i]; d.Body.Kind == DEFINITION_KIND_TYPE && d.Body.Type != nil {
+			refs = v.valueRefs(d.Body.Type, nil)
+		}
+
+		seen := make(map[uint32]bool, len(refs))
+		for _, j := range refs {
+			if seen[j] {
+				continue
+			}
+			seen[j] = true
+
+			switch state[j] {
+			case unvisited:
+				visit(j)
+			case visiting:
+				var names []string
+				for k := len(stack) - 1; k >= 0; k-- {
+					names = append([]string{defs[stack[k]].Name}, names...)
+					if stack[k] == j {
+						break
+					}
+				}
+				names = append(names, defs[j].Name)
+
+				v.name = defs[j].Name
+				v.loc = defs[j].Location
+				v.errorf("", "Type contains itself without indirection (%s); "+
+					"an optional (*) or variable length member, or a union arm which doesn't contain it, is required to break the cycle",
+					strings.Join(names, " -> "))
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+	}
+
+	for i := range defs {
+		if state[i] == unvisited {
+			visit(uint32(i))
+		}
+	}
+}
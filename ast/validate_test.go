@@ -0,0 +1,190 @@
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.e43.eu/xdrgen/ast"
+	"go.e43.eu/xdrgen/parser"
+)
+
+const cycleHint = "; an optional (*) or variable length member, or a union arm which doesn't contain it, is required to break the cycle"
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		// errs are the errors reported, as formatted by ValidationError.Error
+		errs []string
+	}{
+		{
+			"Valid",
+			"struct list { int v; list *next; }; union u switch (int d) { case 1: u x; default: void; };",
+			nil,
+		},
+		{
+			"Unresolved reference",
+			"struct s { undefined_t x; };",
+			[]string{"test.x:1:12: s: 'x': Type 'undefined_t' is referenced but never defined"},
+		},
+		{
+			"Void outside a union",
+			"struct s { int a; void; };",
+			[]string{"test.x:1:19: s: void may only be used in union arms"},
+		},
+		{
+			"String discriminant",
+			"union u switch (string d<>) { case 1: int x; };",
+			[]string{
+				"test.x:1:1: u: 'd': Union discriminant may not be an array or optional",
+				"test.x:1:1: u: 'd': Union discriminant must be an int, unsigned int, bool or enum, not TYPE_STRING",
+			},
+		},
+		{
+			"Struct discriminant",
+			"struct d { int x; }; union u switch (d x) { case 1: int y; };",
+			[]string{"test.x:1:22: u: 'x': Union discriminant must be an int, unsigned int, bool or enum, not TYPE_STRUCT"},
+		},
+		{
+			"Typedef discriminant",
+			"typedef unsigned int t; union u switch (t d) { case 1: int x; };",
+			nil,
+		},
+		{
+			"Bool case",
+			"union u switch (bool b) { case 2: int x; };",
+			[]string{"test.x:1:1: u: 'b': Case 2 is not a valid bool"},
+		},
+		{
+			"Enum case",
+			"enum e { A = 1 }; union u switch (e d) { case 2: int x; };",
+			[]string{"test.x:1:19: u: 'd': Case 2 is not a value of the discriminant enum"},
+		},
+		{
+			"Struct containing itself",
+			"struct s { int a; s x; };",
+			[]string{"test.x:1:1: s: Type contains itself without indirection (s -> s)" + cycleHint},
+		},
+		{
+			"Structs containing each other",
+			"struct a { b x; }; struct b { int v; a y; };",
+			[]string{"test.x:1:1: a: Type contains itself without indirection (a -> b -> a)" + cycleHint},
+		},
+		{
+			"Fixed array of itself",
+			"struct s { s x[2]; };",
+			[]string{"test.x:1:1: s: Type contains itself without indirection (s -> s)" + cycleHint},
+		},
+		{
+			"Indirect members",
+			"struct s { s *a; s b<>; s c[0]; };",
+			nil,
+		},
+		{
+			"Union with every arm containing itself",
+			"union u switch (int d) { case 1: u x; default: u y; };",
+			[]string{"test.x:1:1: u: Type contains itself without indirection (u -> u)" + cycleHint},
+		},
+		{
+			"Union with an arm not containing itself",
+			"union u switch (int d) { case 1: u x; case 2: int y; };",
+			nil,
+		},
+		{
+			"Union with every arm containing a struct containing it",
+			"struct s { u a; }; union u switch (int d) { case 1: s x; case 2: case 3: s y; };",
+			[]string{"test.x:1:1: s: Type contains itself without indirection (s -> u -> s)" + cycleHint},
+		},
+	}
+
+	for _, test := range tests {
+		s, err := parser.ParseSpecification(strings.NewReader(test.src), "test.x")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		var errs []string
+		if err := s.Validate(); err != nil {
+			verrs, ok := err.(ast.ValidationErrors)
+			if !ok {
+				t.Errorf("%s: Validate returned a %T", test.name, err)
+				continue
+			}
+			for _, verr := range verrs {
+				errs = append(errs, verr.Error())
+			}
+		}
+
+		if strings.Join(errs, "\n") != strings.Join(test.errs, "\n") {
+			t.Errorf("%s: got errors\n\t%s\nexpected\n\t%s", test.name, strings.Join(errs, "\n\t"), strings.Join(test.errs, "\n\t"))
+		}
+	}
+}
+
+// typedef returns a specification of a typedef of the type kind with the
+// modifier mod, which can't be parsed
+func typedef(kind ast.TypeKind, mod ast.DeclarationModifier) *ast.Specification {
+	return &ast.Specification{
+		Definitions: []*ast.Definition{{
+			Name: "t",
+			Body: &ast.Definition_Body{
+				Kind: ast.DEFINITION_KIND_TYPE,
+				Type: &ast.Type{
+					Kind: ast.TYPE_TYPEDEF,
+					TypeDef: &ast.Declaration{
+						Name:     "t",
+						Type:     &ast.Type{Kind: kind},
+						Modifier: &ast.Declaration_Modifier{Kind: mod, Size: 4},
+					},
+				},
+			},
+		}},
+	}
+}
+
+func TestValidateModifiers(t *testing.T) {
+	const (
+		badString = "t: string must be declared with a maximum length, i.e. as string<>"
+		badOpaque = "t: opaque must be declared as an array"
+	)
+
+	tests := []struct {
+		kind ast.TypeKind
+		mod  ast.DeclarationModifier
+		err  string
+	}{
+		{ast.TYPE_STRING, ast.DECLARATION_MODIFIER_NONE, badString},
+		{ast.TYPE_STRING, ast.DECLARATION_MODIFIER_OPTIONAL, badString},
+		{ast.TYPE_STRING, ast.DECLARATION_MODIFIER_FIXED, badString},
+		{ast.TYPE_STRING, ast.DECLARATION_MODIFIER_FLEXIBLE, ""},
+		{ast.TYPE_STRING, ast.DECLARATION_MODIFIER_UNBOUNDED, ""},
+		{ast.TYPE_OPAQUE, ast.DECLARATION_MODIFIER_NONE, badOpaque},
+		{ast.TYPE_OPAQUE, ast.DECLARATION_MODIFIER_OPTIONAL, badOpaque},
+		{ast.TYPE_OPAQUE, ast.DECLARATION_MODIFIER_FIXED, ""},
+		{ast.TYPE_OPAQUE, ast.DECLARATION_MODIFIER_FLEXIBLE, ""},
+		{ast.TYPE_OPAQUE, ast.DECLARATION_MODIFIER_UNBOUNDED, ""},
+	}
+
+	for _, test := range tests {
+		err := typedef(test.kind, test.mod).Validate()
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("%s %s: got error %v, expected %q", test.kind, test.mod, err, test.err)
+		}
+	}
+}
+
+// TestHyperSizes checks that constants which don't fit in an unsigned int
+// are rejected as sizes
+func TestHyperSizes(t *testing.T) {
+	for _, src := range []string{
+		"const BIG = 0x100000000; typedef opaque o[BIG];",
+		"const BIG = 0x100000000; typedef int o<BIG>;",
+		"const NEG = -1; typedef int o<NEG>;",
+	} {
+		_, err := parser.ParseSpecification(strings.NewReader(src), "test.x")
+		if err == nil || !strings.Contains(err.Error(), "out of range for unsigned int") {
+			t.Errorf("%s: got error %v", src, err)
+		}
+	}
+}
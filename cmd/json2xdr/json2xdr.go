@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/pflag"
+	"go.e43.eu/xdrgen/dynamic"
+	"go.e43.eu/xdrgen/internal/specfile"
+	"go.e43.eu/xdrgen/parser"
+	"go.e43.eu/xdrgen/rpc"
+)
+
+func main() {
+	log.SetPrefix("json2xdr: ")
+	log.SetFlags(0)
+
+	var (
+		config   parser.Config
+		defines  []string
+		schema   string
+		typeName string
+		output   string
+		records  bool
+		base64   bool
+	)
+	specfile.ParserFlags(pflag.CommandLine, &config, &defines)
+	pflag.StringVarP(&schema, "schema", "s", "", "Specification (.x or .xb) defining the type of the data")
+	pflag.StringVarP(&typeName, "type", "t", "", "Type of the data")
+	pflag.StringVarP(&output, "output", "o", "", "File to write the data to (Defaults to standard output)")
+	pflag.BoolVarP(&records, "records", "r", false, "Write each value as a record using the RPC record marking standard")
+	pflag.BoolVar(&base64, "base64", false, "Read opaque data as base64, rather than hex")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: json2xdr -s spec.x -t type [flags] [file.json]\n")
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+	specfile.SetDefines(&config, defines)
+
+	if schema == "" || typeName == "" || pflag.NArg() > 1 {
+		pflag.Usage()
+		os.Exit(2)
+	}
+
+	spec, err := specfile.Load(&config, schema)
+	if err != nil {
+		specfile.PrintError(err)
+		os.Exit(2)
+	}
+
+	codec, err := dynamic.New(spec, typeName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	inName := "<standard input>"
+	in := io.Reader(os.Stdin)
+	if pflag.NArg() == 1 {
+		inName = pflag.Arg(0)
+		f, err := os.Open(inName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var opts dynamic.JSONOptions
+	if base64 {
+		opts.Opaque = dynamic.OpaqueBase64
+	}
+
+	// Encode every value before writing any, so that nothing is written if
+	// any are invalid
+	var values [][]byte
+	dec := json.NewDecoder(bufio.NewReader(in))
+	for n := 1; ; n++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatalf("%s: Value %d: %s", inName, n, err)
+		}
+
+		v, err := codec.FromJSON(raw, opts)
+		if err != nil {
+			log.Fatalf("%s: Value %d: %s", inName, n, err)
+		}
+
+		b, err := codec.Marshal(v)
+		if err != nil {
+			log.Fatalf("%s: Value %d: %s", inName, n, err)
+		}
+		values = append(values, b)
+	}
+
+	out := io.Writer(os.Stdout)
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	for _, b := range values {
+		if records {
+			err = rpc.WriteRecord(w, b)
+		} else {
+			_, err = w.Write(b)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
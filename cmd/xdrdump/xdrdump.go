@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/pflag"
+	"go.e43.eu/xdrgen/dynamic"
+	"go.e43.eu/xdrgen/internal/specfile"
+	"go.e43.eu/xdrgen/parser"
+	"go.e43.eu/xdrgen/rpc"
+)
+
+func main() {
+	log.SetPrefix("xdrdump: ")
+	log.SetFlags(0)
+
+	var (
+		config     parser.Config
+		defines    []string
+		schema     string
+		typeName   string
+		records    bool
+		base64     bool
+		compact    bool
+		maxRecord  int
+		limits     dynamic.Limits
+		jsonIndent = "  "
+	)
+	specfile.ParserFlags(pflag.CommandLine, &config, &defines)
+	pflag.StringVarP(&schema, "schema", "s", "", "Specification (.x or .xb) defining the type of the data")
+	pflag.StringVarP(&typeName, "type", "t", "", "Type of the data")
+	pflag.BoolVarP(&records, "records", "r", false, "Read a stream of records using the RPC record marking standard, each containing a value")
+	pflag.BoolVar(&base64, "base64", false, "Print opaque data as base64, rather than hex")
+	pflag.BoolVarP(&compact, "compact", "c", false, "Print each value on a single line")
+	pflag.IntVar(&maxRecord, "max-record", rpc.DefaultMaxRecordSize, "Maximum size of a record")
+	pflag.Uint32Var(&limits.MaxLength, "max-length", dynamic.DefaultMaxLength, "Maximum length of arrays, strings and opaque data")
+	pflag.IntVar(&limits.MaxDepth, "max-depth", dynamic.DefaultMaxDepth, "Maximum nesting of values")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: xdrdump -s spec.x -t type [flags] [file]\n")
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+	specfile.SetDefines(&config, defines)
+
+	if schema == "" || typeName == "" || pflag.NArg() > 1 {
+		pflag.Usage()
+		os.Exit(2)
+	}
+
+	spec, err := specfile.Load(&config, schema)
+	if err != nil {
+		specfile.PrintError(err)
+		os.Exit(2)
+	}
+
+	codec, err := dynamic.New(spec, typeName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	codec.Limits = limits
+
+	in := io.Reader(os.Stdin)
+	if pflag.NArg() == 1 {
+		f, err := os.Open(pflag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	in = bufio.NewReader(in)
+
+	opts := dynamic.JSONOptions{Indent: jsonIndent}
+	if compact {
+		opts.Indent = ""
+	}
+	if base64 {
+		opts.Opaque = dynamic.OpaqueBase64
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	dec := codec.NewDecoder(in)
+	for n := 1; ; n++ {
+		var v interface{}
+		if records {
+			var rec []byte
+			rec, err = rpc.ReadRecord(in, maxRecord)
+			if err == nil {
+				v, err = codec.Unmarshal(rec)
+			}
+		} else {
+			v, err = dec.Decode()
+		}
+
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			out.Flush()
+			log.Fatalf("Record %d: %s", n, err)
+		}
+
+		js, err := codec.ToJSON(v, opts)
+		if err != nil {
+			out.Flush()
+			log.Fatalf("Record %d: %s", n, err)
+		}
+		out.Write(js)
+		out.WriteByte('\n')
+	}
+}
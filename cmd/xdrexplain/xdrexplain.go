@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"go.e43.eu/xdrgen/dynamic"
+	"go.e43.eu/xdrgen/internal/specfile"
+	"go.e43.eu/xdrgen/parser"
+)
+
+// maxRows is the number of rows of a string or opaque data which are
+// printed, unless --verbose is passed
+const maxRows = 4
+
+// explainer describes the regions of the data, one row per 4 bytes
+type explainer struct {
+	verbose bool
+	rows    [][]string
+	// start is the offset of the value being decoded, and end the offset of
+	// the end of the last region of it which was decoded
+	start, end int64
+}
+
+func (e *explainer) row(off int64, data []byte, cols ...string) {
+	hex := make([]string, len(data))
+	for i, b := range data {
+		hex[i] = fmt.Sprintf("%02x", b)
+	}
+	e.rows = append(e.rows, append([]string{fmt.Sprintf("%08x", off), strings.Join(hex, " ")}, cols...))
+}
+
+// print prints the rows, with their columns aligned
+func (e *explainer) print(w io.Writer) {
+	var widths []int
+	for _, row := range e.rows {
+		for i, col := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if len(col) > widths[i] {
+				widths[i] = len(col)
+			}
+		}
+	}
+
+	for _, row := range e.rows {
+		var line strings.Builder
+		for i, col := range row {
+			fmt.Fprintf(&line, "%-*s  ", widths[i], col)
+		}
+		fmt.Fprintln(w, strings.TrimRight(line.String(), " "))
+	}
+	e.rows = nil
+}
+
+func (e *explainer) region(r *dynamic.Region) {
+	rows := (len(r.Data) + 3) / 4
+	for i := 0; i < rows; i++ {
+		if i == maxRows && !e.verbose && rows > maxRows+1 {
+			e.rows = append(e.rows, []string{"...", "", fmt.Sprintf("(%d more bytes)", len(r.Data)-i*4)})
+			break
+		}
+
+		start, end := i*4, i*4+4
+		if end > len(r.Data) {
+			end = len(r.Data)
+		}
+		if i == 0 {
+			e.row(r.Offset, r.Data[start:end], r.Path, describe(r), value(r))
+		} else {
+			e.row(r.Offset+int64(start), r.Data[start:end])
+		}
+	}
+	e.end = r.Offset + int64(len(r.Data))
+}
+
+// fail describes the data following the last region which was decoded, up
+// to the next multiple of 4 bytes into the value, which caused err
+func (e *explainer) fail(data []byte, err *dynamic.Error) {
+	end := e.start + (e.end-e.start)/4*4 + 4
+	if err.Offset > end {
+		end = err.Offset
+	}
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	e.row(e.end, data[e.end:min(e.end+4, end)], err.Path, "error", err.Message)
+	for off := e.end + 4; off < end; off += 4 {
+		e.row(off, data[off:min(off+4, end)])
+	}
+}
+
+func min(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func describe(r *dynamic.Region) string {
+	switch r.Kind {
+	case dynamic.RegionDiscriminant:
+		return r.Type + " (discriminant)"
+	case dynamic.RegionLength:
+		return "length of " + r.Type
+	case dynamic.RegionFlag:
+		return "presence of " + r.Type
+	case dynamic.RegionPadding:
+		return "padding"
+	}
+	return r.Type
+}
+
+func value(r *dynamic.Region) string {
+	switch v := r.Value.(type) {
+	case nil:
+		return ""
+	case dynamic.Enum:
+		return fmt.Sprintf("%s (%d)", v.Name, v.Value)
+	case string:
+		if len(v) > 32 {
+			return fmt.Sprintf("%q...", v[:32])
+		}
+		return fmt.Sprintf("%q", v)
+	case []byte:
+		return fmt.Sprintf("%d bytes", len(v))
+	}
+
+	switch r.Kind {
+	case dynamic.RegionLength:
+		if strings.HasPrefix(r.Type, "opaque") || strings.HasPrefix(r.Type, "string") {
+			return fmt.Sprintf("%v bytes", r.Value)
+		}
+		return fmt.Sprintf("%v elements", r.Value)
+	case dynamic.RegionFlag:
+		if r.Value == true {
+			return "present"
+		}
+		return "absent"
+	}
+	return fmt.Sprint(r.Value)
+}
+
+func main() {
+	log.SetPrefix("xdrexplain: ")
+	log.SetFlags(0)
+
+	var (
+		config   parser.Config
+		defines  []string
+		schema   string
+		typeName string
+		verbose  bool
+		limits   dynamic.Limits
+	)
+	specfile.ParserFlags(pflag.CommandLine, &config, &defines)
+	pflag.StringVarP(&schema, "schema", "s", "", "Specification (.x or .xb) defining the type of the data")
+	pflag.StringVarP(&typeName, "type", "t", "", "Type of the data")
+	pflag.BoolVarP(&verbose, "verbose", "v", false, "Print every row of long strings and opaque data")
+	pflag.Uint32Var(&limits.MaxLength, "max-length", dynamic.DefaultMaxLength, "Maximum length of arrays, strings and opaque data")
+	pflag.IntVar(&limits.MaxDepth, "max-depth", dynamic.DefaultMaxDepth, "Maximum nesting of values")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: xdrexplain -s spec.x -t type [flags] [file]\n")
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+	specfile.SetDefines(&config, defines)
+
+	if schema == "" || typeName == "" || pflag.NArg() > 1 {
+		pflag.Usage()
+		os.Exit(2)
+	}
+
+	spec, err := specfile.Load(&config, schema)
+	if err != nil {
+		specfile.PrintError(err)
+		os.Exit(2)
+	}
+
+	codec, err := dynamic.New(spec, typeName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	codec.Limits = limits
+
+	in := io.Reader(os.Stdin)
+	if pflag.NArg() == 1 {
+		f, err := os.Open(pflag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	// The data is read in full so that the bytes which fail to decode can be
+	// printed, even though they have been consumed by the decoder
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	e := &explainer{verbose: verbose}
+	dec := codec.NewDecoder(bytes.NewReader(data))
+	dec.Trace = e.region
+	for n := 1; ; n++ {
+		e.start, e.end = dec.Offset(), dec.Offset()
+		_, err := dec.Decode()
+		if err == io.EOF {
+			return
+		}
+
+		// Concatenated values are separated by blank lines
+		if n > 1 {
+			fmt.Fprintln(out)
+		}
+		if err != nil {
+			if derr, ok := err.(*dynamic.Error); ok {
+				e.fail(data, derr)
+			}
+			e.print(out)
+			out.Flush()
+			log.Fatalf("Value %d: %s", n, err)
+		}
+		e.print(out)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"go.e43.eu/xdr"
+	"go.e43.eu/xdrgen/ast"
+	"go.e43.eu/xdrgen/internal/genutils"
+	"go.e43.eu/xdrgen/internal/genx"
+)
+
+func main() {
+	log.SetPrefix("xdrgen-x: ")
+	log.SetFlags(0)
+
+	f := genutils.ParseFlags(os.Args)
+
+	var spec ast.Specification
+	if err := xdr.Read(os.Stdin, &spec); err != nil {
+		log.Fatalf("Error reading: %s\n", err)
+	}
+
+	buf, err := genx.GenSpecification(&spec)
+	if err != nil {
+		log.Fatalf("Error generating: %s\n", err)
+	}
+
+	// Don't overwrite the specification we were generated from
+	fname := f.OutputBasename + ".x"
+	if fname == f.InputFilename {
+		fname = f.OutputBasename + ".gen.x"
+	}
+
+	of, err := os.Create(fname)
+	if err != nil {
+		log.Fatalf("Error opening output file: %s", err)
+	}
+	defer of.Close()
+
+	if _, err = of.Write(buf); err != nil {
+		log.Fatalf("Error writing output file: %s", err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+	"go.e43.eu/xdrgen/internal/compat"
+	"go.e43.eu/xdrgen/internal/specfile"
+	"go.e43.eu/xdrgen/parser"
+)
+
+// compatMain implements the compat subcommand, which reports the changes
+// between two versions of a specification. It returns 1 if any of the
+// changes are breaking (and not allowed), or 2 if the specifications can't
+// be read
+func compatMain(args []string) int {
+	var (
+		config    parser.Config
+		defines   []string
+		allowFile string
+		quiet     bool
+	)
+
+	flags := pflag.NewFlagSet("xdrgen compat", pflag.ExitOnError)
+	specfile.ParserFlags(flags, &config, &defines)
+	flags.StringVarP(&allowFile, "allow", "a", "", "File listing the paths of breaking changes which are allowed")
+	flags.BoolVarP(&quiet, "quiet", "q", false, "Only report breaking changes")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: xdrgen compat [flags] old.x new.x\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	specfile.SetDefines(&config, defines)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	var allow compat.Allowlist
+	if allowFile != "" {
+		f, err := os.Open(allowFile)
+		if err != nil {
+			specfile.PrintError(err)
+			return 2
+		}
+		allow, err = compat.ReadAllowlist(f)
+		f.Close()
+		if err != nil {
+			specfile.PrintError(fmt.Errorf("%s: %w", allowFile, err))
+			return 2
+		}
+	}
+
+	old, err := specfile.Load(&config, flags.Arg(0))
+	if err != nil {
+		specfile.PrintError(err)
+		return 2
+	}
+	new, err := specfile.Load(&config, flags.Arg(1))
+	if err != nil {
+		specfile.PrintError(err)
+		return 2
+	}
+
+	status := 0
+	for _, c := range compat.Compare(old, new) {
+		switch {
+		case c.Breaking && allow.Allows(c):
+			if !quiet {
+				fmt.Printf("%s (allowed)\n", c)
+			}
+		case c.Breaking:
+			fmt.Println(c)
+			status = 1
+		case !quiet:
+			fmt.Println(c)
+		}
+	}
+	return status
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The number of unchanged lines shown around each change
+const diffContext = 3
+
+// unifiedDiff returns the differences between two versions of a file, in
+// unified diff format
+func unifiedDiff(fname string, a, b []byte) string {
+	x, y := splitLines(string(a)), splitLines(string(b))
+	ops := diffLines(x, y)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s.orig\n+++ %s\n", fname, fname)
+
+	for start := 0; start < len(ops); {
+		// Find the next change, and the extent of the hunk around it
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		end, unchanged := start, 0
+		for i := start; i < len(ops) && unchanged <= 2*diffContext; i++ {
+			if ops[i].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+				end = i + 1
+			}
+		}
+
+		lo, hi := start-diffContext, end+diffContext
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(ops) {
+			hi = len(ops)
+		}
+
+		ax, ay := ops[lo].x, ops[lo].y
+		var nx, ny int
+		for _, op := range ops[lo:hi] {
+			if op.kind != '+' {
+				nx++
+			}
+			if op.kind != '-' {
+				ny++
+			}
+		}
+
+		// Empty ranges are given by the line preceding them
+		if nx > 0 {
+			ax++
+		}
+		if ny > 0 {
+			ay++
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", ax, nx, ay, ny)
+		for _, op := range ops[lo:hi] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			sb.WriteByte('\n')
+		}
+		start = hi
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\n")
+	}
+	return lines
+}
+
+// diffOp is a line of an edit script: ' ' for a line common to both files,
+// '-' for one only in the first, or '+' for one only in the second. x and y
+// are the indices of the line in each file (or of the next line, if it
+// isn't in that file)
+type diffOp struct {
+	kind byte
+	line string
+	x, y int
+}
+
+// diffLines computes a shortest edit script transforming x into y, using
+// the linear space variant of Myers' algorithm
+func diffLines(x, y []string) []diffOp {
+	d := &differ{x: x, y: y}
+	d.compare(0, len(x), 0, len(y))
+
+	// Show the lines removed by each run of changes before those added
+	ops := d.ops
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		j := i
+		var removed, added []diffOp
+		for ; j < len(ops) && ops[j].kind != ' '; j++ {
+			if ops[j].kind == '-' {
+				removed = append(removed, ops[j])
+			} else {
+				added = append(added, ops[j])
+			}
+		}
+
+		x0, y0 := ops[i].x, ops[i].y
+		for k, op := range removed {
+			ops[i+k] = diffOp{'-', op.line, op.x, y0}
+		}
+		for k, op := range added {
+			ops[i+len(removed)+k] = diffOp{'+', op.line, x0 + len(removed), op.y}
+		}
+		i = j
+	}
+	return ops
+}
+
+// differ accumulates the edit script transforming x into y
+type differ struct {
+	x, y []string
+	ops  []diffOp
+}
+
+// compare appends the edits transforming x[x0:x1] into y[y0:y1]
+func (d *differ) compare(x0, x1, y0, y1 int) {
+	for x0 < x1 && y0 < y1 && d.x[x0] == d.y[y0] {
+		d.ops = append(d.ops, diffOp{' ', d.x[x0], x0, y0})
+		x0, y0 = x0+1, y0+1
+	}
+	common := 0
+	for x1-common > x0 && y1-common > y0 && d.x[x1-common-1] == d.y[y1-common-1] {
+		common++
+	}
+	x1, y1 = x1-common, y1-common
+
+	xm, ym, ok := 0, 0, false
+	if x0 < x1 && y0 < y1 {
+		xm, ym, ok = d.middle(x0, x1, y0, y1)
+	}
+	if ok {
+		d.compare(x0, xm, y0, ym)
+		d.compare(xm, x1, ym, y1)
+	} else {
+		for i := x0; i < x1; i++ {
+			d.ops = append(d.ops, diffOp{'-', d.x[i], i, y0})
+		}
+		for j := y0; j < y1; j++ {
+			d.ops = append(d.ops, diffOp{'+', d.y[j], x1, j})
+		}
+	}
+
+	for i := 0; i < common; i++ {
+		d.ops = append(d.ops, diffOp{' ', d.x[x1+i], x1 + i, y1 + i})
+	}
+}
+
+// middle finds a point on a shortest edit script transforming x[x0:x1] into
+// y[y0:y1], about halfway along it, by searching forwards from the start and
+// backwards from the end at once until the searches meet. It returns false
+// if the ranges have no lines in common
+func (d *differ) middle(x0, x1, y0, y1 int) (int, int, bool) {
+	n, m := x1-x0, y1-y0
+	max := (n + m + 1) / 2
+	delta := n - m
+	odd := delta%2 != 0
+
+	// vf and vb hold the furthest x reached on each diagonal k = x - y (offset
+	// by max) by the forward search, and by the backward search in reversed
+	// coordinates, or -1 if the diagonal has not been reached. Diagonals
+	// which leave the ranges are trimmed from the search
+	vf, vb := make([]int, 2*max+2), make([]int, 2*max+2)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[max+1], vb[max+1] = 0, 0
+	var fstart, fend, bstart, bend int
+
+	for e := 0; e < max; e++ {
+		for k := -e + fstart; k <= e-fend; k += 2 {
+			var x int
+			if k == -e || (k != e && vf[max+k-1] < vf[max+k+1]) {
+				x = vf[max+k+1]
+			} else {
+				x = vf[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.x[x0+x] == d.y[y0+y] {
+				x, y = x+1, y+1
+			}
+			vf[max+k] = x
+
+			switch {
+			case x > n:
+				fend += 2
+			case y > m:
+				fstart += 2
+			case odd:
+				// The backward search has taken one step fewer
+				if kb := max + delta - k; kb >= 0 && kb < len(vb) && vb[kb] != -1 && x >= n-vb[kb] {
+					return x0 + x, y0 + y, true
+				}
+			}
+		}
+
+		for k := -e + bstart; k <= e-bend; k += 2 {
+			var x int
+			if k == -e || (k != e && vb[max+k-1] < vb[max+k+1]) {
+				x = vb[max+k+1]
+			} else {
+				x = vb[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.x[x1-x-1] == d.y[y1-y-1] {
+				x, y = x+1, y+1
+			}
+			vb[max+k] = x
+
+			switch {
+			case x > n:
+				bend += 2
+			case y > m:
+				bstart += 2
+			case !odd:
+				if kf := max + delta - k; kf >= 0 && kf < len(vf) && vf[kf] != -1 && vf[kf] >= n-x {
+					return x0 + vf[kf], y0 + vf[kf] - (delta - k), true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/spf13/pflag"
+	"go.e43.eu/xdrgen/internal/format"
+	"go.e43.eu/xdrgen/internal/specfile"
+)
+
+// fmtMain implements the fmt subcommand, which formats specifications in
+// the manner of gofmt. It returns the exit status
+func fmtMain(args []string) int {
+	var list, diff, write bool
+
+	flags := pflag.NewFlagSet("xdrgen fmt", pflag.ExitOnError)
+	flags.BoolVarP(&list, "list", "l", false, "List files whose formatting differs from xdrgen fmt's")
+	flags.BoolVarP(&diff, "diff", "d", false, "Display diffs instead of rewriting files")
+	flags.BoolVarP(&write, "write", "w", false, "Write the result to the source file instead of standard output")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: xdrgen fmt [flags] [files...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if write {
+			log.Print("Cannot use -w with standard input")
+			return 2
+		}
+
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err == nil {
+			err = formatFile("<standard input>", src, list, diff, false)
+		}
+		if err != nil {
+			specfile.PrintError(err)
+			return 1
+		}
+		return 0
+	}
+
+	status := 0
+	for _, fname := range flags.Args() {
+		src, err := ioutil.ReadFile(fname)
+		if err == nil {
+			err = formatFile(fname, src, list, diff, write)
+		}
+		if err != nil {
+			specfile.PrintError(err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func formatFile(fname string, src []byte, list, diff, write bool) error {
+	res, err := format.Source(src, fname)
+	if err != nil {
+		return err
+	}
+
+	changed := !bytes.Equal(src, res)
+	if list && changed {
+		fmt.Println(fname)
+	}
+	if diff && changed {
+		fmt.Print(unifiedDiff(fname, src, res))
+	}
+	if write && changed {
+		fi, err := os.Stat(fname)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fname, res, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if !list && !diff && !write {
+		_, err = os.Stdout.Write(res)
+	}
+	return err
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -15,19 +14,33 @@ import (
 
 	"github.com/spf13/pflag"
 	"go.e43.eu/xdr"
-	"go.e43.eu/xdrgen/ast"
+	"go.e43.eu/xdrgen/diag"
 	"go.e43.eu/xdrgen/internal/genutils"
+	"go.e43.eu/xdrgen/internal/specfile"
 	"go.e43.eu/xdrgen/parser"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			os.Exit(fmtMain(os.Args[2:]))
+		case "compat":
+			os.Exit(compatMain(os.Args[2:]))
+		}
+	}
+
 	var (
 		outDir            string
 		enabledGenerators []string
+		config            parser.Config
+		defines           []string
 	)
 	pflag.StringVarP(&outDir, "output", "O", "", "Output directory (Defaults to same directory as source)")
 	pflag.StringSliceVarP(&enabledGenerators, "generators", "G", nil, "Generators to invoke")
+	specfile.ParserFlags(pflag.CommandLine, &config, &defines)
 	pflag.Parse()
+	specfile.SetDefines(&config, defines)
 
 	if len(pflag.Args()) == 0 {
 		pflag.Usage()
@@ -49,7 +62,7 @@ func main() {
 
 	wg.Add(1)
 	parseCh := make(chan parseResult, 5)
-	parseFiles(&wg, parseCh, errorChan, pflag.Args())
+	go parseFiles(&wg, parseCh, errorChan, &config, pflag.Args())
 
 	genChans := make([]chan generatorRequest, len(enabledGenerators))
 	wg.Add(len(enabledGenerators))
@@ -80,49 +93,40 @@ func parseFiles(
 	wg *sync.WaitGroup,
 	results chan<- parseResult,
 	errors chan<- error,
+	config *parser.Config,
 	names []string,
 ) {
 	defer wg.Done()
 	defer close(results)
 
+	// Parse and validate every file before we invoke any generators, so that
+	// we never generate output for a partially valid set of inputs
+	var parsed []parseResult
+	failed := false
 	for _, fname := range names {
-		result, err := parseFile(fname)
+		result, err := parseFile(config, fname)
 
 		if err != nil {
 			errors <- err
-			return
+			failed = true
 		} else {
-			results <- result
+			parsed = append(parsed, result)
 		}
 	}
-}
 
-func parseFile(fname string) (parseResult, error) {
-	inFile, err := os.Open(fname)
-	if err != nil {
-		return parseResult{}, fmt.Errorf("Error opening '%s': %w", fname, err)
+	if failed {
+		return
 	}
-	defer inFile.Close()
 
-	rdr := bufio.NewReader(inFile)
-	peeked, _ := rdr.Peek(8)
-	isBin := false
-	if len(peeked) == 8 {
-		isBin = bytes.Equal(peeked, []byte(ast.XDR_BIN_MAGIC_BYTES))
+	for _, result := range parsed {
+		results <- result
 	}
+}
 
-	var spec *ast.Specification
-	if !isBin {
-		specx, err := parser.ParseSpecification(rdr, fname)
-		if err != nil {
-			return parseResult{}, fmt.Errorf("Error parsing '%s': %w", fname, err)
-		}
-		spec = specx
-	} else {
-		err := xdr.Read(rdr, &spec)
-		if err != nil {
-			return parseResult{}, fmt.Errorf("Error reading '%s': %w", fname, err)
-		}
+func parseFile(config *parser.Config, fname string) (parseResult, error) {
+	spec, err := specfile.Load(config, fname)
+	if err != nil {
+		return parseResult{}, err
 	}
 
 	specBuf, err := xdr.Marshal(spec)
@@ -212,7 +216,11 @@ func generatorWorker(
 func errorWorker(wg *sync.WaitGroup, errorCount *int, errors <-chan error) {
 	defer wg.Done()
 	for err := range errors {
-		log.Print(err)
+		if diags, ok := err.(diag.List); ok {
+			diags.Print(os.Stderr)
+		} else {
+			log.Print(err)
+		}
 		*errorCount += 1
 	}
 }
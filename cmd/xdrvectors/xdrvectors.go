@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/pflag"
+	"go.e43.eu/xdrgen/dynamic"
+	"go.e43.eu/xdrgen/internal/specfile"
+	"go.e43.eu/xdrgen/parser"
+)
+
+// maxEvery is the most values which are generated in the every mode, in
+// case choices keep being reached which haven't been made
+const maxEvery = 1 << 12
+
+var modes = map[string][]dynamic.Mode{
+	"random": {dynamic.Random},
+	"empty":  {dynamic.Empty},
+	"full":   {dynamic.Full},
+	"every":  {dynamic.Every},
+	"edge":   {dynamic.Empty, dynamic.Full, dynamic.Every},
+}
+
+func main() {
+	log.SetPrefix("xdrvectors: ")
+	log.SetFlags(0)
+
+	var (
+		config    parser.Config
+		defines   []string
+		schema    string
+		typeName  string
+		mode      string
+		count     int
+		seed      int64
+		outDir    string
+		prefix    string
+		base64    bool
+		maxLength uint32
+		maxDepth  int
+		maxValues int
+	)
+	specfile.ParserFlags(pflag.CommandLine, &config, &defines)
+	pflag.StringVarP(&schema, "schema", "s", "", "Specification (.x or .xb) defining the type of the values")
+	pflag.StringVarP(&typeName, "type", "t", "", "Type of the values")
+	pflag.StringVarP(&mode, "mode", "m", "random", "Values to generate: random, empty, full, every (enum value and union arm) or edge (all of empty, full and every)")
+	pflag.IntVarP(&count, "count", "n", 10, "Number of random values to generate")
+	pflag.Int64Var(&seed, "seed", 1, "Seed of the values generated")
+	pflag.StringVarP(&outDir, "output", "o", ".", "Directory to write the vectors to")
+	pflag.StringVar(&prefix, "prefix", "", "Prefix of the names of the vector files (Defaults to the type)")
+	pflag.BoolVar(&base64, "base64", false, "Write opaque data as base64, rather than hex")
+	pflag.Uint32Var(&maxLength, "max-length", 16, "Maximum length of unbounded arrays, strings and opaque data")
+	pflag.IntVar(&maxDepth, "max-depth", 16, "Maximum nesting of values")
+	pflag.IntVar(&maxValues, "max-values", 4096, "Maximum number of array elements and optional values in each value")
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: xdrvectors -s spec.x -t type [flags]\n")
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+	specfile.SetDefines(&config, defines)
+
+	genModes, ok := modes[mode]
+	if schema == "" || typeName == "" || !ok || pflag.NArg() > 0 {
+		pflag.Usage()
+		os.Exit(2)
+	}
+	if prefix == "" {
+		prefix = typeName
+	}
+
+	spec, err := specfile.Load(&config, schema)
+	if err != nil {
+		specfile.PrintError(err)
+		os.Exit(2)
+	}
+
+	codec, err := dynamic.New(spec, typeName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := dynamic.JSONOptions{Indent: "  "}
+	if base64 {
+		opts.Opaque = dynamic.OpaqueBase64
+	}
+
+	if err := os.MkdirAll(outDir, 0777); err != nil {
+		log.Fatal(err)
+	}
+
+	// Each vector is written as prefix-NNN.bin, containing the value encoded
+	// as XDR, and prefix-NNN.json
+	n := 0
+	write := func(v interface{}) {
+		b, err := codec.Marshal(v)
+		if err != nil {
+			log.Fatalf("Generated an invalid value: %s", err)
+		}
+		js, err := codec.ToJSON(v, opts)
+		if err != nil {
+			log.Fatalf("Generated an invalid value: %s", err)
+		}
+
+		name := filepath.Join(outDir, fmt.Sprintf("%s-%03d", prefix, n))
+		if err := ioutil.WriteFile(name+".bin", b, 0666); err != nil {
+			log.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name+".json", append(js, '\n'), 0666); err != nil {
+			log.Fatal(err)
+		}
+		n++
+	}
+
+	for _, m := range genModes {
+		gen := codec.NewGenerator(seed)
+		gen.Mode = m
+		gen.MaxLength = maxLength
+		gen.MaxDepth = maxDepth
+		gen.MaxValues = maxValues
+
+		generate := func() {
+			v, err := gen.Generate()
+			if err != nil {
+				log.Fatal(err)
+			}
+			write(v)
+		}
+
+		switch m {
+		case dynamic.Random:
+			for i := 0; i < count; i++ {
+				generate()
+			}
+		case dynamic.Every:
+			generate()
+			for i := 1; !gen.Done(); i++ {
+				if i == maxEvery {
+					log.Fatalf("Not every enum value and union arm was chosen in %d values", maxEvery)
+				}
+				generate()
+			}
+		default:
+			generate()
+		}
+	}
+}
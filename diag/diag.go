@@ -0,0 +1,149 @@
+// Package diag defines the diagnostics which are reported while processing
+// XDR specifications
+package diag
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/scanner"
+)
+
+// Severity is the severity of a diagnostic
+type Severity int
+
+const (
+	// Error diagnostics prevent a specification from being processed
+	Error Severity = iota
+	// Warning diagnostics indicate probable mistakes which do not prevent
+	// processing
+	Warning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Diagnostic is a message about a position in a source file
+type Diagnostic struct {
+	Pos      scanner.Position
+	Severity Severity
+	Message  string
+}
+
+// Error formats the diagnostic in the conventional compiler format,
+// i.e. "file:line:column: severity: message"
+func (d *Diagnostic) Error() string {
+	if d.Pos.Filename == "" && !d.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Message)
+}
+
+// Errorf constructs an error diagnostic
+func Errorf(pos scanner.Position, fmts string, params ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Pos:      pos,
+		Severity: Error,
+		Message:  fmt.Sprintf(fmts, params...),
+	}
+}
+
+// Warnf constructs a warning diagnostic
+func Warnf(pos scanner.Position, fmts string, params ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Pos:      pos,
+		Severity: Warning,
+		Message:  fmt.Sprintf(fmts, params...),
+	}
+}
+
+// List is a list of diagnostics. It satisfies error, so that functions
+// which may report multiple errors can return it
+type List []*Diagnostic
+
+// Add appends a diagnostic to the list
+func (l *List) Add(d *Diagnostic) {
+	*l = append(*l, d)
+}
+
+// AddError appends err to the list. If err is a diagnostic or list of
+// diagnostics, they are added as is; any other error is converted into
+// an error diagnostic at the specified position
+func (l *List) AddError(pos scanner.Position, err error) {
+	switch e := err.(type) {
+	case *Diagnostic:
+		l.Add(e)
+	case List:
+		*l = append(*l, e...)
+	default:
+		l.Add(Errorf(pos, "%s", err))
+	}
+}
+
+// Sort sorts the list by position. Files are ordered by their first
+// appearance in the list
+func (l List) Sort() {
+	files := make(map[string]int)
+	for i, d := range l {
+		if _, ok := files[d.Pos.Filename]; !ok {
+			files[d.Pos.Filename] = i
+		}
+	}
+
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i].Pos, l[j].Pos
+		if a.Filename != b.Filename {
+			return files[a.Filename] < files[b.Filename]
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// HasErrors returns if the list contains any diagnostics of Error severity
+func (l List) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the list as an error if it contains any errors, or nil otherwise
+func (l List) Err() error {
+	if l.HasErrors() {
+		return l
+	}
+	return nil
+}
+
+// Error returns the diagnostics, one per line
+func (l List) Error() string {
+	msgs := make([]string, len(l))
+	for i, d := range l {
+		msgs[i] = d.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Print writes the diagnostics to w, one per line
+func (l List) Print(w io.Writer) error {
+	for _, d := range l {
+		if _, err := fmt.Fprintln(w, d.Error()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
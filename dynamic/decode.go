@@ -0,0 +1,357 @@
+package dynamic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"go.e43.eu/xdrgen/ast"
+)
+
+// Decoder decodes a sequence of values from a stream
+type Decoder struct {
+	// Trace, if set, is called with each region of the data as it is
+	// decoded, in order
+	Trace func(*Region)
+
+	c   *Codec
+	r   io.Reader
+	off int64
+	buf [8]byte
+
+	// discriminant is set while the discriminant of a union is decoded, so
+	// that it is traced as a RegionDiscriminant
+	discriminant bool
+}
+
+// NewDecoder returns a decoder reading values of the codec's type from r
+func (c *Codec) NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{c: c, r: r}
+}
+
+// Offset returns the number of bytes which have been read
+func (d *Decoder) Offset() int64 {
+	return d.off
+}
+
+// Decode decodes the next value. It returns io.EOF if the stream ends
+// before the value begins; errors decoding the value are returned as an
+// *Error
+func (d *Decoder) Decode() (interface{}, error) {
+	start := d.off
+	v, err := d.typ(d.c.name, d.c.name, d.c.typ, 0)
+	if err, ok := err.(*Error); ok && err.Err == io.EOF && d.off == start {
+		return nil, io.EOF
+	}
+	return v, err
+}
+
+// Unmarshal decodes a value from b, which must contain exactly one value
+func (c *Codec) Unmarshal(b []byte) (interface{}, error) {
+	d := c.NewDecoder(bytes.NewReader(b))
+	v, err := d.Decode()
+	switch {
+	case err == io.EOF:
+		return nil, &Error{Path: c.name, Message: "Unexpected end of data", Err: io.ErrUnexpectedEOF}
+	case err != nil:
+		return nil, err
+	case d.off < int64(len(b)):
+		return nil, &Error{
+			Path:    c.name,
+			Offset:  d.off,
+			Message: fmt.Sprintf("%d bytes follow the value", int64(len(b))-d.off),
+		}
+	}
+	return v, nil
+}
+
+func (d *Decoder) errorf(path string, off int64, fmts string, args ...interface{}) error {
+	return &Error{Path: path, Offset: off, Message: fmt.Sprintf(fmts, args...)}
+}
+
+// read reads len(b) bytes. Errors are reported at the offset of the start of
+// the bytes, rather than where the data ended
+func (d *Decoder) read(path string, b []byte) error {
+	off := d.off
+	n, err := io.ReadFull(d.r, b)
+	d.off += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &Error{Path: path, Offset: off, Message: "Unexpected end of data", Err: err}
+	} else if err != nil {
+		return &Error{Path: path, Offset: off, Message: err.Error(), Err: err}
+	}
+	return nil
+}
+
+func (d *Decoder) uint32(path string) (uint32, error) {
+	if err := d.read(path, d.buf[:4]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(d.buf[:4]), nil
+}
+
+func (d *Decoder) uint64(path string) (uint64, error) {
+	if err := d.read(path, d.buf[:8]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(d.buf[:8]), nil
+}
+
+// opaque reads n bytes of data followed by their padding, which must be zero
+func (d *Decoder) opaque(path, desc string, n uint32, str bool) ([]byte, error) {
+	off := d.off
+	// The data is read in chunks, so that an excessive length in truncated
+	// data doesn't cause an excessive allocation
+	var buf []byte
+	for remaining := n; remaining > 0; {
+		chunk := remaining
+		if chunk > 1<<16 {
+			chunk = 1 << 16
+		}
+		buf = append(buf, make([]byte, chunk)...)
+		if err := d.read(path, buf[n-remaining:n-remaining+chunk]); err != nil {
+			// Report the error at the start of the data, not of the chunk
+			if err, ok := err.(*Error); ok {
+				err.Offset = off
+			}
+			return nil, err
+		}
+		remaining -= chunk
+	}
+	if buf == nil {
+		buf = []byte{}
+	}
+	if n > 0 {
+		var v interface{} = buf
+		if str {
+			v = string(buf)
+		}
+		d.trace(RegionData, off, buf, path, desc, v)
+	}
+
+	if pad := (4 - n%4) % 4; pad > 0 {
+		off := d.off
+		if err := d.read(path, d.buf[:pad]); err != nil {
+			return nil, err
+		}
+		for _, b := range d.buf[:pad] {
+			if b != 0 {
+				return nil, d.errorf(path, off, "Padding is not zero")
+			}
+		}
+		d.trace(RegionPadding, off, d.buf[:pad], path, desc, nil)
+	}
+	return buf, nil
+}
+
+func (d *Decoder) checkDepth(path string, depth int) error {
+	if max := d.c.maxDepth(); depth > max {
+		return d.errorf(path, d.off, "Values are nested more than %d deep", max)
+	}
+	return nil
+}
+
+// typ decodes a value of type t. desc describes the type, as declared, for
+// tracing
+func (d *Decoder) typ(path, desc string, t *ast.Type, depth int) (interface{}, error) {
+	off := d.off
+	switch t.Kind {
+	case ast.TYPE_VOID:
+		return nil, nil
+
+	case ast.TYPE_BOOL:
+		v, err := d.uint32(path)
+		if err != nil {
+			return nil, err
+		} else if v > 1 {
+			return nil, d.errorf(path, off, "%d is not a valid bool", v)
+		}
+		d.trace(RegionValue, off, d.buf[:4], path, desc, v == 1)
+		return v == 1, nil
+
+	case ast.TYPE_INT, ast.TYPE_UNSIGNED_INT, ast.TYPE_FLOAT:
+		v, err := d.uint32(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var rv interface{}
+		switch t.Kind {
+		case ast.TYPE_INT:
+			rv = int32(v)
+		case ast.TYPE_UNSIGNED_INT:
+			rv = v
+		default:
+			rv = math.Float32frombits(v)
+		}
+		d.trace(RegionValue, off, d.buf[:4], path, desc, rv)
+		return rv, nil
+
+	case ast.TYPE_HYPER, ast.TYPE_UNSIGNED_HYPER, ast.TYPE_DOUBLE:
+		v, err := d.uint64(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var rv interface{}
+		switch t.Kind {
+		case ast.TYPE_HYPER:
+			rv = int64(v)
+		case ast.TYPE_UNSIGNED_HYPER:
+			rv = v
+		default:
+			rv = math.Float64frombits(v)
+		}
+		d.trace(RegionValue, off, d.buf[:8], path, desc, rv)
+		return rv, nil
+
+	case ast.TYPE_ENUM:
+		v, err := d.uint32(path)
+		if err != nil {
+			return nil, err
+		}
+
+		name := t.EnumSpec.GetName(d.c.spec, int32(v))
+		if name == "" {
+			return nil, d.errorf(path, off, "%d is not a value of the enum", int32(v))
+		}
+		e := Enum{Name: name, Value: int32(v)}
+		d.trace(RegionValue, off, d.buf[:4], path, desc, e)
+		return e, nil
+
+	case ast.TYPE_STRUCT:
+		if err := d.checkDepth(path, depth); err != nil {
+			return nil, err
+		}
+
+		s := make(map[string]interface{}, len(t.StructSpec.Members))
+		for _, m := range t.StructSpec.Members {
+			v, err := d.decl(joinPath(path, m.Name), m, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			s[m.Name] = v
+		}
+		return s, nil
+
+	case ast.TYPE_UNION:
+		if err := d.checkDepth(path, depth); err != nil {
+			return nil, err
+		}
+		return d.union(path, t.UnionSpec, depth)
+
+	case ast.TYPE_TYPEDEF:
+		return d.decl(path, t.TypeDef, depth)
+
+	case ast.TYPE_REF:
+		rt, err := resolve(d.c.spec, t)
+		if err != nil {
+			return nil, d.errorf(path, off, "%s", err)
+		}
+		return d.typ(path, desc, rt, depth)
+	}
+	return nil, d.errorf(path, off, "A %s must be declared as an array", t.Kind)
+}
+
+func (d *Decoder) union(path string, u *ast.UnionSpec, depth int) (interface{}, error) {
+	off := d.off
+	d.discriminant = true
+	disc, err := d.decl(joinPath(path, u.Discriminant.Name), u.Discriminant, depth+1)
+	d.discriminant = false
+	if err != nil {
+		return nil, err
+	}
+
+	dv, ok := discriminantValue(disc)
+	if !ok {
+		return nil, d.errorf(path, off, "The discriminant of a union can't be a %T", disc)
+	}
+
+	m, ok := arm(u, dv)
+	if !ok {
+		return nil, d.errorf(path, off, "No arm is selected by the discriminant %v", disc)
+	} else if m.IsVoid() {
+		return &Union{Discriminant: disc}, nil
+	}
+
+	v, err := d.decl(joinPath(path, m.Name), m, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	return &Union{Discriminant: disc, Arm: m.Name, Value: v}, nil
+}
+
+func (d *Decoder) decl(path string, decl *ast.Declaration, depth int) (interface{}, error) {
+	off := d.off
+	mod := decl.Modifier
+	var n uint32
+	switch mod.Kind {
+	case ast.DECLARATION_MODIFIER_NONE:
+		return d.typ(path, d.describeDecl(decl), decl.Type, depth)
+
+	case ast.DECLARATION_MODIFIER_OPTIONAL:
+		present, err := d.uint32(path)
+		switch {
+		case err != nil:
+			return nil, err
+		case present > 1:
+			return nil, d.errorf(path, off, "%d is not a valid optional value flag", present)
+		}
+		d.trace(RegionFlag, off, d.buf[:4], path, d.describeDecl(decl), present == 1)
+		if present == 0 {
+			return nil, nil
+		}
+
+		if err := d.checkDepth(path, depth); err != nil {
+			return nil, err
+		}
+		return d.typ(path, d.describe(decl.Type), decl.Type, depth+1)
+
+	case ast.DECLARATION_MODIFIER_FIXED:
+		n = mod.Size
+
+	case ast.DECLARATION_MODIFIER_FLEXIBLE, ast.DECLARATION_MODIFIER_UNBOUNDED:
+		var err error
+		if n, err = d.uint32(path); err != nil {
+			return nil, err
+		}
+
+		if mod.Kind == ast.DECLARATION_MODIFIER_FLEXIBLE && n > mod.Size {
+			return nil, d.errorf(path, off, "Length %d exceeds the maximum of %d", n, mod.Size)
+		} else if max := d.c.maxLength(); n > max {
+			return nil, d.errorf(path, off, "Length %d exceeds the limit of %d", n, max)
+		}
+		d.trace(RegionLength, off, d.buf[:4], path, d.describeDecl(decl), n)
+
+	default:
+		return nil, d.errorf(path, off, "Unknown declaration modifier %s", mod.Kind)
+	}
+
+	switch decl.Type.Kind {
+	case ast.TYPE_OPAQUE:
+		return d.opaque(path, d.describeDecl(decl), n, false)
+	case ast.TYPE_STRING:
+		b, err := d.opaque(path, d.describeDecl(decl), n, true)
+		return string(b), err
+	}
+
+	if err := d.checkDepth(path, depth); err != nil {
+		return nil, err
+	}
+
+	var arr []interface{}
+	desc := d.describe(decl.Type)
+	for i := uint32(0); i < n; i++ {
+		v, err := d.typ(indexPath(path, int(i)), desc, decl.Type, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	if arr == nil {
+		arr = []interface{}{}
+	}
+	return arr, nil
+}
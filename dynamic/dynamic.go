@@ -0,0 +1,199 @@
+// Package dynamic encodes and decodes XDR values at runtime, as described by
+// a specification, for use where there is no generated code for a type.
+//
+// Values are represented generically:
+//
+//	bool                      bool
+//	int, unsigned int         int32, uint32
+//	hyper, unsigned hyper     int64, uint64
+//	float, double             float32, float64
+//	string                    string
+//	opaque                    []byte
+//	enum                      Enum
+//	struct                    map[string]interface{}, keyed by member name
+//	union                     *Union
+//	optional (*)              nil, or the value
+//	arrays ([N], <N>)         []interface{}
+//
+// Typedefs and references are transparent: a value of a typedef is a value
+// of the type it names
+package dynamic
+
+import (
+	"fmt"
+
+	"go.e43.eu/xdrgen/ast"
+)
+
+// Enum is a value of an enum. Name is "" if the value is not one of the
+// enum's (which is an error when encoding or decoding)
+type Enum struct {
+	Name  string
+	Value int32
+}
+
+func (e Enum) String() string {
+	if e.Name == "" {
+		return fmt.Sprint(e.Value)
+	}
+	return e.Name
+}
+
+// Union is a value of a union
+type Union struct {
+	// Discriminant is the value of the discriminant: an int32, uint32, bool
+	// or Enum
+	Discriminant interface{}
+	// Arm is the name of the member selected by the discriminant, or "" if
+	// it is void
+	Arm string
+	// Value is the value of the arm, or nil if it is void
+	Value interface{}
+}
+
+const (
+	// DefaultMaxLength is the default limit on the lengths of variable
+	// length arrays, strings and opaque data
+	DefaultMaxLength = 1 << 24
+	// DefaultMaxDepth is the default limit on the nesting of values
+	DefaultMaxDepth = 256
+)
+
+// Limits restricts the values which are decoded, so that malformed or
+// malicious data can't exhaust resources. Limits of 0 select the defaults
+type Limits struct {
+	// MaxLength is the maximum length of variable length arrays, strings and
+	// opaque data, in addition to the bound of their declaration
+	MaxLength uint32
+	// MaxDepth is the maximum nesting of structs, unions, arrays and
+	// optional values
+	MaxDepth int
+}
+
+func (l Limits) maxLength() uint32 {
+	if l.MaxLength == 0 {
+		return DefaultMaxLength
+	}
+	return l.MaxLength
+}
+
+func (l Limits) maxDepth() int {
+	if l.MaxDepth == 0 {
+		return DefaultMaxDepth
+	}
+	return l.MaxDepth
+}
+
+// Codec encodes and decodes values of a type of a specification
+type Codec struct {
+	Limits
+
+	spec *ast.Specification
+	name string
+	typ  *ast.Type
+}
+
+// New returns a codec for the type named name, which is defined by the
+// specification s. The specification should have been validated
+func New(s *ast.Specification, name string) (*Codec, error) {
+	t, err := s.GetType(name)
+	if err != nil {
+		return nil, fmt.Errorf("'%s': %w", name, err)
+	}
+	if t == nil {
+		return nil, fmt.Errorf("Type '%s' is referenced but never defined", name)
+	}
+
+	return &Codec{spec: s, name: name, typ: t}, nil
+}
+
+// Spec returns the specification defining the type of the codec
+func (c *Codec) Spec() *ast.Specification { return c.spec }
+
+// Name returns the name of the type of the codec
+func (c *Codec) Name() string { return c.name }
+
+// Error is an error encoding or decoding a value
+type Error struct {
+	// Path locates the value which couldn't be encoded or decoded, such as
+	// "READ3res.resok.data". Array elements are identified by their index
+	// in brackets
+	Path string
+	// Offset is the offset of the data in the encoding of the value, or -1
+	// if the error does not concern the encoding
+	Offset int64
+	// Message describes the problem
+	Message string
+	// Err is the underlying error, if any
+	Err error
+}
+
+func (err *Error) Error() string {
+	if err.Offset < 0 {
+		return fmt.Sprintf("%s: %s", err.Path, err.Message)
+	}
+	return fmt.Sprintf("%s (at offset %d): %s", err.Path, err.Offset, err.Message)
+}
+
+// Unwrap returns the underlying error, if any
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// resolve follows references, returning the type which a reference names
+func resolve(s *ast.Specification, t *ast.Type) (*ast.Type, error) {
+	for i := 0; i <= len(s.Definitions) && t.Kind == ast.TYPE_REF; i++ {
+		d, rt, err := t.FollowRef(s)
+		switch {
+		case err != nil:
+			return nil, err
+		case rt == nil:
+			return nil, fmt.Errorf("Type '%s' is referenced but never defined", d.Name)
+		}
+		t = rt
+	}
+	if t.Kind == ast.TYPE_REF {
+		return nil, fmt.Errorf("Reference cycle")
+	}
+	return t, nil
+}
+
+// discriminantValue returns the value of the discriminant of a union which
+// selects its arm
+func discriminantValue(v interface{}) (int32, bool) {
+	switch v := v.(type) {
+	case int32:
+		return v, true
+	case uint32:
+		return int32(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case Enum:
+		return v.Value, true
+	}
+	return 0, false
+}
+
+// arm returns the member of a union selected by the discriminant value v
+func arm(u *ast.UnionSpec, v int32) (*ast.Declaration, bool) {
+	if m, ok := u.Options[v]; ok {
+		return u.Members[m], true
+	} else if u.DefaultMember != nil {
+		return u.Members[*u.DefaultMember], true
+	}
+	return nil, false
+}
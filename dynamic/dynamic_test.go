@@ -0,0 +1,309 @@
+package dynamic
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.e43.eu/xdrgen/ast"
+	"go.e43.eu/xdrgen/parser"
+)
+
+const testSpec = `
+enum colour { RED = 1, GREEN = 2, BLUE = -1 };
+
+typedef int single;
+typedef int *optional;
+typedef int fixed[2];
+typedef int bounded<2>;
+typedef int unbounded<>;
+typedef opaque fixed_opaque[3];
+typedef opaque bounded_opaque<5>;
+typedef opaque unbounded_opaque<>;
+typedef string bounded_string<5>;
+typedef string unbounded_string<>;
+
+struct scalars {
+	bool b;
+	int i;
+	unsigned int u;
+	hyper h;
+	unsigned hyper uh;
+	float f;
+	double d;
+	colour c;
+};
+
+union result switch (colour c) {
+case RED:
+	int value;
+case GREEN:
+	void;
+default:
+	string message<>;
+};
+
+union flag switch (bool set) {
+case 1:
+	unsigned int value;
+case 0:
+	void;
+};
+
+struct list {
+	int value;
+	list *next;
+};
+
+typedef list lists<>;
+`
+
+func parseSpec(t testing.TB, src string) *ast.Specification {
+	s, err := parser.ParseSpecification(strings.NewReader(src), "test.x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newCodec(t testing.TB, s *ast.Specification, name string) *Codec {
+	c, err := New(s, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func unhex(t testing.TB, s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	s := parseSpec(t, testSpec)
+
+	tests := []struct {
+		typ  string
+		v    interface{}
+		data string
+	}{
+		{"single", int32(-2), "fffffffe"},
+		{"optional", nil, "00000000"},
+		{"optional", int32(7), "00000001 00000007"},
+		{"fixed", []interface{}{int32(1), int32(2)}, "00000001 00000002"},
+		{"bounded", []interface{}{}, "00000000"},
+		{"bounded", []interface{}{int32(3), int32(4)}, "00000002 00000003 00000004"},
+		{"unbounded", []interface{}{int32(5)}, "00000001 00000005"},
+		{"fixed_opaque", []byte{1, 2, 3}, "01020300"},
+		{"bounded_opaque", []byte{}, "00000000"},
+		{"bounded_opaque", []byte{1, 2, 3, 4, 5}, "00000005 01020304 05000000"},
+		{"unbounded_opaque", []byte{1, 2, 3, 4}, "00000004 01020304"},
+		{"bounded_string", "hello", "00000005 68656c6c 6f000000"},
+		{"unbounded_string", "", "00000000"},
+		{
+			"scalars",
+			map[string]interface{}{
+				"b":  true,
+				"i":  int32(-1),
+				"u":  uint32(0xffffffff),
+				"h":  int64(-2),
+				"uh": uint64(1) << 63,
+				"f":  float32(1.5),
+				"d":  float64(-0.25),
+				"c":  Enum{Name: "BLUE", Value: -1},
+			},
+			"00000001 ffffffff ffffffff fffffffffffffffe 8000000000000000 3fc00000 bfd0000000000000 ffffffff",
+		},
+		{"result", &Union{Discriminant: Enum{"RED", 1}, Arm: "value", Value: int32(3)}, "00000001 00000003"},
+		{"result", &Union{Discriminant: Enum{"GREEN", 2}}, "00000002"},
+		{"result", &Union{Discriminant: Enum{"BLUE", -1}, Arm: "message", Value: "x"}, "ffffffff 00000001 78000000"},
+		{"flag", &Union{Discriminant: true, Arm: "value", Value: uint32(9)}, "00000001 00000009"},
+		{"flag", &Union{Discriminant: false}, "00000000"},
+		{
+			"lists",
+			[]interface{}{
+				map[string]interface{}{"value": int32(1), "next": nil},
+				map[string]interface{}{
+					"value": int32(2),
+					"next":  map[string]interface{}{"value": int32(3), "next": nil},
+				},
+			},
+			"00000002 00000001 00000000 00000002 00000001 00000003 00000000",
+		},
+	}
+
+	for _, test := range tests {
+		c := newCodec(t, s, test.typ)
+		want := unhex(t, test.data)
+
+		b, err := c.Marshal(test.v)
+		if err != nil {
+			t.Errorf("%s %v: %v", test.typ, test.v, err)
+			continue
+		} else if !bytes.Equal(b, want) {
+			t.Errorf("%s %v: encoded as %x, expected %x", test.typ, test.v, b, want)
+		}
+
+		v, err := c.Unmarshal(want)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.typ, test.data, err)
+		} else if !reflect.DeepEqual(v, test.v) {
+			t.Errorf("%s %s: decoded as %#v, expected %#v", test.typ, test.data, v, test.v)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	s := parseSpec(t, testSpec)
+
+	tests := []struct {
+		typ    string
+		limits Limits
+		data   string
+		// err is the expected error, which is formatted with its path and
+		// offset
+		err string
+	}{
+		{"bounded_opaque", Limits{}, "00000001 01000100", "bounded_opaque (at offset 5): Padding is not zero"},
+		{"unbounded_string", Limits{}, "00000002 61620001", "unbounded_string (at offset 6): Padding is not zero"},
+		{"scalars", Limits{}, "00000002", "scalars.b (at offset 0): 2 is not a valid bool"},
+		{"optional", Limits{}, "00000002 00000001", "optional (at offset 0): 2 is not a valid optional value flag"},
+		{"flag", Limits{}, "00000003", "flag.set (at offset 0): 3 is not a valid bool"},
+		{"result", Limits{}, "00000005", "result.c (at offset 0): 5 is not a value of the enum"},
+		{"bounded", Limits{}, "00000003", "bounded (at offset 0): Length 3 exceeds the maximum of 2"},
+		{"unbounded_opaque", Limits{MaxLength: 4}, "00000005", "unbounded_opaque (at offset 0): Length 5 exceeds the limit of 4"},
+		{"unbounded", Limits{MaxLength: 4}, "00000005", "unbounded (at offset 0): Length 5 exceeds the limit of 4"},
+		{"unbounded_opaque", Limits{MaxLength: 4}, "00000004 01020304", ""},
+		{"unbounded_opaque", Limits{}, "ffffffff", "unbounded_opaque (at offset 0): Length 4294967295 exceeds the limit of 16777216"},
+		{"scalars", Limits{}, "00000001 00000002 00000003 0000", "scalars.h (at offset 12): Unexpected end of data"},
+		{"unbounded_opaque", Limits{}, "00000008 010203", "unbounded_opaque (at offset 4): Unexpected end of data"},
+		{"bounded_opaque", Limits{}, "00000001 0100", "bounded_opaque (at offset 5): Unexpected end of data"},
+		{"lists", Limits{MaxDepth: 2}, "00000001 00000001 00000000", ""},
+		{
+			"lists",
+			Limits{MaxDepth: 2},
+			"00000001 00000001 00000001 00000002 00000000",
+			"lists[0].next (at offset 12): Values are nested more than 2 deep",
+		},
+	}
+
+	for _, test := range tests {
+		c := newCodec(t, s, test.typ)
+		c.Limits = test.limits
+
+		_, err := c.Unmarshal(unhex(t, test.data))
+		switch {
+		case err == nil && test.err != "":
+			t.Errorf("%s %s: decoded, expected error %q", test.typ, test.data, test.err)
+		case err != nil && err.Error() != test.err:
+			t.Errorf("%s %s: got error %q, expected %q", test.typ, test.data, err, test.err)
+		case err != nil:
+			if _, ok := err.(*Error); !ok {
+				t.Errorf("%s %s: error is a %T, not an *Error", test.typ, test.data, err)
+			}
+		}
+	}
+}
+
+func TestEncodeLimits(t *testing.T) {
+	s := parseSpec(t, testSpec)
+
+	c := newCodec(t, s, "list")
+	c.MaxDepth = 2
+	v := map[string]interface{}{"value": int32(1), "next": nil}
+	if _, err := c.Marshal(v); err != nil {
+		t.Error(err)
+	}
+	v = map[string]interface{}{"value": int32(1), "next": v}
+	v = map[string]interface{}{"value": int32(1), "next": v}
+	if _, err := c.Marshal(v); err == nil || !strings.Contains(err.Error(), "nested more than 2 deep") {
+		t.Errorf("Encoding a list 3 deep returned error %v", err)
+	}
+
+	c = newCodec(t, s, "bounded_string")
+	if _, err := c.Marshal("toolong"); err == nil || err.Error() != "bounded_string (at offset 0): Length 7 exceeds the maximum of 5" {
+		t.Errorf("Encoding an overlong string returned error %v", err)
+	}
+}
+
+func TestUnmarshalLength(t *testing.T) {
+	s := parseSpec(t, testSpec)
+	c := newCodec(t, s, "optional")
+
+	tests := []struct {
+		data string
+		err  string
+		eof  bool
+	}{
+		{"", "optional (at offset 0): Unexpected end of data", true},
+		{"00000001", "", true},
+		{"0000", "", true},
+		{"00000000 00", "optional (at offset 4): 1 bytes follow the value", false},
+		{"00000001 00000002 00000003", "optional (at offset 8): 4 bytes follow the value", false},
+	}
+
+	for _, test := range tests {
+		_, err := c.Unmarshal(unhex(t, test.data))
+		derr, ok := err.(*Error)
+		switch {
+		case !ok:
+			t.Errorf("%q: got error %v, expected an *Error", test.data, err)
+		case test.err != "" && err.Error() != test.err:
+			t.Errorf("%q: got error %q, expected %q", test.data, err, test.err)
+		case test.eof && derr.Message != "Unexpected end of data":
+			t.Errorf("%q: got error %q, expected the end of data", test.data, err)
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	s := parseSpec(t, testSpec)
+	c := newCodec(t, s, "unbounded_string")
+
+	d := c.NewDecoder(bytes.NewReader(unhex(t, "00000001 61000000 00000000 00000003 6263")))
+	for _, want := range []string{"a", ""} {
+		v, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		} else if v != want {
+			t.Errorf("Decoded %q, expected %q", v, want)
+		}
+	}
+	if d.Offset() != 12 {
+		t.Errorf("Offset is %d after two values, expected 12", d.Offset())
+	}
+
+	// The last value is truncated, which is an error rather than the end of
+	// the stream
+	if _, err := d.Decode(); err == io.EOF || err == nil {
+		t.Errorf("Decoding a truncated value returned %v", err)
+	} else if derr, ok := err.(*Error); !ok || derr.Message != "Unexpected end of data" {
+		t.Errorf("Decoding a truncated value returned %#v", err)
+	} else if derr.Offset != 16 {
+		t.Errorf("Decoding a truncated value returned an error at offset %d, expected 16", derr.Offset)
+	}
+
+	// Errors in long data, which is read in chunks, are reported at the start
+	// of the data
+	data := append(unhex(t, "00020000"), make([]byte, 0x10004)...)
+	if _, err := c.Unmarshal(data); err == nil || err.Error() != "unbounded_string (at offset 4): Unexpected end of data" {
+		t.Errorf("Decoding truncated long data returned %v", err)
+	}
+
+	d = c.NewDecoder(bytes.NewReader(unhex(t, "00000000")))
+	if _, err := d.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Errorf("Decoding at the end of the stream returned %v, expected EOF", err)
+	}
+}
@@ -0,0 +1,392 @@
+package dynamic
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"go.e43.eu/xdrgen/ast"
+)
+
+// Marshal encodes a value of the codec's type. Besides the types which
+// values are decoded as, integers may be given as any Go integer type (if
+// they are in range), floating point values as either float32 or float64,
+// enum values by their name as a string and unions as a Union
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	e := &encoder{c: c}
+	if err := e.typ(c.name, c.typ, v, 0); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// Encode encodes a value of the codec's type to w
+func (c *Codec) Encode(w io.Writer, v interface{}) error {
+	b, err := c.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+type encoder struct {
+	c   *Codec
+	buf []byte
+}
+
+func (e *encoder) errorf(path string, fmts string, args ...interface{}) error {
+	return &Error{Path: path, Offset: int64(len(e.buf)), Message: fmt.Sprintf(fmts, args...)}
+}
+
+func (e *encoder) mismatch(path, expected string, v interface{}) error {
+	if v == nil {
+		return e.errorf(path, "Expected %s, not nil", expected)
+	}
+	return e.errorf(path, "Expected %s, not %T", expected, v)
+}
+
+func (e *encoder) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) opaque(v []byte) {
+	e.buf = append(e.buf, v...)
+	for i := len(v); i%4 != 0; i++ {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) checkDepth(path string, depth int) error {
+	if max := e.c.maxDepth(); depth > max {
+		return e.errorf(path, "Values are nested more than %d deep", max)
+	}
+	return nil
+}
+
+// integer converts any Go integer to an int64, or returns false if it is not
+// an integer. Values of unsigned types too large to be an int64 are returned
+// as their uint64 value in u
+func integer(v interface{}) (i int64, u uint64, big, ok bool) {
+	switch v := v.(type) {
+	case int:
+		i = int64(v)
+	case int8:
+		i = int64(v)
+	case int16:
+		i = int64(v)
+	case int32:
+		i = int64(v)
+	case int64:
+		i = v
+	case uint:
+		return integer(uint64(v))
+	case uint8:
+		i = int64(v)
+	case uint16:
+		i = int64(v)
+	case uint32:
+		i = int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, v, true, true
+		}
+		i = int64(v)
+	default:
+		return 0, 0, false, false
+	}
+	return i, uint64(i), false, true
+}
+
+// integerIn converts an integer value, checking that it is within [min, max]
+func (e *encoder) integerIn(path, typ string, v interface{}, min int64, max uint64) (int64, uint64, error) {
+	i, u, big, ok := integer(v)
+	switch {
+	case !ok:
+		return 0, 0, e.mismatch(path, "an integer", v)
+	case big && u > max, !big && i >= 0 && uint64(i) > max, !big && i < min:
+		return 0, 0, e.errorf(path, "%v is out of the range of %s", v, typ)
+	}
+	return i, u, nil
+}
+
+func (e *encoder) typ(path string, t *ast.Type, v interface{}, depth int) error {
+	switch t.Kind {
+	case ast.TYPE_VOID:
+		if v != nil {
+			return e.mismatch(path, "void (nil)", v)
+		}
+		return nil
+
+	case ast.TYPE_BOOL:
+		b, ok := v.(bool)
+		if !ok {
+			return e.mismatch(path, "a bool", v)
+		}
+		if b {
+			e.uint32(1)
+		} else {
+			e.uint32(0)
+		}
+		return nil
+
+	case ast.TYPE_INT:
+		i, _, err := e.integerIn(path, "an int", v, math.MinInt32, math.MaxInt32)
+		e.uint32(uint32(i))
+		return err
+
+	case ast.TYPE_UNSIGNED_INT:
+		_, u, err := e.integerIn(path, "an unsigned int", v, 0, math.MaxUint32)
+		e.uint32(uint32(u))
+		return err
+
+	case ast.TYPE_HYPER:
+		i, _, err := e.integerIn(path, "a hyper", v, math.MinInt64, math.MaxInt64)
+		e.uint64(uint64(i))
+		return err
+
+	case ast.TYPE_UNSIGNED_HYPER:
+		_, u, err := e.integerIn(path, "an unsigned hyper", v, 0, math.MaxUint64)
+		e.uint64(u)
+		return err
+
+	case ast.TYPE_FLOAT:
+		switch f := v.(type) {
+		case float32:
+			e.uint32(math.Float32bits(f))
+		case float64:
+			if f32 := float32(f); math.IsInf(float64(f32), 0) && !math.IsInf(f, 0) {
+				return e.errorf(path, "%v is out of the range of a float", f)
+			}
+			e.uint32(math.Float32bits(float32(f)))
+		default:
+			return e.mismatch(path, "a float", v)
+		}
+		return nil
+
+	case ast.TYPE_DOUBLE:
+		switch f := v.(type) {
+		case float32:
+			e.uint64(math.Float64bits(float64(f)))
+		case float64:
+			e.uint64(math.Float64bits(f))
+		default:
+			return e.mismatch(path, "a double", v)
+		}
+		return nil
+
+	case ast.TYPE_ENUM:
+		return e.enum(path, t.EnumSpec, v)
+
+	case ast.TYPE_STRUCT:
+		if err := e.checkDepth(path, depth); err != nil {
+			return err
+		}
+		return e.structure(path, t.StructSpec, v, depth)
+
+	case ast.TYPE_UNION:
+		if err := e.checkDepth(path, depth); err != nil {
+			return err
+		}
+		return e.union(path, t.UnionSpec, v, depth)
+
+	case ast.TYPE_TYPEDEF:
+		return e.decl(path, t.TypeDef, v, depth)
+
+	case ast.TYPE_REF:
+		rt, err := resolve(e.c.spec, t)
+		if err != nil {
+			return e.errorf(path, "%s", err)
+		}
+		return e.typ(path, rt, v, depth)
+	}
+	return e.errorf(path, "A %s must be declared as an array", t.Kind)
+}
+
+func (e *encoder) enum(path string, es *ast.EnumSpec, v interface{}) error {
+	var val int32
+	switch v := v.(type) {
+	case Enum:
+		if v.Name == "" {
+			return e.enum(path, es, v.Value)
+		}
+		return e.enum(path, es, v.Name)
+
+	case string:
+		var ok bool
+		if val, ok = es.GetValue(e.c.spec, v); !ok {
+			return e.errorf(path, "'%s' is not a value of the enum", v)
+		}
+
+	default:
+		i, _, err := e.integerIn(path, "an enum", v, math.MinInt32, math.MaxInt32)
+		if err != nil {
+			return err
+		}
+
+		val = int32(i)
+		if es.GetName(e.c.spec, val) == "" {
+			return e.errorf(path, "%d is not a value of the enum", val)
+		}
+	}
+
+	e.uint32(uint32(val))
+	return nil
+}
+
+func (e *encoder) structure(path string, ss *ast.StructSpec, v interface{}, depth int) error {
+	s, ok := v.(map[string]interface{})
+	if !ok {
+		return e.mismatch(path, "a struct (map[string]interface{})", v)
+	}
+
+	var unknown []string
+	for name := range s {
+		if !ss.HasMember(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return e.errorf(path, "The struct has no member '%s'", unknown[0])
+	}
+
+	for _, m := range ss.Members {
+		mv, ok := s[m.Name]
+		if !ok {
+			return e.errorf(joinPath(path, m.Name), "Missing member")
+		}
+		if err := e.decl(joinPath(path, m.Name), m, mv, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) union(path string, us *ast.UnionSpec, v interface{}, depth int) error {
+	var u *Union
+	switch v := v.(type) {
+	case *Union:
+		u = v
+	case Union:
+		u = &v
+	}
+	if u == nil {
+		return e.mismatch(path, "a union (*Union)", v)
+	}
+
+	discPath := joinPath(path, us.Discriminant.Name)
+	if err := e.decl(discPath, us.Discriminant, u.Discriminant, depth+1); err != nil {
+		return err
+	}
+
+	// Whatever form the discriminant was given in, its encoding is its value
+	dv := int32(binary.BigEndian.Uint32(e.buf[len(e.buf)-4:]))
+	m, ok := arm(us, dv)
+	switch {
+	case !ok:
+		return e.errorf(discPath, "No arm is selected by the discriminant %v", u.Discriminant)
+	case u.Arm != "" && u.Arm != m.Name:
+		return e.errorf(path, "The discriminant %v selects the arm '%s', not '%s'", u.Discriminant, m.Name, u.Arm)
+	case m.IsVoid():
+		if u.Value != nil {
+			return e.errorf(path, "The discriminant %v selects a void arm, but a value was given", u.Discriminant)
+		}
+		return nil
+	}
+
+	return e.decl(joinPath(path, m.Name), m, u.Value, depth+1)
+}
+
+func (e *encoder) decl(path string, decl *ast.Declaration, v interface{}, depth int) error {
+	mod := decl.Modifier
+	switch mod.Kind {
+	case ast.DECLARATION_MODIFIER_NONE:
+		return e.typ(path, decl.Type, v, depth)
+
+	case ast.DECLARATION_MODIFIER_OPTIONAL:
+		if v == nil {
+			e.uint32(0)
+			return nil
+		}
+		if err := e.checkDepth(path, depth); err != nil {
+			return err
+		}
+		e.uint32(1)
+		return e.typ(path, decl.Type, v, depth+1)
+	}
+
+	switch decl.Type.Kind {
+	case ast.TYPE_OPAQUE:
+		b, ok := v.([]byte)
+		if !ok {
+			return e.mismatch(path, "opaque data ([]byte)", v)
+		}
+		if err := e.length(path, mod, len(b)); err != nil {
+			return err
+		}
+		e.opaque(b)
+		return nil
+
+	case ast.TYPE_STRING:
+		s, ok := v.(string)
+		if !ok {
+			return e.mismatch(path, "a string", v)
+		}
+		if err := e.length(path, mod, len(s)); err != nil {
+			return err
+		}
+		e.opaque([]byte(s))
+		return nil
+	}
+
+	arr, ok := v.([]interface{})
+	if !ok {
+		return e.mismatch(path, "an array ([]interface{})", v)
+	}
+	if err := e.length(path, mod, len(arr)); err != nil {
+		return err
+	}
+	if err := e.checkDepth(path, depth); err != nil {
+		return err
+	}
+
+	for i, ev := range arr {
+		if err := e.typ(indexPath(path, i), decl.Type, ev, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// length checks the length of an array against its declaration, and
+// encodes it if it is variable
+func (e *encoder) length(path string, mod *ast.Declaration_Modifier, n int) error {
+	switch mod.Kind {
+	case ast.DECLARATION_MODIFIER_FIXED:
+		if n != int(mod.Size) {
+			return e.errorf(path, "Expected a length of exactly %d, not %d", mod.Size, n)
+		}
+		return nil
+	case ast.DECLARATION_MODIFIER_FLEXIBLE:
+		if n > int(mod.Size) {
+			return e.errorf(path, "Length %d exceeds the maximum of %d", n, mod.Size)
+		}
+	}
+
+	if uint64(n) > math.MaxUint32 {
+		return e.errorf(path, "Length %d exceeds the maximum of %d", n, uint32(math.MaxUint32))
+	}
+	e.uint32(uint32(n))
+	return nil
+}
@@ -0,0 +1,454 @@
+package dynamic
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"go.e43.eu/xdrgen/ast"
+)
+
+// Mode selects the values which a Generator generates
+type Mode int
+
+const (
+	// Random generates random values
+	Random Mode = iota
+	// Empty generates the smallest values: variable length arrays, strings
+	// and opaque data are empty, optional values absent and numbers zero,
+	// and the first value of each enum and the first arm of each union are
+	// chosen
+	Empty
+	// Full generates the largest values: variable length arrays, strings and
+	// opaque data are as long as their bound allows (or MaxLength, if they
+	// are unbounded), optional values are present and numbers are their
+	// maximum, and the last value of each enum and the last arm of each
+	// union are chosen
+	Full
+	// Every generates values which choose each value of every enum and each
+	// arm of every union in turn, until all have been chosen (as reported by
+	// Done). Optional values are present and arrays non-empty where allowed,
+	// so that choices nested within them are reached
+	Every
+)
+
+var modeNames = [...]string{
+	Random: "random",
+	Empty:  "empty",
+	Full:   "full",
+	Every:  "every",
+}
+
+func (m Mode) String() string {
+	if m < 0 || int(m) >= len(modeNames) {
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+	return modeNames[m]
+}
+
+const (
+	defaultGenMaxLength = 16
+	defaultGenMaxDepth  = 16
+	defaultGenMaxValues = 4096
+)
+
+// Generator generates valid values of the type of a codec, for testing: the
+// values respect the bounds of arrays, strings and opaque data, and choose
+// only the values of enums and the arms of unions which are defined. Values
+// are generated deterministically from the seed of the generator
+type Generator struct {
+	Mode Mode
+	// MaxLength limits the length of variable length arrays, strings and
+	// opaque data which are unbounded or, except in Full mode, whose bound
+	// is larger. 0 selects 16
+	MaxLength uint32
+	// MaxDepth limits the nesting of values, as Limits.MaxDepth does, by
+	// generating absent optional values and empty arrays beyond it. 0
+	// selects 16
+	MaxDepth int
+	// MaxValues limits the size of each value: once this many array
+	// elements and optional values have been generated, variable length
+	// arrays are empty and optional values absent. 0 selects 4096
+	MaxValues int
+
+	c      *Codec
+	rand   *rand.Rand
+	budget int
+	// choices tracks the choices made at each enum and union in Every mode
+	choices map[interface{}]*choice
+}
+
+// choice tracks the choices made at an enum or union
+type choice struct {
+	n, next int
+}
+
+// NewGenerator returns a generator of values of the codec's type, seeded
+// with seed
+func (c *Codec) NewGenerator(seed int64) *Generator {
+	return &Generator{
+		c:       c,
+		rand:    rand.New(rand.NewSource(seed)),
+		choices: make(map[interface{}]*choice),
+	}
+}
+
+// Generate generates a value. Errors are returned as an *Error
+func (g *Generator) Generate() (interface{}, error) {
+	g.budget = g.MaxValues
+	if g.budget == 0 {
+		g.budget = defaultGenMaxValues
+	}
+	return g.typ(g.c.name, g.c.typ, 0)
+}
+
+// Done returns whether every value of each enum and every arm of each union
+// reached by the values generated in Every mode has been chosen
+func (g *Generator) Done() bool {
+	for _, c := range g.choices {
+		if c.next < c.n {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Generator) errorf(path string, fmts string, args ...interface{}) error {
+	return &Error{Path: path, Offset: -1, Message: fmt.Sprintf(fmts, args...)}
+}
+
+func (g *Generator) maxLength() uint32 {
+	if g.MaxLength == 0 {
+		return defaultGenMaxLength
+	}
+	return g.MaxLength
+}
+
+func (g *Generator) maxDepth() int {
+	max := g.MaxDepth
+	if max == 0 {
+		max = defaultGenMaxDepth
+	}
+	if limit := g.c.maxDepth(); max > limit {
+		max = limit
+	}
+	return max
+}
+
+// choose returns which of n options to choose at site, according to the
+// mode
+func (g *Generator) choose(site interface{}, n int) int {
+	switch g.Mode {
+	case Empty:
+		return 0
+	case Full:
+		return n - 1
+	case Every:
+		c := g.choices[site]
+		if c == nil {
+			c = &choice{n: n}
+			g.choices[site] = c
+		}
+		i := c.next % n
+		c.next++
+		return i
+	}
+	return g.rand.Intn(n)
+}
+
+// spend takes a value from the budget, returning false if it is exhausted
+func (g *Generator) spend() bool {
+	if g.budget <= 0 {
+		return false
+	}
+	g.budget--
+	return true
+}
+
+// length returns the length of a variable length array, string or opaque
+// data with the given bound (or none, if unbounded)
+func (g *Generator) length(bound uint32, bounded bool) uint32 {
+	max := g.maxLength()
+	switch {
+	case !bounded:
+	case g.Mode == Full:
+		max = bound
+	case bound < max:
+		max = bound
+	}
+	if limit := g.c.maxLength(); max > limit {
+		max = limit
+	}
+
+	switch g.Mode {
+	case Empty:
+		return 0
+	case Full:
+		return max
+	case Every:
+		if max == 0 {
+			return 0
+		}
+		return 1 + uint32(g.rand.Int63n(int64(max)))
+	}
+	return uint32(g.rand.Int63n(int64(max) + 1))
+}
+
+const stringChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func (g *Generator) opaque(n uint32) []byte {
+	b := make([]byte, n)
+	g.rand.Read(b)
+	return b
+}
+
+func (g *Generator) string(n uint32) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = stringChars[g.rand.Intn(len(stringChars))]
+	}
+	return string(b)
+}
+
+func (g *Generator) typ(path string, t *ast.Type, depth int) (interface{}, error) {
+	switch t.Kind {
+	case ast.TYPE_VOID:
+		return nil, nil
+
+	case ast.TYPE_BOOL:
+		switch g.Mode {
+		case Empty:
+			return false, nil
+		case Full:
+			return true, nil
+		}
+		return g.rand.Intn(2) == 1, nil
+
+	case ast.TYPE_INT:
+		switch g.Mode {
+		case Empty:
+			return int32(0), nil
+		case Full:
+			return int32(math.MaxInt32), nil
+		}
+		return int32(g.rand.Uint32()), nil
+
+	case ast.TYPE_UNSIGNED_INT:
+		switch g.Mode {
+		case Empty:
+			return uint32(0), nil
+		case Full:
+			return uint32(math.MaxUint32), nil
+		}
+		return g.rand.Uint32(), nil
+
+	case ast.TYPE_HYPER:
+		switch g.Mode {
+		case Empty:
+			return int64(0), nil
+		case Full:
+			return int64(math.MaxInt64), nil
+		}
+		return int64(g.rand.Uint64()), nil
+
+	case ast.TYPE_UNSIGNED_HYPER:
+		switch g.Mode {
+		case Empty:
+			return uint64(0), nil
+		case Full:
+			return uint64(math.MaxUint64), nil
+		}
+		return g.rand.Uint64(), nil
+
+	case ast.TYPE_FLOAT:
+		switch g.Mode {
+		case Empty:
+			return float32(0), nil
+		case Full:
+			return float32(math.MaxFloat32), nil
+		}
+		return float32(g.rand.NormFloat64() * 1000), nil
+
+	case ast.TYPE_DOUBLE:
+		switch g.Mode {
+		case Empty:
+			return float64(0), nil
+		case Full:
+			return math.MaxFloat64, nil
+		}
+		return g.rand.NormFloat64() * 1000, nil
+
+	case ast.TYPE_ENUM:
+		opts := t.EnumSpec.GetOptions(g.c.spec)
+		if len(opts) == 0 {
+			return nil, g.errorf(path, "The enum has no values")
+		}
+		o := opts[g.choose(t.EnumSpec, len(opts))]
+		return Enum{Name: o.Name, Value: o.Value}, nil
+
+	case ast.TYPE_STRUCT:
+		s := make(map[string]interface{}, len(t.StructSpec.Members))
+		for _, m := range t.StructSpec.Members {
+			v, err := g.decl(joinPath(path, m.Name), m, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			s[m.Name] = v
+		}
+		return s, nil
+
+	case ast.TYPE_UNION:
+		return g.union(path, t.UnionSpec, depth)
+
+	case ast.TYPE_TYPEDEF:
+		return g.decl(path, t.TypeDef, depth)
+
+	case ast.TYPE_REF:
+		rt, err := resolve(g.c.spec, t)
+		if err != nil {
+			return nil, g.errorf(path, "%s", err)
+		}
+		return g.typ(path, rt, depth)
+	}
+	return nil, g.errorf(path, "A %s must be declared as an array", t.Kind)
+}
+
+func (g *Generator) union(path string, u *ast.UnionSpec, depth int) (interface{}, error) {
+	discPath := joinPath(path, u.Discriminant.Name)
+	dt, err := resolve(g.c.spec, u.Discriminant.Type)
+	for err == nil && dt.Kind == ast.TYPE_TYPEDEF {
+		dt, err = resolve(g.c.spec, dt.TypeDef.Type)
+	}
+	if err != nil {
+		return nil, g.errorf(discPath, "%s", err)
+	}
+
+	// Each case value is a choice, in order, followed by the default arm
+	values := make([]int32, 0, len(u.Options)+1)
+	for v := range u.Options {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	if u.DefaultMember != nil {
+		if v, ok := g.unselected(u, dt); ok {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return nil, g.errorf(path, "No arm of the union can be selected")
+	}
+
+	dv := values[g.choose(u, len(values))]
+	var disc interface{}
+	switch dt.Kind {
+	case ast.TYPE_BOOL:
+		disc = dv == 1
+	case ast.TYPE_INT:
+		disc = dv
+	case ast.TYPE_UNSIGNED_INT:
+		disc = uint32(dv)
+	case ast.TYPE_ENUM:
+		disc = Enum{Name: dt.EnumSpec.GetName(g.c.spec, dv), Value: dv}
+	default:
+		return nil, g.errorf(discPath, "The discriminant of a union can't be a %s", dt.Kind)
+	}
+
+	m, _ := arm(u, dv)
+	if m.IsVoid() {
+		return &Union{Discriminant: disc}, nil
+	}
+
+	v, err := g.decl(joinPath(path, m.Name), m, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	return &Union{Discriminant: disc, Arm: m.Name, Value: v}, nil
+}
+
+// unselected returns a value of the discriminant of a union which selects
+// its default arm, if there is one
+func (g *Generator) unselected(u *ast.UnionSpec, dt *ast.Type) (int32, bool) {
+	switch dt.Kind {
+	case ast.TYPE_BOOL:
+		for _, v := range []int32{0, 1} {
+			if !u.HasOption(v) {
+				return v, true
+			}
+		}
+	case ast.TYPE_ENUM:
+		for _, o := range dt.EnumSpec.GetOptions(g.c.spec) {
+			if !u.HasOption(o.Value) {
+				return o.Value, true
+			}
+		}
+	case ast.TYPE_INT, ast.TYPE_UNSIGNED_INT:
+		for v := int32(0); v >= 0; v++ {
+			if !u.HasOption(v) {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (g *Generator) decl(path string, decl *ast.Declaration, depth int) (interface{}, error) {
+	mod := decl.Modifier
+	var n uint32
+	switch mod.Kind {
+	case ast.DECLARATION_MODIFIER_NONE:
+		return g.typ(path, decl.Type, depth)
+
+	case ast.DECLARATION_MODIFIER_OPTIONAL:
+		var present bool
+		switch g.Mode {
+		case Full, Every:
+			present = true
+		case Random:
+			present = g.rand.Intn(2) == 1
+		}
+		if !present || depth+1 > g.maxDepth() || !g.spend() {
+			return nil, nil
+		}
+		return g.typ(path, decl.Type, depth+1)
+
+	case ast.DECLARATION_MODIFIER_FIXED:
+		n = mod.Size
+
+	case ast.DECLARATION_MODIFIER_FLEXIBLE, ast.DECLARATION_MODIFIER_UNBOUNDED:
+		n = g.length(mod.Size, mod.Kind == ast.DECLARATION_MODIFIER_FLEXIBLE)
+
+	default:
+		return nil, g.errorf(path, "Unknown declaration modifier %s", mod.Kind)
+	}
+
+	switch decl.Type.Kind {
+	case ast.TYPE_OPAQUE:
+		return g.opaque(n), nil
+	case ast.TYPE_STRING:
+		return g.string(n), nil
+	}
+
+	switch {
+	case mod.Kind == ast.DECLARATION_MODIFIER_FIXED:
+		// Fixed length arrays can't be shortened, so may overspend
+		g.budget -= int(n)
+	case depth+1 > g.maxDepth() || g.budget <= 0:
+		n = 0
+	case int64(n) > int64(g.budget):
+		n = uint32(g.budget)
+		g.budget = 0
+	default:
+		g.budget -= int(n)
+	}
+
+	arr := make([]interface{}, n)
+	for i := range arr {
+		v, err := g.typ(indexPath(path, i), decl.Type, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+	return arr, nil
+}
@@ -0,0 +1,164 @@
+package dynamic
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const generateSpec = `
+enum colour { RED = 1, GREEN = 2, BLUE = 3 };
+enum kind { A = 0, B = 1 };
+
+union inner switch (kind k) {
+case A:
+	colour c;
+case B:
+	void;
+};
+
+union outer switch (colour c) {
+case RED:
+	inner i<>;
+case GREEN:
+	inner *opt;
+default:
+	hyper h;
+};
+
+union flag switch (bool set) {
+case 1:
+	unsigned int u;
+case 0:
+	void;
+};
+
+struct value {
+	outer o;
+	flag f;
+	bool b;
+	int i;
+	unsigned hyper uh;
+	float fl;
+	double d;
+	opaque fixed_data[3];
+	opaque data<8>;
+	string name<>;
+	colour colours[2];
+	value *next;
+};
+`
+
+var generateModes = []Mode{Random, Empty, Full, Every}
+
+func TestGenerateRoundTrip(t *testing.T) {
+	c := newCodec(t, parseSpec(t, generateSpec), "value")
+
+	for _, mode := range generateModes {
+		g := c.NewGenerator(1)
+		g.Mode = mode
+		for i := 0; i < 20; i++ {
+			v, err := g.Generate()
+			if err != nil {
+				t.Fatalf("%s: %v", mode, err)
+			}
+
+			b, err := c.Marshal(v)
+			if err != nil {
+				t.Errorf("%s: value %d: %v", mode, i, err)
+				continue
+			}
+			decoded, err := c.Unmarshal(b)
+			if err != nil {
+				t.Errorf("%s: value %d: %v", mode, i, err)
+			} else if !reflect.DeepEqual(decoded, v) {
+				t.Errorf("%s: value %d decoded as %#v, expected %#v", mode, i, decoded, v)
+			}
+		}
+	}
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	c := newCodec(t, parseSpec(t, generateSpec), "value")
+
+	generate := func(mode Mode, seed int64) []interface{} {
+		g := c.NewGenerator(seed)
+		g.Mode = mode
+		vals := make([]interface{}, 5)
+		for i := range vals {
+			v, err := g.Generate()
+			if err != nil {
+				t.Fatalf("%s: %v", mode, err)
+			}
+			vals[i] = v
+		}
+		return vals
+	}
+
+	for _, mode := range generateModes {
+		if a, b := generate(mode, 42), generate(mode, 42); !reflect.DeepEqual(a, b) {
+			t.Errorf("%s: generated different values from the same seed", mode)
+		}
+	}
+	if reflect.DeepEqual(generate(Random, 1), generate(Random, 2)) {
+		t.Error("random: generated the same values from different seeds")
+	}
+}
+
+// choices returns the names of the enum values and union arms chosen in v,
+// sorted
+func choices(v interface{}) []string {
+	seen := make(map[string]bool)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case Enum:
+			seen[v.Name] = true
+		case *Union:
+			walk(v.Discriminant)
+			if v.Arm != "" {
+				seen["arm "+v.Arm] = true
+			}
+			walk(v.Value)
+		case map[string]interface{}:
+			for _, mv := range v {
+				walk(mv)
+			}
+		case []interface{}:
+			for _, ev := range v {
+				walk(ev)
+			}
+		}
+	}
+	walk(v)
+
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGenerateEvery(t *testing.T) {
+	c := newCodec(t, parseSpec(t, generateSpec), "value")
+
+	g := c.NewGenerator(1)
+	g.Mode = Every
+	var vals []interface{}
+	for !g.Done() || len(vals) == 0 {
+		if len(vals) == 10 {
+			t.Fatalf("Not done after %d values", len(vals))
+		}
+		v, err := g.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		vals = append(vals, v)
+	}
+
+	want := []string{"A", "B", "BLUE", "GREEN", "RED", "arm c", "arm h", "arm i", "arm opt", "arm u"}
+	if got := choices(vals); !reflect.DeepEqual(got, want) {
+		t.Errorf("Chose %q, expected %q", got, want)
+	}
+}
@@ -0,0 +1,658 @@
+package dynamic
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.e43.eu/xdrgen/ast"
+)
+
+// OpaqueEncoding selects the representation of opaque data in JSON
+type OpaqueEncoding int
+
+const (
+	// OpaqueHex represents opaque data as a string of hexadecimal digits
+	OpaqueHex OpaqueEncoding = iota
+	// OpaqueBase64 represents opaque data as a base64 string (with padding)
+	OpaqueBase64
+)
+
+// JSONOptions control the JSON representation of values
+type JSONOptions struct {
+	Opaque OpaqueEncoding
+	// Indent, if not empty, is used to indent nested objects and arrays
+	Indent string
+}
+
+// ToJSON returns the JSON representation of a value, as decoded by the
+// codec.
+//
+// Structs are represented as objects, with their members in the order they
+// are declared. Unions are represented as objects containing the
+// discriminant and the arm it selects, keyed by their names. Enum values are
+// represented by their names, opaque data as a string, absent optional
+// values as null, and floating point values which aren't finite as the
+// strings "NaN", "+Inf" and "-Inf". Strings which aren't valid UTF-8 can't
+// be represented by JSON strings, so are represented as an object with the
+// single member "opaque", containing their bytes as opaque data
+func (c *Codec) ToJSON(v interface{}, opts JSONOptions) ([]byte, error) {
+	w := &jsonWriter{c: c, opts: opts}
+	if err := w.typ(c.name, c.typ, v); err != nil {
+		return nil, err
+	}
+
+	if opts.Indent == "" {
+		return w.buf.Bytes(), nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, w.buf.Bytes(), "", opts.Indent); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type jsonWriter struct {
+	c    *Codec
+	opts JSONOptions
+	buf  bytes.Buffer
+}
+
+func (w *jsonWriter) mismatch(path, expected string, v interface{}) error {
+	return &Error{Path: path, Offset: -1, Message: fmt.Sprintf("Expected %s, not %T", expected, v)}
+}
+
+// value writes a value which encoding/json represents as required
+func (w *jsonWriter) value(v interface{}) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	w.buf.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+	return nil
+}
+
+func (w *jsonWriter) float(f float64) {
+	switch {
+	case math.IsNaN(f):
+		w.buf.WriteString(`"NaN"`)
+	case math.IsInf(f, 1):
+		w.buf.WriteString(`"+Inf"`)
+	case math.IsInf(f, -1):
+		w.buf.WriteString(`"-Inf"`)
+	default:
+		w.buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+}
+
+func (w *jsonWriter) opaque(b []byte) error {
+	if w.opts.Opaque == OpaqueBase64 {
+		return w.value(base64.StdEncoding.EncodeToString(b))
+	}
+	return w.value(hex.EncodeToString(b))
+}
+
+func (w *jsonWriter) typ(path string, t *ast.Type, v interface{}) error {
+	switch t.Kind {
+	case ast.TYPE_VOID:
+		w.buf.WriteString("null")
+		return nil
+
+	case ast.TYPE_BOOL, ast.TYPE_INT, ast.TYPE_UNSIGNED_INT, ast.TYPE_HYPER, ast.TYPE_UNSIGNED_HYPER:
+		return w.value(v)
+
+	case ast.TYPE_FLOAT:
+		f, ok := v.(float32)
+		if !ok {
+			return w.mismatch(path, "a float32", v)
+		}
+		// Formatting the float32 as such avoids printing spurious digits
+		if !math.IsNaN(float64(f)) && !math.IsInf(float64(f), 0) {
+			w.buf.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+			return nil
+		}
+		w.float(float64(f))
+		return nil
+
+	case ast.TYPE_DOUBLE:
+		f, ok := v.(float64)
+		if !ok {
+			return w.mismatch(path, "a float64", v)
+		}
+		w.float(f)
+		return nil
+
+	case ast.TYPE_ENUM:
+		e, ok := v.(Enum)
+		if !ok {
+			return w.mismatch(path, "an Enum", v)
+		} else if e.Name == "" {
+			return w.value(e.Value)
+		}
+		return w.value(e.Name)
+
+	case ast.TYPE_STRUCT:
+		s, ok := v.(map[string]interface{})
+		if !ok {
+			return w.mismatch(path, "a map[string]interface{}", v)
+		}
+
+		w.buf.WriteByte('{')
+		for i, m := range t.StructSpec.Members {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.value(m.Name)
+			w.buf.WriteByte(':')
+			if err := w.decl(joinPath(path, m.Name), m, s[m.Name]); err != nil {
+				return err
+			}
+		}
+		w.buf.WriteByte('}')
+		return nil
+
+	case ast.TYPE_UNION:
+		return w.union(path, t.UnionSpec, v)
+
+	case ast.TYPE_TYPEDEF:
+		return w.decl(path, t.TypeDef, v)
+
+	case ast.TYPE_REF:
+		rt, err := resolve(w.c.spec, t)
+		if err != nil {
+			return &Error{Path: path, Offset: -1, Message: err.Error()}
+		}
+		return w.typ(path, rt, v)
+	}
+	return w.value(v)
+}
+
+func (w *jsonWriter) union(path string, us *ast.UnionSpec, v interface{}) error {
+	u, ok := v.(*Union)
+	if !ok {
+		return w.mismatch(path, "a *Union", v)
+	}
+
+	w.buf.WriteByte('{')
+	w.value(us.Discriminant.Name)
+	w.buf.WriteByte(':')
+	if err := w.decl(joinPath(path, us.Discriminant.Name), us.Discriminant, u.Discriminant); err != nil {
+		return err
+	}
+
+	if u.Arm != "" {
+		_, m := us.GetMember(u.Arm)
+		if m == nil {
+			return &Error{Path: path, Offset: -1, Message: fmt.Sprintf("The union has no arm '%s'", u.Arm)}
+		}
+
+		w.buf.WriteByte(',')
+		w.value(u.Arm)
+		w.buf.WriteByte(':')
+		if err := w.decl(joinPath(path, u.Arm), m, u.Value); err != nil {
+			return err
+		}
+	}
+	w.buf.WriteByte('}')
+	return nil
+}
+
+func (w *jsonWriter) decl(path string, decl *ast.Declaration, v interface{}) error {
+	switch decl.Modifier.Kind {
+	case ast.DECLARATION_MODIFIER_NONE:
+		return w.typ(path, decl.Type, v)
+
+	case ast.DECLARATION_MODIFIER_OPTIONAL:
+		if v == nil {
+			w.buf.WriteString("null")
+			return nil
+		}
+		return w.typ(path, decl.Type, v)
+	}
+
+	switch decl.Type.Kind {
+	case ast.TYPE_OPAQUE:
+		b, ok := v.([]byte)
+		if !ok {
+			return w.mismatch(path, "a []byte", v)
+		}
+		return w.opaque(b)
+
+	case ast.TYPE_STRING:
+		s, ok := v.(string)
+		if !ok {
+			return w.mismatch(path, "a string", v)
+		} else if utf8.ValidString(s) {
+			return w.value(s)
+		}
+
+		w.buf.WriteString(`{"opaque":`)
+		if err := w.opaque([]byte(s)); err != nil {
+			return err
+		}
+		w.buf.WriteByte('}')
+		return nil
+	}
+
+	arr, ok := v.([]interface{})
+	if !ok {
+		return w.mismatch(path, "a []interface{}", v)
+	}
+
+	w.buf.WriteByte('[')
+	for i, ev := range arr {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		if err := w.typ(indexPath(path, i), decl.Type, ev); err != nil {
+			return err
+		}
+	}
+	w.buf.WriteByte(']')
+	return nil
+}
+
+// FromJSON converts the JSON representation of a value, as produced by
+// ToJSON, into a value which may be encoded by the codec. Integers may also
+// be given as strings, since many JSON implementations can't represent
+// 64-bit integers exactly, and enum values by number.
+//
+// The value is checked against its type: errors are returned as an *Error,
+// with the JSON path of the value (such as "$.resok.data[2]") and the
+// constraint it violates
+func (c *Codec) FromJSON(data []byte, opts JSONOptions) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var js interface{}
+	if err := dec.Decode(&js); err != nil {
+		return nil, &Error{Path: "$", Offset: -1, Message: err.Error(), Err: err}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, &Error{Path: "$", Offset: -1, Message: "Data follows the value"}
+	}
+
+	r := &jsonReader{c: c, opts: opts}
+	return r.typ("$", c.typ, js)
+}
+
+type jsonReader struct {
+	c    *Codec
+	opts JSONOptions
+}
+
+func (r *jsonReader) errorf(path string, fmts string, args ...interface{}) error {
+	return &Error{Path: path, Offset: -1, Message: fmt.Sprintf(fmts, args...)}
+}
+
+// jsonType describes the type of a decoded JSON value
+func jsonType(js interface{}) string {
+	switch js.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", js)
+}
+
+func (r *jsonReader) mismatch(path, expected string, js interface{}) error {
+	return r.errorf(path, "Expected %s, not %s", expected, jsonType(js))
+}
+
+// integer parses an integer given as a number or string
+func (r *jsonReader) integer(path, typ string, js interface{}, bits int, signed bool) (int64, uint64, error) {
+	var str string
+	switch js := js.(type) {
+	case json.Number:
+		str = js.String()
+	case string:
+		str = js
+	default:
+		return 0, 0, r.mismatch(path, typ, js)
+	}
+
+	if signed {
+		i, err := strconv.ParseInt(str, 10, bits)
+		if err != nil {
+			return 0, 0, r.integerError(path, typ, str, err)
+		}
+		return i, 0, nil
+	}
+
+	u, err := strconv.ParseUint(str, 10, bits)
+	if err != nil {
+		return 0, 0, r.integerError(path, typ, str, err)
+	}
+	return 0, u, nil
+}
+
+func (r *jsonReader) integerError(path, typ, str string, err error) error {
+	if nerr, ok := err.(*strconv.NumError); ok && nerr.Err == strconv.ErrRange {
+		return r.errorf(path, "%s is out of the range of %s", str, typ)
+	}
+	return r.errorf(path, "Expected %s, not %q", typ, str)
+}
+
+func (r *jsonReader) float(path, typ string, js interface{}, bits int) (float64, error) {
+	switch js := js.(type) {
+	case json.Number:
+		f, err := strconv.ParseFloat(js.String(), bits)
+		if err != nil {
+			return 0, r.errorf(path, "%s is out of the range of %s", js, typ)
+		}
+		return f, nil
+	case string:
+		switch js {
+		case "NaN":
+			return math.NaN(), nil
+		case "+Inf", "Inf":
+			return math.Inf(1), nil
+		case "-Inf":
+			return math.Inf(-1), nil
+		}
+	}
+	return 0, r.mismatch(path, typ, js)
+}
+
+func (r *jsonReader) typ(path string, t *ast.Type, js interface{}) (interface{}, error) {
+	switch t.Kind {
+	case ast.TYPE_VOID:
+		if js != nil {
+			return nil, r.mismatch(path, "null", js)
+		}
+		return nil, nil
+
+	case ast.TYPE_BOOL:
+		b, ok := js.(bool)
+		if !ok {
+			return nil, r.mismatch(path, "a bool", js)
+		}
+		return b, nil
+
+	case ast.TYPE_INT:
+		i, _, err := r.integer(path, "an int", js, 32, true)
+		return int32(i), err
+
+	case ast.TYPE_UNSIGNED_INT:
+		_, u, err := r.integer(path, "an unsigned int", js, 32, false)
+		return uint32(u), err
+
+	case ast.TYPE_HYPER:
+		i, _, err := r.integer(path, "a hyper", js, 64, true)
+		return i, err
+
+	case ast.TYPE_UNSIGNED_HYPER:
+		_, u, err := r.integer(path, "an unsigned hyper", js, 64, false)
+		return u, err
+
+	case ast.TYPE_FLOAT:
+		f, err := r.float(path, "a float", js, 32)
+		return float32(f), err
+
+	case ast.TYPE_DOUBLE:
+		return r.float(path, "a double", js, 64)
+
+	case ast.TYPE_ENUM:
+		return r.enum(path, t.EnumSpec, js)
+
+	case ast.TYPE_STRUCT:
+		return r.structure(path, t.StructSpec, js)
+
+	case ast.TYPE_UNION:
+		return r.union(path, t.UnionSpec, js)
+
+	case ast.TYPE_TYPEDEF:
+		return r.decl(path, t.TypeDef, js)
+
+	case ast.TYPE_REF:
+		rt, err := resolve(r.c.spec, t)
+		if err != nil {
+			return nil, r.errorf(path, "%s", err)
+		}
+		return r.typ(path, rt, js)
+	}
+	return nil, r.errorf(path, "A %s must be declared as an array", t.Kind)
+}
+
+func (r *jsonReader) enum(path string, es *ast.EnumSpec, js interface{}) (interface{}, error) {
+	switch js := js.(type) {
+	case string:
+		if v, ok := es.GetValue(r.c.spec, js); ok {
+			return Enum{Name: js, Value: v}, nil
+		}
+
+		var names []string
+		for _, opt := range es.GetOptions(r.c.spec) {
+			names = append(names, opt.Name)
+		}
+		return nil, r.errorf(path, "Unknown enum value '%s' (expected one of %s)", js, strings.Join(names, ", "))
+
+	case json.Number:
+		i, _, err := r.integer(path, "an enum", js, 32, true)
+		if err != nil {
+			return nil, err
+		}
+
+		name := es.GetName(r.c.spec, int32(i))
+		if name == "" {
+			return nil, r.errorf(path, "%d is not a value of the enum", i)
+		}
+		return Enum{Name: name, Value: int32(i)}, nil
+	}
+	return nil, r.mismatch(path, "an enum value name", js)
+}
+
+func (r *jsonReader) object(path string, js interface{}) (map[string]interface{}, error) {
+	obj, ok := js.(map[string]interface{})
+	if !ok {
+		return nil, r.mismatch(path, "an object", js)
+	}
+	return obj, nil
+}
+
+func (r *jsonReader) structure(path string, ss *ast.StructSpec, js interface{}) (interface{}, error) {
+	obj, err := r.object(path, js)
+	if err != nil {
+		return nil, err
+	}
+
+	if name := firstUnknown(obj, func(name string) bool { return ss.HasMember(name) }); name != "" {
+		return nil, r.errorf(joinPath(path, name), "Unknown member '%s'", name)
+	}
+
+	s := make(map[string]interface{}, len(ss.Members))
+	for _, m := range ss.Members {
+		mjs, ok := obj[m.Name]
+		if !ok {
+			return nil, r.errorf(path, "Missing member '%s'", m.Name)
+		}
+
+		v, err := r.decl(joinPath(path, m.Name), m, mjs)
+		if err != nil {
+			return nil, err
+		}
+		s[m.Name] = v
+	}
+	return s, nil
+}
+
+// firstUnknown returns the first (in sorted order) key of an object for
+// which known returns false, or "" if there are none
+func firstUnknown(obj map[string]interface{}, known func(string) bool) string {
+	var unknown []string
+	for name := range obj {
+		if !known(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return ""
+	}
+	sort.Strings(unknown)
+	return unknown[0]
+}
+
+func (r *jsonReader) union(path string, us *ast.UnionSpec, js interface{}) (interface{}, error) {
+	obj, err := r.object(path, js)
+	if err != nil {
+		return nil, err
+	}
+
+	discName := us.Discriminant.Name
+	djs, ok := obj[discName]
+	if !ok {
+		return nil, r.errorf(path, "Missing discriminant '%s'", discName)
+	}
+	disc, err := r.decl(joinPath(path, discName), us.Discriminant, djs)
+	if err != nil {
+		return nil, err
+	}
+
+	dv, _ := discriminantValue(disc)
+	m, ok := arm(us, dv)
+	if !ok {
+		return nil, r.errorf(joinPath(path, discName), "No arm is selected by the discriminant %v", disc)
+	}
+
+	armName := m.Name
+	if m.IsVoid() {
+		armName = ""
+	}
+	if name := firstUnknown(obj, func(name string) bool { return name == discName || name == armName }); name != "" {
+		if armName == "" {
+			return nil, r.errorf(joinPath(path, name), "Unexpected arm '%s': the discriminant %v selects a void arm", name, disc)
+		}
+		return nil, r.errorf(joinPath(path, name), "Unexpected arm '%s': the discriminant %v selects the arm '%s'", name, disc, armName)
+	}
+
+	if armName == "" {
+		return &Union{Discriminant: disc}, nil
+	}
+
+	ajs, ok := obj[armName]
+	if !ok {
+		return nil, r.errorf(path, "Missing arm '%s', which is selected by the discriminant %v", armName, disc)
+	}
+	v, err := r.decl(joinPath(path, armName), m, ajs)
+	if err != nil {
+		return nil, err
+	}
+	return &Union{Discriminant: disc, Arm: armName, Value: v}, nil
+}
+
+// opaque decodes opaque data given as a string
+func (r *jsonReader) opaque(path string, js interface{}) ([]byte, error) {
+	str, ok := js.(string)
+	if !ok {
+		return nil, r.mismatch(path, "opaque data as a string", js)
+	}
+
+	var b []byte
+	var err error
+	if r.opts.Opaque == OpaqueBase64 {
+		b, err = base64.StdEncoding.DecodeString(str)
+	} else {
+		b, err = hex.DecodeString(str)
+	}
+	if err != nil {
+		return nil, r.errorf(path, "Invalid opaque data: %s", err)
+	}
+	return b, nil
+}
+
+// length checks the length of an array against its declaration
+func (r *jsonReader) length(path string, mod *ast.Declaration_Modifier, what string, n int) error {
+	switch mod.Kind {
+	case ast.DECLARATION_MODIFIER_FIXED:
+		if n != int(mod.Size) {
+			return r.errorf(path, "Expected exactly %d %s, not %d", mod.Size, what, n)
+		}
+	case ast.DECLARATION_MODIFIER_FLEXIBLE:
+		if n > int(mod.Size) {
+			return r.errorf(path, "Length %d exceeds the maximum of %d %s", n, mod.Size, what)
+		}
+	}
+	return nil
+}
+
+func (r *jsonReader) decl(path string, decl *ast.Declaration, js interface{}) (interface{}, error) {
+	mod := decl.Modifier
+	switch mod.Kind {
+	case ast.DECLARATION_MODIFIER_NONE:
+		return r.typ(path, decl.Type, js)
+
+	case ast.DECLARATION_MODIFIER_OPTIONAL:
+		if js == nil {
+			return nil, nil
+		}
+		return r.typ(path, decl.Type, js)
+	}
+
+	switch decl.Type.Kind {
+	case ast.TYPE_OPAQUE:
+		b, err := r.opaque(path, js)
+		if err != nil {
+			return nil, err
+		}
+		return b, r.length(path, mod, "bytes", len(b))
+
+	case ast.TYPE_STRING:
+		switch js := js.(type) {
+		case string:
+			return js, r.length(path, mod, "bytes", len(js))
+
+		case map[string]interface{}:
+			if name := firstUnknown(js, func(name string) bool { return name == "opaque" }); name != "" {
+				return nil, r.errorf(joinPath(path, name), "Unknown member '%s'", name)
+			}
+			ojs, ok := js["opaque"]
+			if !ok {
+				return nil, r.errorf(path, "Missing member 'opaque'")
+			}
+			b, err := r.opaque(joinPath(path, "opaque"), ojs)
+			if err != nil {
+				return nil, err
+			}
+			return string(b), r.length(path, mod, "bytes", len(b))
+		}
+		return nil, r.mismatch(path, "a string", js)
+	}
+
+	arr, ok := js.([]interface{})
+	if !ok {
+		return nil, r.mismatch(path, "an array", js)
+	}
+	if err := r.length(path, mod, "elements", len(arr)); err != nil {
+		return nil, err
+	}
+
+	vals := make([]interface{}, len(arr))
+	for i, ejs := range arr {
+		v, err := r.typ(indexPath(path, i), decl.Type, ejs)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
@@ -0,0 +1,63 @@
+package dynamic
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONStrings(t *testing.T) {
+	s := parseSpec(t, "typedef string str<>; struct s { string name<4>; str names<>; };")
+	c := newCodec(t, s, "s")
+
+	tests := []struct {
+		v    map[string]interface{}
+		opts JSONOptions
+		js   string
+	}{
+		{
+			map[string]interface{}{"name": "é", "names": []interface{}{"a\"b", "<>"}},
+			JSONOptions{},
+			`{"name":"é","names":["a\"b","<>"]}`,
+		},
+		{
+			map[string]interface{}{"name": "\xff\xfe", "names": []interface{}{"ok", "a\x80"}},
+			JSONOptions{},
+			`{"name":{"opaque":"fffe"},"names":["ok",{"opaque":"6180"}]}`,
+		},
+		{
+			map[string]interface{}{"name": "\xff\xfe", "names": []interface{}{}},
+			JSONOptions{Opaque: OpaqueBase64},
+			`{"name":{"opaque":"//4="},"names":[]}`,
+		},
+	}
+
+	for _, test := range tests {
+		js, err := c.ToJSON(test.v, test.opts)
+		if err != nil {
+			t.Errorf("%q: %v", test.v, err)
+			continue
+		} else if string(js) != test.js {
+			t.Errorf("%q: represented as %s, expected %s", test.v, js, test.js)
+		}
+
+		v, err := c.FromJSON(js, test.opts)
+		if err != nil {
+			t.Errorf("%s: %v", js, err)
+		} else if !reflect.DeepEqual(v, test.v) {
+			t.Errorf("%s: converted to %q, expected %q", js, v, test.v)
+		}
+	}
+
+	for js, want := range map[string]string{
+		`{"name":{"opaque":"0102030405"},"names":[]}`: "$.name: Length 5 exceeds the maximum of 4 bytes",
+		`{"name":{"opaque":"xx"},"names":[]}`:         "$.name.opaque: Invalid opaque data",
+		`{"name":{"bytes":"00"},"names":[]}`:          "$.name.bytes: Unknown member 'bytes'",
+		`{"name":{},"names":[]}`:                      "$.name: Missing member 'opaque'",
+		`{"name":1,"names":[]}`:                       "$.name: Expected a string, not a number",
+	} {
+		if _, err := c.FromJSON([]byte(js), JSONOptions{}); err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("%s: got error %v, expected %q", js, err, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package dynamic
+
+import (
+	"fmt"
+
+	"go.e43.eu/xdrgen/ast"
+)
+
+// RegionKind identifies what a region of encoded data holds
+type RegionKind int
+
+const (
+	// RegionValue holds the value of a bool, integer, float or enum
+	RegionValue RegionKind = iota
+	// RegionDiscriminant holds the discriminant of a union
+	RegionDiscriminant
+	// RegionLength holds the length of a variable length array, string or
+	// opaque data
+	RegionLength
+	// RegionFlag holds the flag which records whether an optional value is
+	// present
+	RegionFlag
+	// RegionData holds the bytes of a string or opaque data
+	RegionData
+	// RegionPadding holds the zero bytes which pad a string or opaque data
+	// to a multiple of 4 bytes
+	RegionPadding
+)
+
+var regionKindNames = [...]string{
+	RegionValue:        "value",
+	RegionDiscriminant: "discriminant",
+	RegionLength:       "length",
+	RegionFlag:         "flag",
+	RegionData:         "data",
+	RegionPadding:      "padding",
+}
+
+func (k RegionKind) String() string {
+	if k < 0 || int(k) >= len(regionKindNames) {
+		return fmt.Sprintf("RegionKind(%d)", int(k))
+	}
+	return regionKindNames[k]
+}
+
+// Region is a region of encoded data, as reported to the Trace function of
+// a Decoder
+type Region struct {
+	Kind RegionKind
+	// Offset is the offset of the region in the data read by the decoder
+	Offset int64
+	// Data is the bytes of the region
+	Data []byte
+	// Path locates the value which the region belongs to, as in Error
+	Path string
+	// Type describes the type of the value, as it would be written in a
+	// specification (such as "nfsstat3" or "opaque<8>")
+	Type string
+	// Value is the decoded value of the region: the value for RegionValue
+	// and RegionDiscriminant, the length (a uint32) for RegionLength, whether
+	// the value is present for RegionFlag, the string or []byte for
+	// RegionData and nil for RegionPadding
+	Value interface{}
+}
+
+// trace reports a region which has just been read to d.Trace
+func (d *Decoder) trace(kind RegionKind, off int64, data []byte, path, typ string, v interface{}) {
+	if d.Trace == nil {
+		return
+	}
+
+	if kind == RegionValue && d.discriminant {
+		kind = RegionDiscriminant
+	}
+	d.discriminant = false
+
+	d.Trace(&Region{
+		Kind:   kind,
+		Offset: off,
+		Data:   append([]byte(nil), data...),
+		Path:   path,
+		Type:   typ,
+		Value:  v,
+	})
+}
+
+var typeKeywords = map[ast.TypeKind]string{
+	ast.TYPE_VOID:           "void",
+	ast.TYPE_BOOL:           "bool",
+	ast.TYPE_INT:            "int",
+	ast.TYPE_UNSIGNED_INT:   "unsigned int",
+	ast.TYPE_HYPER:          "hyper",
+	ast.TYPE_UNSIGNED_HYPER: "unsigned hyper",
+	ast.TYPE_FLOAT:          "float",
+	ast.TYPE_DOUBLE:         "double",
+	ast.TYPE_STRING:         "string",
+	ast.TYPE_OPAQUE:         "opaque",
+	ast.TYPE_STRUCT:         "struct",
+	ast.TYPE_UNION:          "union",
+	ast.TYPE_ENUM:           "enum",
+}
+
+// describe returns a description of a type for a Region. Descriptions are
+// only needed when tracing, so are skipped otherwise
+func (d *Decoder) describe(t *ast.Type) string {
+	if d.Trace == nil {
+		return ""
+	}
+
+	switch t.Kind {
+	case ast.TYPE_REF:
+		if t.Ref < uint32(len(d.c.spec.Definitions)) {
+			return d.c.spec.Definitions[t.Ref].Name
+		}
+	case ast.TYPE_TYPEDEF:
+		return d.describeDecl(t.TypeDef)
+	}
+
+	if kw, ok := typeKeywords[t.Kind]; ok {
+		return kw
+	}
+	return t.Kind.String()
+}
+
+func (d *Decoder) describeDecl(decl *ast.Declaration) string {
+	if d.Trace == nil {
+		return ""
+	}
+
+	desc := d.describe(decl.Type)
+	switch m := decl.Modifier; m.Kind {
+	case ast.DECLARATION_MODIFIER_OPTIONAL:
+		desc += "*"
+	case ast.DECLARATION_MODIFIER_FIXED:
+		desc += fmt.Sprintf("[%d]", m.Size)
+	case ast.DECLARATION_MODIFIER_FLEXIBLE:
+		desc += fmt.Sprintf("<%d>", m.Size)
+	case ast.DECLARATION_MODIFIER_UNBOUNDED:
+		desc += "<>"
+	}
+	return desc
+}
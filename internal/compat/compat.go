@@ -0,0 +1,605 @@
+// Package compat compares two versions of a specification, in order to find
+// the changes which would prevent peers using different versions from
+// communicating.
+//
+// Definitions are matched by name. Types are compared by their encoding,
+// so renaming a member or replacing a type with an identical one is
+// compatible, while changing the type or order of members is not
+package compat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.e43.eu/xdrgen/ast"
+)
+
+// Change describes a difference between two versions of a specification
+type Change struct {
+	// Path identifies the item which changed, such as the name of a
+	// definition followed by the names of the members containing it,
+	// separated by dots
+	Path string
+	// Breaking is set if the change is not compatible on the wire
+	Breaking bool
+	// Message describes the change
+	Message string
+	// Location is the location of the item in the new specification, or in
+	// the old specification if it was removed
+	Location *ast.Location
+}
+
+func (c *Change) String() string {
+	kind := "compatible"
+	if c.Breaking {
+		kind = "breaking"
+	}
+
+	if c.Location != nil {
+		return fmt.Sprintf("%s: %s: '%s': %s", c.Location, kind, c.Path, c.Message)
+	}
+	return fmt.Sprintf("%s: '%s': %s", kind, c.Path, c.Message)
+}
+
+// Compare returns the changes made to the specification old to produce new.
+// The specifications should have been validated
+func Compare(old, new *ast.Specification) []*Change {
+	c := &comparer{
+		old:      old,
+		new:      new,
+		compared: make(map[[2]string]bool),
+	}
+
+	for _, od := range old.Definitions {
+		if od.Body.Kind == ast.DEFINITION_KIND_CONSTANT {
+			// Changes to constants are only significant where they are used
+			continue
+		}
+
+		c.loc = od.Location
+		nd := new.NamedDefinition(od.Name)
+		if nd == nil {
+			c.breaking(od.Name, "Definition removed")
+			continue
+		}
+		if nd.Location != nil {
+			c.loc = nd.Location
+		}
+
+		c.definition(od, nd)
+	}
+
+	for _, nd := range new.Definitions {
+		if nd.Body.Kind != ast.DEFINITION_KIND_CONSTANT && old.NamedDefinition(nd.Name) == nil {
+			c.loc = nd.Location
+			c.compatible(nd.Name, "Definition added")
+		}
+	}
+	return c.changes
+}
+
+// HasBreaking returns true if any of the changes are breaking
+func HasBreaking(changes []*Change) bool {
+	for _, c := range changes {
+		if c.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+type comparer struct {
+	old, new *ast.Specification
+	changes  []*Change
+	loc      *ast.Location
+	// compared records the pairs of differently named types which have
+	// been compared, so that recursive types are compared once. Types with
+	// the same name are compared as definitions
+	compared map[[2]string]bool
+}
+
+func (c *comparer) breaking(path, fmts string, args ...interface{}) {
+	c.changes = append(c.changes, &Change{
+		Path:     path,
+		Breaking: true,
+		Message:  fmt.Sprintf(fmts, args...),
+		Location: c.loc,
+	})
+}
+
+func (c *comparer) compatible(path, fmts string, args ...interface{}) {
+	c.changes = append(c.changes, &Change{
+		Path:     path,
+		Message:  fmt.Sprintf(fmts, args...),
+		Location: c.loc,
+	})
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func (c *comparer) definition(od, nd *ast.Definition) {
+	if od.Body.Kind != nd.Body.Kind {
+		c.breaking(od.Name, "Definition changed from %s to %s", kindName(od.Body.Kind), kindName(nd.Body.Kind))
+		return
+	}
+
+	switch od.Body.Kind {
+	case ast.DEFINITION_KIND_TYPE:
+		// Types which are never defined are reported by validation
+		if od.Body.Type != nil && nd.Body.Type != nil {
+			c.typ(od.Name, od.Body.Type, nd.Body.Type)
+		}
+	case ast.DEFINITION_KIND_PROGRAM:
+		c.program(od.Name, od.Body.ProgramSpec, nd.Body.ProgramSpec)
+	}
+}
+
+func kindName(k ast.DefinitionKind) string {
+	switch k {
+	case ast.DEFINITION_KIND_TYPE:
+		return "a type"
+	case ast.DEFINITION_KIND_CONSTANT:
+		return "a constant"
+	case ast.DEFINITION_KIND_PROGRAM:
+		return "a program"
+	}
+	return k.String()
+}
+
+func (c *comparer) program(path string, op, np *ast.ProgramSpec) {
+	if op.Number != np.Number {
+		c.breaking(path, "Program number changed from %d to %d", op.Number, np.Number)
+	}
+
+	for _, ov := range op.Versions {
+		vpath := joinPath(path, ov.Name)
+		nv := np.GetVersion(ov.Name)
+		if nv == nil {
+			c.breaking(vpath, "Version removed")
+			continue
+		}
+		if ov.Number != nv.Number {
+			c.breaking(vpath, "Version number changed from %d to %d", ov.Number, nv.Number)
+		}
+
+		for _, oproc := range ov.Procedures {
+			ppath := joinPath(vpath, oproc.Name)
+			nproc := nv.GetProcedure(oproc.Name)
+			if nproc == nil {
+				c.breaking(ppath, "Procedure removed")
+				continue
+			}
+			c.procedure(ppath, oproc, nproc)
+		}
+
+		for _, nproc := range nv.Procedures {
+			if ov.GetProcedure(nproc.Name) == nil {
+				c.compatible(joinPath(vpath, nproc.Name), "Procedure added")
+			}
+		}
+	}
+
+	for _, nv := range np.Versions {
+		if op.GetVersion(nv.Name) == nil {
+			c.compatible(joinPath(path, nv.Name), "Version added")
+		}
+	}
+}
+
+func (c *comparer) procedure(path string, op, np *ast.Procedure) {
+	if np.Location != nil {
+		defer func(loc *ast.Location) { c.loc = loc }(c.loc)
+		c.loc = np.Location
+	}
+
+	if op.Number != np.Number {
+		c.breaking(path, "Procedure number changed from %d to %d", op.Number, np.Number)
+	}
+
+	if len(op.Arguments) != len(np.Arguments) {
+		c.breaking(path, "Argument count changed from %d to %d", len(op.Arguments), len(np.Arguments))
+	} else {
+		for i := range op.Arguments {
+			c.typ(fmt.Sprintf("%s.argument%d", path, i+1), op.Arguments[i], np.Arguments[i])
+		}
+	}
+	c.typ(path+".result", op.Result, np.Result)
+}
+
+// resolve follows references and typedefs which don't modify their type,
+// returning the type which determines the encoding and the name of the last
+// definition followed (or "" if none was). It returns a nil type if a
+// reference can't be followed
+func resolve(s *ast.Specification, t *ast.Type) (*ast.Type, string) {
+	name := ""
+	for i := 0; i <= len(s.Definitions); i++ {
+		switch t.Kind {
+		case ast.TYPE_REF:
+			d, rt, err := t.FollowRef(s)
+			if err != nil || rt == nil {
+				return nil, ""
+			}
+			t, name = rt, d.Name
+		case ast.TYPE_TYPEDEF:
+			if t.TypeDef.Modifier.Kind != ast.DECLARATION_MODIFIER_NONE {
+				return t, name
+			}
+			t = t.TypeDef.Type
+		default:
+			return t, name
+		}
+	}
+	return nil, ""
+}
+
+func (c *comparer) typ(path string, ot, nt *ast.Type) {
+	odesc, ndesc := describe(c.old, ot), describe(c.new, nt)
+	ot, oname := resolve(c.old, ot)
+	nt, nname := resolve(c.new, nt)
+	if ot == nil || nt == nil {
+		return
+	}
+
+	if oname != "" && nname != "" {
+		key := [2]string{oname, nname}
+		if oname == nname && path != oname {
+			// Compared as a definition
+			return
+		} else if c.compared[key] {
+			return
+		}
+		c.compared[key] = true
+	}
+
+	if ot.Kind != nt.Kind {
+		c.breaking(path, "Type changed from %s to %s", odesc, ndesc)
+		return
+	}
+
+	switch ot.Kind {
+	case ast.TYPE_TYPEDEF:
+		c.modifier(path, ot.TypeDef.Modifier, nt.TypeDef.Modifier)
+		c.typ(path, ot.TypeDef.Type, nt.TypeDef.Type)
+	case ast.TYPE_STRUCT:
+		c.structure(path, ot.StructSpec, nt.StructSpec)
+	case ast.TYPE_UNION:
+		c.union(path, ot.UnionSpec, nt.UnionSpec)
+	case ast.TYPE_ENUM:
+		c.enum(path, ot.EnumSpec, nt.EnumSpec)
+	}
+}
+
+func (c *comparer) declaration(path string, od, nd *ast.Declaration) {
+	if nd.Location != nil {
+		defer func(loc *ast.Location) { c.loc = loc }(c.loc)
+		c.loc = nd.Location
+	}
+
+	if od.IsVoid() || nd.IsVoid() {
+		if od.IsVoid() != nd.IsVoid() {
+			c.breaking(path, "Type changed from %s to %s", describeDecl(c.old, od), describeDecl(c.new, nd))
+		}
+		return
+	}
+
+	c.modifier(path, od.Modifier, nd.Modifier)
+	c.typ(path, od.Type, nd.Type)
+}
+
+// bound returns the maximum length of a variable length array
+func bound(m *ast.Declaration_Modifier) uint32 {
+	if m.Kind == ast.DECLARATION_MODIFIER_UNBOUNDED {
+		return math.MaxUint32
+	}
+	return m.Size
+}
+
+func (c *comparer) modifier(path string, om, nm *ast.Declaration_Modifier) {
+	variable := func(m *ast.Declaration_Modifier) bool {
+		return m.Kind == ast.DECLARATION_MODIFIER_FLEXIBLE || m.Kind == ast.DECLARATION_MODIFIER_UNBOUNDED
+	}
+
+	switch {
+	case variable(om) && variable(nm):
+		switch ob, nb := bound(om), bound(nm); {
+		case nb < ob:
+			c.breaking(path, "Bound tightened from %s to %s", modifierSuffix(om), modifierSuffix(nm))
+		case nb > ob:
+			c.compatible(path, "Bound loosened from %s to %s", modifierSuffix(om), modifierSuffix(nm))
+		}
+
+	case om.Kind != nm.Kind:
+		c.breaking(path, "Declaration changed from %s to %s", modifierName(om), modifierName(nm))
+
+	case om.Kind == ast.DECLARATION_MODIFIER_FIXED && om.Size != nm.Size:
+		c.breaking(path, "Fixed size changed from %d to %d", om.Size, nm.Size)
+	}
+}
+
+func (c *comparer) structure(path string, os, ns *ast.StructSpec) {
+	oldNames := make(map[string]int)
+	for i, m := range os.Members {
+		oldNames[m.Name] = i
+	}
+	newNames := make(map[string]int)
+	for i, m := range ns.Members {
+		newNames[m.Name] = i
+	}
+
+	sameSet := len(os.Members) == len(ns.Members)
+	reordered := false
+	for i, m := range os.Members {
+		j, ok := newNames[m.Name]
+		sameSet = sameSet && ok
+		reordered = reordered || (ok && i != j)
+	}
+
+	switch {
+	case sameSet && reordered:
+		c.breaking(path, "Members reordered")
+		for _, om := range os.Members {
+			c.declaration(joinPath(path, om.Name), om, ns.Members[newNames[om.Name]])
+		}
+
+	case len(os.Members) != len(ns.Members):
+		var added, removed []string
+		for _, m := range ns.Members {
+			if _, ok := oldNames[m.Name]; !ok {
+				added = append(added, m.Name)
+			}
+		}
+		for _, m := range os.Members {
+			if _, ok := newNames[m.Name]; !ok {
+				removed = append(removed, m.Name)
+			}
+		}
+
+		msg := fmt.Sprintf("Member count changed from %d to %d", len(os.Members), len(ns.Members))
+		if len(added) > 0 {
+			msg += fmt.Sprintf("; added %v", added)
+		}
+		if len(removed) > 0 {
+			msg += fmt.Sprintf("; removed %v", removed)
+		}
+		c.breaking(path, "%s", msg)
+
+		// Members which were not moved may still be compared
+		for i, om := range os.Members {
+			if i < len(ns.Members) && ns.Members[i].Name == om.Name {
+				c.declaration(joinPath(path, om.Name), om, ns.Members[i])
+			}
+		}
+
+	default:
+		for i, om := range os.Members {
+			nm := ns.Members[i]
+			if om.Name != nm.Name {
+				loc := c.loc
+				if nm.Location != nil {
+					c.loc = nm.Location
+				}
+				c.compatible(joinPath(path, nm.Name), "Member renamed from '%s'", om.Name)
+				c.loc = loc
+			}
+			c.declaration(joinPath(path, nm.Name), om, nm)
+		}
+	}
+}
+
+func (c *comparer) enum(path string, oe, ne *ast.EnumSpec) {
+	newValues := make(map[string]int32)
+	for _, opt := range ne.GetOptions(c.new) {
+		newValues[opt.Name] = opt.Value
+	}
+
+	oldValues := make(map[string]bool)
+	for _, opt := range oe.GetOptions(c.old) {
+		oldValues[opt.Name] = true
+		switch v, ok := newValues[opt.Name]; {
+		case !ok:
+			c.breaking(joinPath(path, opt.Name), "Enum value removed")
+		case v != opt.Value:
+			c.breaking(joinPath(path, opt.Name), "Enum value renumbered from %d to %d", opt.Value, v)
+		}
+	}
+
+	for _, opt := range ne.GetOptions(c.new) {
+		if !oldValues[opt.Name] {
+			c.compatible(joinPath(path, opt.Name), "Enum value added")
+		}
+	}
+}
+
+func (c *comparer) union(path string, ou, nu *ast.UnionSpec) {
+	c.declaration(joinPath(path, nu.Discriminant.Name), ou.Discriminant, nu.Discriminant)
+
+	values := make(map[int32]bool)
+	for v := range ou.Options {
+		values[v] = true
+	}
+	for v := range nu.Options {
+		values[v] = true
+	}
+	sorted := make([]int32, 0, len(values))
+	for v := range values {
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for _, v := range sorted {
+		oarm, oexplicit := arm(ou, v)
+		narm, nexplicit := arm(nu, v)
+		label := caseLabel(c.new, nu, v)
+		if label == "" {
+			label = caseLabel(c.old, ou, v)
+		}
+		if label == "" {
+			label = strconv.FormatInt(int64(v), 10)
+		}
+		apath := path + ".case(" + label + ")"
+		if narm != nil && narm.Name != "" {
+			apath = joinPath(path, narm.Name)
+		} else if oarm != nil && oarm.Name != "" {
+			apath = joinPath(path, oarm.Name)
+		}
+
+		switch {
+		case oarm == nil && narm != nil:
+			c.compatible(apath, "Arm added for case %s", label)
+		case oarm != nil && narm == nil:
+			c.breaking(apath, "Arm removed for case %s", label)
+		case oarm != nil && narm != nil && (oexplicit || nexplicit):
+			c.declaration(apath, oarm, narm)
+		}
+	}
+
+	switch {
+	case ou.DefaultMember != nil && nu.DefaultMember == nil:
+		c.breaking(path, "Default arm removed")
+	case ou.DefaultMember == nil && nu.DefaultMember != nil:
+		c.compatible(path, "Default arm added")
+	case ou.DefaultMember != nil:
+		oarm, narm := ou.Members[*ou.DefaultMember], nu.Members[*nu.DefaultMember]
+		c.declaration(joinPath(path, "default"), oarm, narm)
+	}
+}
+
+// arm returns the arm of a union selected by the discriminant value v, and
+// whether it was selected explicitly (rather than by default)
+func arm(u *ast.UnionSpec, v int32) (*ast.Declaration, bool) {
+	if m, ok := u.Options[v]; ok {
+		return u.Members[m], true
+	} else if u.DefaultMember != nil {
+		return u.Members[*u.DefaultMember], false
+	}
+	return nil, false
+}
+
+// caseLabel formats a case label of a union. It returns "" if the value is
+// not one of those of an enum discriminant
+func caseLabel(s *ast.Specification, u *ast.UnionSpec, v int32) string {
+	dt, _ := resolve(s, u.Discriminant.Type)
+	if dt != nil {
+		switch dt.Kind {
+		case ast.TYPE_ENUM:
+			return dt.EnumSpec.GetName(s, v)
+		case ast.TYPE_UNSIGNED_INT:
+			return strconv.FormatUint(uint64(uint32(v)), 10)
+		case ast.TYPE_BOOL:
+			return strconv.FormatBool(v != 0)
+		}
+	}
+	return strconv.FormatInt(int64(v), 10)
+}
+
+var typeKeywords = map[ast.TypeKind]string{
+	ast.TYPE_VOID:           "void",
+	ast.TYPE_BOOL:           "bool",
+	ast.TYPE_INT:            "int",
+	ast.TYPE_UNSIGNED_INT:   "unsigned int",
+	ast.TYPE_HYPER:          "hyper",
+	ast.TYPE_UNSIGNED_HYPER: "unsigned hyper",
+	ast.TYPE_FLOAT:          "float",
+	ast.TYPE_DOUBLE:         "double",
+	ast.TYPE_STRING:         "string",
+	ast.TYPE_OPAQUE:         "opaque",
+	ast.TYPE_STRUCT:         "struct",
+	ast.TYPE_UNION:          "union",
+	ast.TYPE_ENUM:           "enum",
+}
+
+// describe returns a description of a type for messages, as it would be
+// written in a specification
+func describe(s *ast.Specification, t *ast.Type) string {
+	switch t.Kind {
+	case ast.TYPE_REF:
+		if t.Ref < uint32(len(s.Definitions)) {
+			return s.Definitions[t.Ref].Name
+		}
+	case ast.TYPE_TYPEDEF:
+		return describeDecl(s, t.TypeDef)
+	}
+
+	if kw, ok := typeKeywords[t.Kind]; ok {
+		return kw
+	}
+	return t.Kind.String()
+}
+
+func describeDecl(s *ast.Specification, d *ast.Declaration) string {
+	desc := describe(s, d.Type)
+	if d.Modifier.Kind == ast.DECLARATION_MODIFIER_OPTIONAL {
+		return desc + "*"
+	}
+	return desc + modifierSuffix(d.Modifier)
+}
+
+func modifierSuffix(m *ast.Declaration_Modifier) string {
+	switch m.Kind {
+	case ast.DECLARATION_MODIFIER_FIXED:
+		return fmt.Sprintf("[%d]", m.Size)
+	case ast.DECLARATION_MODIFIER_FLEXIBLE:
+		return fmt.Sprintf("<%d>", m.Size)
+	case ast.DECLARATION_MODIFIER_UNBOUNDED:
+		return "<>"
+	}
+	return ""
+}
+
+func modifierName(m *ast.Declaration_Modifier) string {
+	switch m.Kind {
+	case ast.DECLARATION_MODIFIER_NONE:
+		return "a single value"
+	case ast.DECLARATION_MODIFIER_OPTIONAL:
+		return "optional"
+	case ast.DECLARATION_MODIFIER_FIXED:
+		return "a fixed length array " + modifierSuffix(m)
+	}
+	return "a variable length array " + modifierSuffix(m)
+}
+
+// Allowlist is a list of patterns matching the paths of breaking changes
+// which have been accepted. Patterns use the syntax of path.Match, so
+// "nfs_fh4.*" matches changes to the members of nfs_fh4
+type Allowlist []string
+
+// ReadAllowlist reads an allowlist containing a pattern on each line. Blank
+// lines and lines beginning with '#' are ignored
+func ReadAllowlist(rdr io.Reader) (Allowlist, error) {
+	var a Allowlist
+	sc := bufio.NewScanner(rdr)
+	for line := 1; sc.Scan(); line++ {
+		pattern := strings.TrimSpace(sc.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Line %d: Invalid pattern '%s': %s", line, pattern, err)
+		}
+		a = append(a, pattern)
+	}
+	return a, sc.Err()
+}
+
+// Allows returns true if the path of a change matches a pattern of the
+// allowlist
+func (a Allowlist) Allows(c *Change) bool {
+	for _, pattern := range a {
+		if ok, _ := path.Match(pattern, c.Path); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+package compat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.e43.eu/xdrgen/ast"
+	"go.e43.eu/xdrgen/parser"
+)
+
+func parse(t *testing.T, name, src string) *ast.Specification {
+	s, err := parser.ParseSpecification(strings.NewReader(src), name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return s
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		// changes are formatted as by Change.String, without locations
+		changes []string
+	}{
+		{
+			"Unchanged",
+			"struct s { int a; string b<>; };",
+			"struct s { int a; string b<>; };",
+			nil,
+		},
+		{
+			"Member type changed",
+			"struct s { int a; };",
+			"struct s { hyper a; };",
+			[]string{"breaking: 's.a': Type changed from int to hyper"},
+		},
+		{
+			"Members reordered",
+			"struct s { int a; hyper b; };",
+			"struct s { hyper b; int a; };",
+			[]string{"breaking: 's': Members reordered"},
+		},
+		{
+			"Member added",
+			"struct s { int a; };",
+			"struct s { int a; int b; };",
+			[]string{"breaking: 's': Member count changed from 1 to 2; added [b]"},
+		},
+		{
+			"Member removed",
+			"struct s { int a; int b; };",
+			"struct s { int a; };",
+			[]string{"breaking: 's': Member count changed from 2 to 1; removed [b]"},
+		},
+		{
+			"Member renamed",
+			"struct s { int a; };",
+			"struct s { int b; };",
+			[]string{"compatible: 's.b': Member renamed from 'a'"},
+		},
+		{
+			"Identical typedef",
+			"struct s { unsigned int a; };",
+			"typedef unsigned int uint32; struct s { uint32 a; };",
+			[]string{"compatible: 'uint32': Definition added"},
+		},
+		{
+			"Enum value renumbered",
+			"enum e { A = 1, B = 2 };",
+			"enum e { A = 1, B = 3 };",
+			[]string{"breaking: 'e.B': Enum value renumbered from 2 to 3"},
+		},
+		{
+			"Enum value removed",
+			"enum e { A = 1, B = 2 };",
+			"enum e { A = 1 };",
+			[]string{"breaking: 'e.B': Enum value removed"},
+		},
+		{
+			"Enum value added",
+			"enum e { A = 1 };",
+			"enum e { A = 1, B = 2 };",
+			[]string{"compatible: 'e.B': Enum value added"},
+		},
+		{
+			"Union arm type changed",
+			"union u switch (int d) { case 1: int x; default: void; };",
+			"union u switch (int d) { case 1: float x; default: void; };",
+			[]string{"breaking: 'u.x': Type changed from int to float"},
+		},
+		{
+			"Union arm added",
+			"union u switch (int d) { case 1: int x; };",
+			"union u switch (int d) { case 1: int x; case 2: hyper y; };",
+			[]string{"compatible: 'u.y': Arm added for case 2"},
+		},
+		{
+			"Union arm removed",
+			"union u switch (int d) { case 1: int x; case 2: hyper y; };",
+			"union u switch (int d) { case 1: int x; };",
+			[]string{"breaking: 'u.y': Arm removed for case 2"},
+		},
+		{
+			"Default arm added",
+			"union u switch (int d) { case 1: int x; };",
+			"union u switch (int d) { case 1: int x; default: void; };",
+			[]string{"compatible: 'u': Default arm added"},
+		},
+		{
+			"Discriminant type changed",
+			"union u switch (int d) { case 1: void; };",
+			"union u switch (unsigned int d) { case 1: void; };",
+			[]string{"breaking: 'u.d': Type changed from int to unsigned int"},
+		},
+		{
+			"Fixed size changed",
+			"typedef opaque fh[32];",
+			"typedef opaque fh[64];",
+			[]string{"breaking: 'fh': Fixed size changed from 32 to 64"},
+		},
+		{
+			"Fixed size changed by a constant",
+			"const N = 4; struct s { int a[N]; };",
+			"const N = 5; struct s { int a[N]; };",
+			[]string{"breaking: 's.a': Fixed size changed from 4 to 5"},
+		},
+		{
+			"Bound tightened",
+			"struct s { string name<>; };",
+			"struct s { string name<255>; };",
+			[]string{"breaking: 's.name': Bound tightened from <> to <255>"},
+		},
+		{
+			"Bound loosened",
+			"struct s { int a<4>; };",
+			"struct s { int a<8>; };",
+			[]string{"compatible: 's.a': Bound loosened from <4> to <8>"},
+		},
+		{
+			"Array made optional",
+			"struct s { int a<4>; };",
+			"struct s { int *a; };",
+			[]string{"breaking: 's.a': Declaration changed from a variable length array <4> to optional"},
+		},
+		{
+			"Definition kind changed",
+			"struct s { int a; };",
+			"program s { version V { void NULL(void) = 0; } = 1; } = 1;",
+			[]string{"breaking: 's': Definition changed from a type to a program"},
+		},
+		{
+			"Definitions added and removed",
+			"struct a { int x; };",
+			"struct b { int x; };",
+			[]string{"breaking: 'a': Definition removed", "compatible: 'b': Definition added"},
+		},
+		{
+			"Nested change",
+			"struct inner { int x; }; struct outer { inner i; };",
+			"struct inner { hyper x; }; struct outer { inner i; };",
+			[]string{"breaking: 'inner.x': Type changed from int to hyper"},
+		},
+		{
+			"Procedures",
+			"program P { version V { void NULL(void) = 0; int GET(int) = 1; } = 1; } = 100;",
+			"program P { version V { void NULL(void) = 0; hyper GET(int) = 2; int PUT(int, int) = 3; } = 1; } = 100;",
+			[]string{
+				"breaking: 'P.V.GET': Procedure number changed from 1 to 2",
+				"breaking: 'P.V.GET.result': Type changed from int to hyper",
+				"compatible: 'P.V.PUT': Procedure added",
+			},
+		},
+		{
+			"Versions",
+			"program P { version V1 { void NULL(void) = 0; } = 1; } = 100;",
+			"program P { version V2 { void NULL(void) = 0; } = 2; } = 101;",
+			[]string{
+				"breaking: 'P': Program number changed from 100 to 101",
+				"breaking: 'P.V1': Version removed",
+				"compatible: 'P.V2': Version added",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		changes := Compare(parse(t, "old.x", test.old), parse(t, "new.x", test.new))
+
+		var got []string
+		breaking := false
+		for _, c := range changes {
+			c.Location = nil
+			got = append(got, c.String())
+			breaking = breaking || c.Breaking
+		}
+		if !reflect.DeepEqual(got, test.changes) {
+			t.Errorf("%s: got changes\n\t%s\nexpected\n\t%s", test.name, strings.Join(got, "\n\t"), strings.Join(test.changes, "\n\t"))
+		}
+		if HasBreaking(changes) != breaking {
+			t.Errorf("%s: HasBreaking returned %v", test.name, !breaking)
+		}
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	a, err := ReadAllowlist(strings.NewReader("# Accepted changes\n\ns.*\n  fh  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Allowlist{"s.*", "fh"}); !reflect.DeepEqual(a, want) {
+		t.Fatalf("Read %q, expected %q", a, want)
+	}
+
+	for path, allowed := range map[string]bool{
+		"s.a":    true,
+		"s.a.b":  true,
+		"s":      false,
+		"fh":     true,
+		"fh.x":   false,
+		"other":  false,
+		"t.s.a":  false,
+		"s.case": true,
+	} {
+		if a.Allows(&Change{Path: path, Breaking: true}) != allowed {
+			t.Errorf("Allows(%q) returned %v", path, !allowed)
+		}
+	}
+
+	if _, err := ReadAllowlist(strings.NewReader("ok\n[\n")); err == nil || !strings.Contains(err.Error(), "Line 2") {
+		t.Errorf("Invalid pattern returned error %v", err)
+	}
+}
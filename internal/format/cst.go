@@ -0,0 +1,314 @@
+// Package format implements the canonical formatting of XDR specifications.
+//
+// Specifications are parsed into a concrete syntax tree, which unlike the AST
+// retains the comments, blank lines, passthrough lines and preprocessor
+// directives of the source, and printed with consistent layout
+package format
+
+import (
+	"io"
+	"strings"
+
+	"go.e43.eu/xdrgen/internal/lexer"
+)
+
+// Node is a node of the concrete syntax tree: a *Comment, *Line, *Blank
+// or *Decl
+type Node interface {
+	node()
+}
+
+// Comment is a comment on a line of its own
+type Comment struct {
+	Text string
+}
+
+// Line is a passthrough line or preprocessor directive, which is printed
+// verbatim
+type Line struct {
+	Text string
+}
+
+// Blank stands for one or more blank lines separating nodes
+type Blank struct{}
+
+// Decl is a declaration, definition, enum value, union case label or
+// attribute set, up to and including its terminator
+type Decl struct {
+	Elems []*Elem
+	// Trailing is the comment following the declaration on the same line
+	Trailing string
+	// Inline is set for case labels followed by their arm on the same line
+	Inline bool
+}
+
+// Elem is an element of a declaration: either a token (which may be a
+// comment) or a block enclosed in braces
+type Elem struct {
+	Tok   *lexer.Token
+	Block *Block
+	// Break is set if a line break following the element is kept. Breaks
+	// are kept after attribute sets and line comments. Attribute sets which
+	// span multiple lines are printed with an attribute on each line
+	Break bool
+}
+
+func (*Comment) node() {}
+func (*Line) node()    {}
+func (*Blank) node()   {}
+func (*Decl) node()    {}
+
+// BlockKind identifies the construct a block belongs to, which determines
+// how its declarations are terminated and laid out
+type BlockKind int
+
+const (
+	FileBlock BlockKind = iota
+	StructBlock
+	UnionBlock
+	EnumBlock
+	ProgramBlock
+	VersionBlock
+)
+
+var blockKeywords = map[rune]BlockKind{
+	lexer.TokStruct: StructBlock,
+	lexer.TokUnion:  UnionBlock,
+	lexer.TokEnum:   EnumBlock,
+}
+
+// Block is a sequence of nodes. The file itself is a block of kind
+// FileBlock; other blocks are enclosed in braces
+type Block struct {
+	Kind  BlockKind
+	Nodes []Node
+}
+
+// Parse parses the concrete syntax tree of the specification read from rdr.
+// Only the structure of the specification is checked; its declarations are
+// not validated. Errors are returned as a diag.List
+func Parse(rdr io.Reader, filename string) (*Block, error) {
+	p := &cstParser{l: lexer.NewLexer(rdr, filename)}
+	p.l.Raw = true
+
+	b, err := p.block(FileBlock)
+	diags := p.l.Diagnostics()
+	if err != nil {
+		diags.AddError(p.l.Position(), err)
+	}
+
+	if diags.HasErrors() {
+		diags.Sort()
+		return nil, diags
+	}
+	return b, nil
+}
+
+type cstParser struct {
+	l *lexer.Lexer
+	// lastLine is the line on which the last token consumed ended
+	lastLine int
+}
+
+func (p *cstParser) next() *lexer.Token {
+	t := p.l.Next()
+	p.lastLine = t.End.Line
+	return t
+}
+
+func (p *cstParser) block(kind BlockKind) (*Block, error) {
+	b := &Block{Kind: kind}
+	for {
+		t := p.l.Peek()
+		switch {
+		case t.ID == lexer.TokEOF && kind != FileBlock:
+			return nil, t.Errorf("Unexpected end of file (Expected \"}\")")
+		case t.ID == lexer.TokEOF:
+			return b, nil
+		case t.ID == '}' && kind != FileBlock:
+			return b, nil
+		}
+
+		if len(b.Nodes) > 0 && t.Position.Line > p.lastLine+1 {
+			b.Nodes = append(b.Nodes, &Blank{})
+		}
+
+		switch t.ID {
+		case lexer.TokComment:
+			p.next()
+			b.Nodes = append(b.Nodes, &Comment{Text: t.Value})
+
+		case lexer.TokLine:
+			p.next()
+			b.Nodes = append(b.Nodes, &Line{Text: t.Value})
+
+		default:
+			d, err := p.decl(kind)
+			if err != nil {
+				return nil, err
+			}
+			b.Nodes = append(b.Nodes, d)
+		}
+	}
+}
+
+func (p *cstParser) decl(kind BlockKind) (*Decl, error) {
+	d := new(Decl)
+	first := p.l.Peek()
+	isLabel := kind == UnionBlock && (first.ID == lexer.TokCase || first.ID == lexer.TokDefault)
+
+	// depth counts the brackets, parentheses and chevrons which are open,
+	// and attrDepth the depth at which an attribute set was opened
+	depth, attrDepth := 0, -1
+	multiline := false
+	for {
+		t := p.l.Peek()
+		switch t.ID {
+		case lexer.TokEOF:
+			return nil, t.Errorf("Unexpected end of file in declaration")
+
+		case lexer.TokLine:
+			return nil, t.Errorf("Unexpected %s in declaration", t)
+
+		case '}':
+			if kind == EnumBlock && len(d.Elems) > 0 {
+				// The terminator of the last enum value is optional
+				return d, nil
+			}
+			return nil, t.Errorf("Unexpected \"}\" in declaration")
+
+		case '{':
+			p.next()
+			inner, ok := kindOf(d, kind)
+			if !ok {
+				return nil, t.Errorf("Unexpected \"{\" in declaration")
+			}
+
+			b, err := p.block(inner)
+			if err != nil {
+				return nil, err
+			}
+			p.next()
+			d.Elems = append(d.Elems, &Elem{Block: b})
+			continue
+		}
+
+		p.next()
+		e := &Elem{Tok: t}
+		d.Elems = append(d.Elems, e)
+
+		switch t.ID {
+		case '[':
+			if isAttributeStart(d) {
+				attrDepth = depth
+				multiline = p.l.Peek().Position.Line > t.End.Line
+				e.Break = multiline
+			}
+			depth++
+		case '(', '<':
+			depth++
+		case ',':
+			e.Break = multiline && depth == attrDepth+1
+		case ']':
+			depth--
+			if depth == attrDepth {
+				if multiline {
+					d.Elems[len(d.Elems)-2].Break = true
+				}
+				attrDepth, multiline = -1, false
+				e.Break = p.l.Peek().Position.Line > t.End.Line
+			}
+		case ')', '>':
+			depth--
+		case lexer.TokComment:
+			e.Break = strings.HasPrefix(t.Value, "//")
+		}
+
+		terminated := false
+		switch {
+		case depth > 0:
+		case isLabel:
+			terminated = t.ID == ':'
+		case kind == EnumBlock:
+			terminated = t.ID == ','
+		case first.ID == '#':
+			// Spec attributes have no terminator
+			terminated = t.ID == ']'
+		default:
+			terminated = t.ID == ';'
+		}
+
+		if terminated {
+			e.Break = false
+			switch c := p.l.Peek(); {
+			case c.Position.Line > t.End.Line:
+			case c.ID == lexer.TokComment:
+				p.next()
+				d.Trailing = c.Value
+			case isLabel && c.ID != lexer.TokLine && c.ID != '}':
+				d.Inline = true
+			}
+			return d, nil
+		}
+	}
+}
+
+// isAttributeStart returns true if the '[' just added to a declaration opens
+// an attribute set. Attribute sets begin declarations (ignoring comments),
+// and may follow '#' or 'typedef'
+func isAttributeStart(d *Decl) bool {
+	elems := d.Elems[:len(d.Elems)-1]
+	for len(elems) > 0 && elems[len(elems)-1].Tok != nil && elems[len(elems)-1].Tok.ID == lexer.TokComment {
+		elems = elems[:len(elems)-1]
+	}
+	if len(elems) == 0 {
+		return true
+	}
+
+	prev := elems[len(elems)-1].Tok
+	return prev != nil && (prev.ID == lexer.TokTypedef || prev.ID == '#')
+}
+
+// kindOf returns the kind of a block opened within a declaration in a block
+// of kind parent, which is given by the last keyword introducing a block.
+// program and version are contextual keywords, so only introduce blocks when
+// they begin a declaration in the file or a program respectively
+func kindOf(d *Decl, parent BlockKind) (BlockKind, bool) {
+	if t := firstWord(d); t != nil {
+		switch {
+		case parent == FileBlock && t.Is(lexer.TokProgram):
+			return ProgramBlock, true
+		case parent == ProgramBlock && t.Is(lexer.TokVersion):
+			return VersionBlock, true
+		}
+	}
+
+	for i := len(d.Elems) - 1; i >= 0; i-- {
+		if t := d.Elems[i].Tok; t != nil {
+			if kind, ok := blockKeywords[t.ID]; ok {
+				return kind, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// firstWord returns the first token of a declaration, ignoring comments and
+// any attribute set preceding it
+func firstWord(d *Decl) *lexer.Token {
+	depth := 0
+	for _, e := range d.Elems {
+		switch t := e.Tok; {
+		case t == nil:
+			return nil
+		case t.ID == lexer.TokComment:
+		case t.ID == '[':
+			depth++
+		case t.ID == ']':
+			depth--
+		case depth == 0:
+			return t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"go.e43.eu/xdrgen/internal/lexer"
+)
+
+// Fprint prints the concrete syntax tree of a specification to w.
+//
+// Nested blocks are indented using tabs. Within runs of consecutive
+// declarations, the names of members and procedures, the values of constants
+// and enum values, and trailing comments are aligned
+func Fprint(w io.Writer, b *Block) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', tabwriter.DiscardEmptyColumns|tabwriter.TabIndent|tabwriter.StripEscape)
+	p := &printer{w: tw, tw: tw}
+	p.block(b, 0)
+	if p.err != nil {
+		return p.err
+	}
+	return tw.Flush()
+}
+
+// Source formats the specification src
+func Source(src []byte, filename string) ([]byte, error) {
+	b, err := Parse(bytes.NewReader(src), filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := Fprint(&buf, b); err != nil {
+		return nil, err
+	}
+
+	// Formatting only changes the whitespace between tokens
+	if !sameTokens(src, buf.Bytes()) {
+		return nil, fmt.Errorf("%s: Formatting changed the tokens of the specification", filename)
+	}
+	return buf.Bytes(), nil
+}
+
+func sameTokens(a, b []byte) bool {
+	la := lexer.NewLexer(bytes.NewReader(a), "")
+	lb := lexer.NewLexer(bytes.NewReader(b), "")
+	la.Raw, lb.Raw = true, true
+
+	for {
+		ta, tb := la.Next(), lb.Next()
+		switch {
+		case ta.ID != tb.ID || ta.Value != tb.Value:
+			return false
+		case ta.ID == lexer.TokEOF:
+			return true
+		}
+	}
+}
+
+var escape = string([]byte{tabwriter.Escape})
+
+type printer struct {
+	w   io.Writer
+	tw  *tabwriter.Writer
+	err error
+}
+
+// flush ends the current runs of aligned columns
+func (p *printer) flush() {
+	if p.err == nil {
+		p.err = p.tw.Flush()
+	}
+}
+
+func (p *printer) write(s string) {
+	if p.err == nil {
+		_, p.err = io.WriteString(p.w, s)
+	}
+}
+
+// escaped writes text which is not to be interpreted by the tabwriter. Text
+// containing newlines is written line by line, so that it doesn't disturb
+// the alignment of the lines which follow
+func (p *printer) escaped(s string) {
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			p.write("\n")
+		}
+		if line != "" {
+			p.write(escape + line + escape)
+		}
+	}
+}
+
+func (p *printer) indent(n int) {
+	p.write(strings.Repeat("\t", n))
+}
+
+// block prints the nodes of a block, at the indentation of its enclosing
+// declaration
+func (p *printer) block(b *Block, indent int) {
+	inner := indent
+	if b.Kind != FileBlock {
+		inner++
+	}
+
+	// inline is set if the next declaration follows a case label on the
+	// same line
+	inline := false
+	// armLine is set if the previous line was a case label followed by its
+	// arm. The tab between them starts a column, which must not be shared
+	// with the indentation of other lines
+	armLine := false
+	// Top level definitions are only aligned with others of the same kind
+	var prevKind rune
+	for i, n := range b.Nodes {
+		switch n := n.(type) {
+		case *Blank:
+			p.write("\n")
+
+		case *Comment:
+			if armLine {
+				p.flush()
+				armLine = false
+			}
+			p.indent(labelIndent(b, i, inner))
+			p.escaped(n.Text)
+			p.write("\n")
+
+		case *Line:
+			p.escaped(n.Text)
+			p.write("\n")
+
+		case *Decl:
+			if kind := n.Elems[0].Tok; b.Kind == FileBlock && kind != nil {
+				if prevKind != 0 && kind.ID != prevKind {
+					p.flush()
+				}
+				prevKind = kind.ID
+			}
+
+			if inline {
+				inline = false
+				p.decl(b.Kind, n, inner, true)
+				p.write("\n")
+				continue
+			}
+
+			startsArm := false
+			if n.Inline && i+1 < len(b.Nodes) {
+				_, startsArm = b.Nodes[i+1].(*Decl)
+			}
+			if startsArm != armLine {
+				p.flush()
+				armLine = startsArm
+			}
+
+			p.decl(b.Kind, n, labelIndent(b, i, inner), false)
+			if startsArm {
+				p.write("\t")
+				inline = true
+				continue
+			}
+			p.write("\n")
+		}
+	}
+}
+
+// labelIndent returns the indentation of node i of a block. The case labels
+// of unions, and comments preceding them, are outdented by one level
+func labelIndent(b *Block, i, indent int) int {
+	if b.Kind != UnionBlock {
+		return indent
+	}
+
+	for _, n := range b.Nodes[i:] {
+		if d, ok := n.(*Decl); ok {
+			if isLabel(d) {
+				return indent - 1
+			}
+			break
+		}
+	}
+	return indent
+}
+
+func isLabel(d *Decl) bool {
+	t := d.Elems[0].Tok
+	return t != nil && (t.ID == lexer.TokCase || t.ID == lexer.TokDefault)
+}
+
+// decl prints a declaration. If inline is set, it follows a case label on
+// the same line, so only the lines after the first are indented
+func (p *printer) decl(kind BlockKind, d *Decl, indent int, inline bool) {
+	if !inline {
+		p.indent(indent)
+	}
+	align := alignment(kind, d)
+
+	// extra is the indentation of the attributes of an attribute set
+	// printed on multiple lines
+	extra := 0
+	tw := &tokenWriter{p: p}
+	for i, e := range d.Elems {
+		if e.Block != nil {
+			// The columns of the lines before the block don't continue into
+			// it (which matters if it follows a case label)
+			p.write(" {\n")
+			p.flush()
+			p.block(e.Block, indent)
+			p.indent(indent)
+			p.write("}")
+			tw.prev = &lexer.Token{ID: '}'}
+			continue
+		}
+
+		tw.write(e.Tok, i == align)
+		if e.Break && i+1 < len(d.Elems) {
+			switch next := d.Elems[i+1].Tok; {
+			case e.Tok.ID == '[':
+				extra++
+			case next != nil && next.ID == ']' && extra > 0:
+				extra--
+			}
+
+			p.write("\n")
+			p.indent(indent + extra)
+			if e.Tok.ID == lexer.TokComment {
+				// Continuations of a declaration broken by a comment
+				p.write("\t")
+			}
+			tw.prev, tw.comment = nil, false
+		}
+	}
+
+	if d.Trailing != "" {
+		p.write("\t")
+		p.escaped(d.Trailing)
+	}
+}
+
+// alignment returns the index of the element of a declaration which is to
+// be aligned with those of the declarations around it, or -1 if none is.
+// For constants and enum values this is the '=' preceding the value; for
+// typedefs, members and procedures it is the start of the name
+func alignment(kind BlockKind, d *Decl) int {
+	start := 0
+	for i, e := range d.Elems {
+		switch {
+		case e.Block != nil:
+			return -1
+		case e.Tok.ID == lexer.TokComment:
+			return -1
+		case e.Break:
+			start = i + 1
+		}
+	}
+
+	elems := d.Elems[start:]
+	if len(elems) == 0 {
+		return -1
+	}
+
+	// Attribute sets on the same line as the declaration would widen its
+	// columns
+	first := elems[0].Tok.ID
+	if first == '[' || (first == lexer.TokTypedef && len(elems) > 1 && elems[1].Tok.ID == '[') {
+		return -1
+	}
+
+	switch {
+	case kind == EnumBlock, kind == FileBlock && first == lexer.TokConst:
+		for i, e := range elems {
+			if e.Tok.ID == '=' {
+				return start + i
+			}
+		}
+		return -1
+
+	case kind == UnionBlock && isLabel(d),
+		kind == FileBlock && first != lexer.TokTypedef:
+		return -1
+	}
+
+	// The name is the last identifier preceding the size, parameters,
+	// value or terminator of the declaration
+	name, depth := -1, 0
+scan:
+	for i, e := range elems {
+		switch id := e.Tok.ID; {
+		case depth == 0 && name >= 0 && (id == '(' || id == '<' || id == '['):
+			break scan
+		case id == '(' || id == '<' || id == '[':
+			depth++
+		case id == ')' || id == '>' || id == ']':
+			depth--
+		case depth == 0 && id == lexer.TokIdent:
+			name = i
+		case depth == 0 && (id == '=' || id == ';'):
+			break scan
+		}
+	}
+
+	switch {
+	case name <= 0:
+		return -1
+	case elems[name-1].Tok.ID == '*':
+		name--
+	}
+	if name == 0 {
+		return -1
+	}
+	return start + name
+}
+
+// tokenWriter writes the tokens of a declaration, separated by spaces
+// where appropriate
+type tokenWriter struct {
+	p *printer
+	// prev is the previous token written on the line, or nil at the start of
+	// a line
+	prev *lexer.Token
+	// depth is the number of brackets, parentheses and chevrons open
+	depth int
+	// expr is set within the value of a constant or enum value, or a case
+	// label
+	expr bool
+	// unary is set if the previous token was a unary operator
+	unary bool
+	// comment is set if the previous token was a comment
+	comment bool
+}
+
+// write writes a token. If aligned is set, the token begins a new cell
+func (w *tokenWriter) write(t *lexer.Token, aligned bool) {
+	switch {
+	case aligned:
+		w.p.write("\t")
+	case w.prev != nil && (w.comment || w.space(t)):
+		w.p.write(" ")
+	}
+
+	switch t.ID {
+	case lexer.TokComment, lexer.TokStringConst, lexer.TokCharConst:
+		w.p.escaped(t.Value)
+	default:
+		w.p.write(t.Value)
+	}
+
+	isUnary := false
+	switch t.ID {
+	case '(', '[', '<':
+		w.depth++
+	case ')', ']', '>':
+		w.depth--
+	case '=', lexer.TokCase:
+		w.expr = true
+	case ',', ';', ':':
+		w.expr = false
+	case '-', '+', '~':
+		isUnary = w.operand()
+	case '*':
+		// Pointers, rather than multiplication
+		isUnary = !w.expr && w.depth == 0
+	}
+
+	w.comment = t.ID == lexer.TokComment
+	if !w.comment {
+		w.unary = isUnary
+		w.prev = t
+	}
+}
+
+// operand returns true if the next token is expected to be an operand (and
+// therefore an operator is unary)
+func (w *tokenWriter) operand() bool {
+	if w.prev == nil {
+		return true
+	}
+
+	switch w.prev.ID {
+	case '(', '[', '<', '=', ',', ':', lexer.TokCase,
+		'+', '-', '*', '/', '%', '&', '|', '^', '~', lexer.TokShl, lexer.TokShr:
+		return true
+	}
+	return false
+}
+
+// space returns true if t should be separated from the previous token by a
+// space
+func (w *tokenWriter) space(t *lexer.Token) bool {
+	switch {
+	case w.unary:
+		return false
+	case w.prev.ID == '#', w.prev.ID == '(', w.prev.ID == '[', w.prev.ID == '<':
+		return false
+	}
+
+	switch t.ID {
+	case ';', ',', ')', ']', '>', ':', '<':
+		return false
+	case '(', '[':
+		return w.prev.ID != lexer.TokIdent
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package format
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Update the golden files in testdata")
+
+// TestGolden formats each testdata/*.input file, comparing the result with
+// the corresponding .golden file
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/*.input")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range inputs {
+		src, err := ioutil.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := Source(src, input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+
+		golden := strings.TrimSuffix(input, ".input") + ".golden"
+		if *update {
+			if err := ioutil.WriteFile(golden, out, 0666); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, want) {
+			t.Errorf("%s: formatted as\n%s\nexpected\n%s", input, out, want)
+		}
+
+		// Formatting formatted source doesn't change it
+		again, err := Source(out, golden)
+		if err != nil {
+			t.Errorf("%s: %v", golden, err)
+		} else if !bytes.Equal(again, out) {
+			t.Errorf("%s: formatting is not idempotent; reformatted as\n%s", input, again)
+		}
+	}
+}
+
+func TestSourceInlineArms(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			"Labels of different widths",
+			"union u switch (int d) { case 0: int x; case 100: hyper y; };\n",
+			"union u switch (int d) {\ncase 0:   int   x;\ncase 100: hyper y;\n};\n",
+		},
+		{
+			"Arm following inline arms",
+			"union u switch (int d) {\ncase 0: int x;\ncase 100: hyper y;\ncase 2:\nvoid;\n};\n",
+			"union u switch (int d) {\ncase 0:   int   x;\ncase 100: hyper y;\ncase 2:\n\tvoid;\n};\n",
+		},
+		{
+			"Inline arm following an arm",
+			"union u switch (int d) {\ncase 2:\nvoid;\ncase 100: int x;\n};\n",
+			"union u switch (int d) {\ncase 2:\n\tvoid;\ncase 100: int x;\n};\n",
+		},
+		{
+			"Nested union",
+			"struct s { union switch (int d) { case 100: int x;\ncase 2:\nvoid; } u; };\n",
+			"struct s {\n\tunion switch (int d) {\n\tcase 100: int x;\n\tcase 2:\n\t\tvoid;\n\t} u;\n};\n",
+		},
+	}
+
+	for _, test := range tests {
+		out, err := Source([]byte(test.src), "test.x")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if string(out) != test.want {
+			t.Errorf("%s: formatted as\n%s\nexpected\n%s", test.name, out, test.want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"go/format"
 	"io"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -20,7 +21,14 @@ func DocComment(a ast.Attributes, def string) string {
 	}
 
 	lines := strings.Split(doc, "\n")
-	return "// " + strings.Join(lines, "\n //")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = "//"
+		} else {
+			lines[i] = "// " + line
+		}
+	}
+	return strings.Join(lines, "\n")
 }
 
 func GenSpecification(s *ast.Specification) ([]byte, error) {
@@ -40,14 +48,27 @@ func GenSpecification(s *ast.Specification) ([]byte, error) {
 func genSpecification(w io.Writer, s *ast.Specification) error {
 	packageName := s.Attributes.GetStringDefault("go_package", "x")
 
+	imports, err := goImports(s)
+	if err != nil {
+		return err
+	}
+
 	if err := headerTemplate.Execute(w, map[string]interface{}{
 		"Doc":         DocComment(s.Attributes, fmt.Sprintf("%s is an autogenerated XDR package", packageName)),
 		"PackageName": packageName,
+		"Imports":     imports,
+		"RPC":         hasPrograms(s),
 	}); err != nil {
 		return err
 	}
 
 	for _, d := range s.Definitions {
+		// Skip imported definitions - these are generated alongside the
+		// specification which defines them
+		if d.IsImported() {
+			continue
+		}
+
 		// Skip enums - we will generate their definitions while generating the enum itself
 		if d.Body.Kind == ast.DEFINITION_KIND_CONSTANT && d.Body.Constant.Type == ast.CONST_ENUM {
 			continue
@@ -64,7 +85,9 @@ func genSpecification(w io.Writer, s *ast.Specification) error {
 
 func GenDefinition(w io.Writer, s *ast.Specification, d *ast.Definition) (err error) {
 	defer func() {
-		if err != nil {
+		if err != nil && d.Location != nil {
+			err = fmt.Errorf("%s: Rendering '%s': %v", d.Location, d.Name, err)
+		} else if err != nil {
 			err = fmt.Errorf("Rendering '%s': %v", d.Name, err)
 		}
 	}()
@@ -75,6 +98,9 @@ func GenDefinition(w io.Writer, s *ast.Specification, d *ast.Definition) (err er
 	case ast.DEFINITION_KIND_CONSTANT:
 		return GenValueDefinition(w, d.Name, d.Body.Constant, d.Attributes)
 
+	case ast.DEFINITION_KIND_PROGRAM:
+		return GenProgramDefinition(w, s, d.Name, d.Body.ProgramSpec, d.Attributes)
+
 	default:
 		return errors.New("Unknown definition kind")
 	}
@@ -101,7 +127,7 @@ func GenTypeDefinition(w io.Writer, s *ast.Specification, name string, t *ast.Ty
 }
 
 func GenTypedefDefinition(w io.Writer, s *ast.Specification, name string, t *ast.Declaration, a ast.Attributes) error {
-	decl, tags, err := GenTypedefDeclaration(s, t)
+	decl, _, err := GenTypedefDeclaration(s, t)
 	if err != nil {
 		return err
 	}
@@ -114,26 +140,15 @@ func GenTypedefDefinition(w io.Writer, s *ast.Specification, name string, t *ast
 		}
 	}
 
-	_, err = fmt.Fprintf(w, "type %s\n", decl)
-
-	// We have tags that need applying, so we need to generate proxy
-	// MarshalXDR/UnmarshalXDR methods
-	//
-	// TODO: Implement specialised/less generic support for types like string/opaque
-	//       so we avoid having to go through the generic marshaller indirections
-	if len(tags) > 0 {
-		return typedefProxyTemplate.Execute(w, map[string]interface{}{
-			"Specification": s,
-			"TypeName":      name,
-			"Decl":          t,
-		})
+	if _, err := fmt.Fprintf(w, "type %s\n", decl); err != nil {
+		return err
 	}
-	return err
+	return GenTypedefMarshaler(w, s, name, t)
 }
 
 func GenEnumDefinition(w io.Writer, s *ast.Specification, name string, es *ast.EnumSpec, a ast.Attributes) error {
 	options := es.GetOptions(s)
-	values := make(map[uint32]string, len(options))
+	values := make(map[int32]string, len(options))
 	for _, m := range options {
 		if _, exists := values[m.Value]; !exists {
 			values[m.Value] = m.Name
@@ -167,6 +182,7 @@ func NameIfAnonymous(w io.Writer, s *ast.Specification, parentName string, d *as
 			Type: &nType,
 		},
 		Attributes: d.Attributes,
+		Location:   d.Location,
 	})
 	if err != nil {
 		return err
@@ -202,12 +218,16 @@ func GenStructDefinition(w io.Writer, s *ast.Specification, name string, ss *ast
 		}
 	}
 
-	return structTemplate.Execute(w, map[string]interface{}{
+	err := structTemplate.Execute(w, map[string]interface{}{
 		"Doc":           DocComment(a, fmt.Sprintf("%s is struct %s", CamelCase(name), name)),
 		"TypeName":      name,
 		"Members":       ss.Members,
 		"Specification": s,
 	})
+	if err != nil {
+		return err
+	}
+	return GenStructMarshaler(w, s, name, ss)
 }
 
 func GenUnionDefinition(w io.Writer, s *ast.Specification, name string, us *ast.UnionSpec, a ast.Attributes) error {
@@ -226,20 +246,35 @@ func GenUnionDefinition(w io.Writer, s *ast.Specification, name string, us *ast.
 		return err
 	}
 
-	var discrimEnum *ast.EnumSpec
+	var (
+		discrimEnum *ast.EnumSpec
+		enumQual    string
+	)
 	if discrimType.Kind == ast.TYPE_ENUM {
 		discrimEnum = discrimType.EnumSpec
+		if discrimEnum.Count > 0 {
+			enumQual, err = goQualifier(s, s.Definitions[discrimEnum.Base])
+			if err != nil {
+				return err
+			}
+		}
 	}
 
+	labels := make(map[int32]string)
 	optNameToField := make(map[string]string)
 	for value, membPos := range us.Options {
 		var name string
 		if discrimEnum != nil {
-			name = CamelCase(discrimEnum.GetName(s, value))
+			if n := discrimEnum.GetName(s, value); n != "" {
+				name = enumQual + CamelCase(n)
+			}
+		} else if discrimType.Kind == ast.TYPE_BOOL {
+			name = strconv.FormatBool(value != 0)
 		}
 		if name == "" {
-			name = strconv.FormatUint(uint64(value), 10)
+			name = discriminantValue(discrimType, value)
 		}
+		labels[value] = name
 		optNameToField[name] = us.Members[membPos].Name
 	}
 
@@ -248,24 +283,50 @@ func GenUnionDefinition(w io.Writer, s *ast.Specification, name string, us *ast.
 		annotatedMembers[i] = &UnionDeclaration{decl: d}
 	}
 
+	variants := make([][]int32, len(us.Members))
 	for value, membPos := range us.Options {
-		m := annotatedMembers[membPos]
-		m.variants = append(m.variants, value)
+		variants[membPos] = append(variants[membPos], value)
 	}
 
+	// Options is a map, so sort our variants to keep our output stable
+	for i, m := range annotatedMembers {
+		vs := variants[i]
+		sort.Slice(vs, func(i, j int) bool { return vs[i] < vs[j] })
+		for _, v := range vs {
+			m.variants = append(m.variants, discriminantValue(discrimType, v))
+		}
+	}
+
+	var defaultMember *ast.Declaration
 	if us.DefaultMember != nil {
 		annotatedMembers[*us.DefaultMember].isDefault = true
+		defaultMember = us.Members[*us.DefaultMember]
 	}
 
-	return unionTemplate.Execute(w, map[string]interface{}{
+	err = unionTemplate.Execute(w, map[string]interface{}{
 		"Doc":              DocComment(a, fmt.Sprintf("%s is union %s", CamelCase(name), name)),
 		"TypeName":         name,
 		"Discriminant":     us.Discriminant,
 		"AnnotatedMembers": annotatedMembers,
 		"Members":          us.Members,
 		"NameToField":      optNameToField,
+		"Default":          defaultMember,
 		"Specification":    s,
 	})
+	if err != nil {
+		return err
+	}
+	return GenUnionMarshaler(w, s, name, us, labels)
+}
+
+// discriminantValue formats a union case value as a value of the
+// discriminant type. Case values of unsigned discriminants above the range of
+// an int are stored as the int with the same encoding
+func discriminantValue(discrimType *ast.Type, value int32) string {
+	if discrimType.Kind == ast.TYPE_UNSIGNED_INT {
+		return strconv.FormatUint(uint64(uint32(value)), 10)
+	}
+	return strconv.FormatInt(int64(value), 10)
 }
 
 func GenValueDefinition(w io.Writer, name string, v *ast.Constant, a ast.Attributes) error {
@@ -279,3 +340,45 @@ func GenValueDefinition(w io.Writer, name string, v *ast.Constant, a ast.Attribu
 	_, err := fmt.Fprintf(w, "const %s = %s\n", CamelCase(name), GoValue(v))
 	return err
 }
+
+// Used to generate the program, version and procedure number constants
+// of a program
+var programTemplate = compileTemplate("program", `
+{{- $ProgName := .Name}}
+{{.Doc}}
+const {{GoName .Name}} = {{.Program.Number}}
+{{- range .Program.Versions}}
+
+{{DocComment .Attributes (printf "%s is version %d of program %s" (GoName .Name) .Number $ProgName)}}
+const {{GoName .Name}} = {{.Number}}
+
+// Procedures of {{GoName .Name}}
+const (
+{{- range .Procedures}}
+	{{- with DocComment .Attributes ""}}
+	{{.}}
+	{{- end}}
+	{{GoName .Name}} = {{.Number}}
+{{- end}}
+)
+{{- end}}
+`)
+
+func GenProgramDefinition(w io.Writer, s *ast.Specification, name string, p *ast.ProgramSpec, a ast.Attributes) error {
+	err := programTemplate.Execute(w, map[string]interface{}{
+		"Doc":     DocComment(a, fmt.Sprintf("%s is program %s", CamelCase(name), name)),
+		"Name":    name,
+		"Program": p,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, v := range p.Versions {
+		fmt.Fprintln(w)
+		if err := GenVersionStubs(w, s, name, v); err != nil {
+			return fmt.Errorf("Version '%s': %v", v.Name, err)
+		}
+	}
+	return nil
+}
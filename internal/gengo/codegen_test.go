@@ -0,0 +1,131 @@
+package gengo_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.e43.eu/xdr"
+	"go.e43.eu/xdrgen/internal/gengo"
+	"go.e43.eu/xdrgen/internal/gengo/testdata/signed"
+	"go.e43.eu/xdrgen/parser"
+)
+
+//go:generate xdrgen -Ggo testdata/signed/signed.x
+
+// TestGenerated checks that the code generated for the specifications in
+// testdata, which is tested below, is up to date
+func TestGenerated(t *testing.T) {
+	specs, err := filepath.Glob("testdata/*/*.x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range specs {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := parser.ParseSpecification(f, name)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		got, err := gengo.GenSpecification(s)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		want, err := ioutil.ReadFile(name + ".go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s.go is out of date (run go generate)", name)
+		}
+	}
+}
+
+func TestSignedValues(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		data []byte
+	}{
+		{"Negative enum", signed.NFS3ERR_X, []byte{0xff, 0xff, 0xff, 0xff}},
+		{"Minimum enum", signed.NFS3ERR_MIN, []byte{0x80, 0, 0, 0}},
+		{"Negative case", &signed.SignedRes{Status: -1, X: 5}, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 5}},
+		{"Void negative case", &signed.SignedRes{Status: -2147483648}, []byte{0x80, 0, 0, 0}},
+		{"Unsigned case", &signed.UnsignedRes{Status: 0xffffffff, X: 6}, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 6}},
+		{"Negative enum case", &signed.EnumRes{Status: signed.NFS3ERR_X, X: 7}, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 7}},
+	}
+
+	for _, test := range tests {
+		data, err := xdr.Marshal(test.v)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		} else if !bytes.Equal(data, test.data) {
+			t.Errorf("%s: encoded as %x, expected %x", test.name, data, test.data)
+		}
+
+		v := reflect.New(reflect.Indirect(reflect.ValueOf(test.v)).Type())
+		if err := xdr.Read(bytes.NewReader(data), v.Interface()); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if got := reflect.Indirect(reflect.ValueOf(test.v)).Interface(); !reflect.DeepEqual(v.Elem().Interface(), got) {
+			t.Errorf("%s: decoded %+v, expected %+v", test.name, v.Elem().Interface(), got)
+		}
+	}
+
+	if s := signed.NFS3ERR_X.String(); s != "NFS3ERR_X" {
+		t.Errorf("NFS3ERR_X.String() = %q", s)
+	}
+	if s := signed.Nfsstat3(-2).String(); s != "-2" {
+		t.Errorf("Nfsstat3(-2).String() = %q", s)
+	}
+
+	var u signed.UnsignedRes
+	if err := xdr.Read(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xfe}), &u); err == nil {
+		t.Error("Decoded an UnsignedRes with an invalid discriminant")
+	}
+}
+
+// TestUnionVariantsStable checks that the case labels of union arms, which are
+// held in a map, are generated in order
+func TestUnionVariantsStable(t *testing.T) {
+	const src = `union u switch (int d) {
+case 9: case 3: case 7: case 1: case 5:
+	int odd;
+case 8: case 2: case 6: case 0: case 4:
+	void;
+};`
+
+	var first []byte
+	for i := 0; i < 10; i++ {
+		s, err := parser.ParseSpecification(strings.NewReader(src), "stable.x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := gengo.GenSpecification(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if first == nil {
+			first = out
+			for _, tag := range []string{`xdr:"union:0,2,4,6,8"`, `xdr:"union:1,3,5,7,9"`} {
+				if !bytes.Contains(out, []byte(tag)) {
+					t.Errorf("Generated code doesn't contain the tag %s:\n%s", tag, out)
+				}
+			}
+		} else if !bytes.Equal(out, first) {
+			t.Fatalf("Generated different code for the same specification:\n%s\nand\n%s", first, out)
+		}
+	}
+}
@@ -64,7 +64,7 @@ func GenUnionSwitchDeclaration(spec *ast.Specification, d *ast.Declaration) (str
 
 type UnionDeclaration struct {
 	decl      *ast.Declaration
-	variants  []uint32
+	variants  []string
 	isDefault bool
 }
 
@@ -82,7 +82,7 @@ func genDeclarationCore(
 	spec *ast.Specification,
 	d *ast.Declaration,
 	mode declMode,
-	variants []uint32,
+	variants []string,
 ) (string, []string, error) {
 	var (
 		s    string
@@ -93,15 +93,50 @@ func genDeclarationCore(
 	case declModeUnionSwitch:
 		tags = append(tags, "union:switch")
 	case declModeUnionOption:
-		variantStrs := make([]string, len(variants))
-		for i, v := range variants {
-			variantStrs[i] = fmt.Sprintf("%d", v)
-		}
-		tags = append(tags, fmt.Sprintf("union:%s", strings.Join(variantStrs, ",")))
+		tags = append(tags, fmt.Sprintf("union:%s", strings.Join(variants, ",")))
 	case declModeUnionDefault:
 		tags = append(tags, fmt.Sprintf("union:default"))
 	}
 
+	typ, typeTags, err := goDeclarationType(spec, d)
+	if err != nil {
+		return "", nil, err
+	}
+	tags = append(tags, typeTags...)
+	s = fmt.Sprintf("%s %s", CamelCase(d.Name), typ)
+
+	if mode != declModeTypedef {
+		omitEmpty := ""
+		if (mode == declModeUnionOption) != (d.Modifier.Kind == ast.DECLARATION_MODIFIER_OPTIONAL) {
+			omitEmpty = ",omitempty"
+		}
+		xdrt := ""
+		if len(tags) > 0 {
+			xdrt = fmt.Sprintf("xdr:\"%s\"", strings.Join(tags, "/"))
+		}
+
+		if d.Name == "" {
+			// Void union arms are unexported, so have no JSON representation
+			// (and go vet rejects a json tag on them)
+			s = fmt.Sprintf("%s `%s`", s, xdrt)
+		} else if xdrt != "" {
+			s = fmt.Sprintf("%s `%s json:\"%s%s\"`", s, xdrt, d.Name, omitEmpty)
+		} else {
+			s = fmt.Sprintf("%s `json:\"%s%s\"`", s, d.Name, omitEmpty)
+		}
+	}
+
+	comment := DocComment(d.Attributes, "")
+	if comment != "" {
+		s = fmt.Sprintf("%s\n%s", comment, s)
+	}
+
+	return s, tags, nil
+}
+
+// goDeclarationType returns the Go type of a declaration, and the tags which
+// need to be applied to it
+func goDeclarationType(spec *ast.Specification, d *ast.Declaration) (typ string, tags []string, err error) {
 	if d.Attributes.GetString("mode") == "map" {
 		if err := checkMapLikeDef(spec, d); err != nil {
 			return "", nil, err
@@ -126,9 +161,9 @@ func genDeclarationCore(
 			return "", nil, err
 		}
 
-		s = fmt.Sprintf("%s map[%s]%s%s", CamelCase(d.Name), keyType, valPfx, valType)
+		typ = fmt.Sprintf("map[%s]%s%s", keyType, valPfx, valType)
 	} else if d.Type.Kind == ast.TYPE_STRING {
-		s = fmt.Sprintf("%s string", CamelCase(d.Name))
+		typ = "string"
 		switch d.Modifier.Kind {
 		case ast.DECLARATION_MODIFIER_NONE, ast.DECLARATION_MODIFIER_OPTIONAL:
 			return "", nil, fmt.Errorf("Non-array string")
@@ -142,12 +177,12 @@ func genDeclarationCore(
 		case ast.DECLARATION_MODIFIER_NONE, ast.DECLARATION_MODIFIER_OPTIONAL:
 			return "", nil, fmt.Errorf("Non-array opaque")
 		case ast.DECLARATION_MODIFIER_FIXED:
-			s = fmt.Sprintf("%s [%d]byte", CamelCase(d.Name), d.Modifier.Size)
+			typ = fmt.Sprintf("[%d]byte", d.Modifier.Size)
 		case ast.DECLARATION_MODIFIER_FLEXIBLE:
-			s = fmt.Sprintf("%s []byte", CamelCase(d.Name))
+			typ = "[]byte"
 			tags = append(tags, fmt.Sprintf("maxlen:%d", d.Modifier.Size))
 		case ast.DECLARATION_MODIFIER_UNBOUNDED:
-			s = fmt.Sprintf("%s []byte", CamelCase(d.Name))
+			typ = "[]byte"
 		}
 		tags = append(tags, "opaque")
 	} else {
@@ -169,25 +204,8 @@ func genDeclarationCore(
 		case ast.DECLARATION_MODIFIER_UNBOUNDED:
 			pfx = "[]" + pfx
 		}
-		s = fmt.Sprintf("%s %s%s", CamelCase(d.Name), pfx, typeName)
-	}
-
-	if mode != declModeTypedef {
-		omitEmpty := ""
-		if (mode == declModeUnionOption) != (d.Modifier.Kind == ast.DECLARATION_MODIFIER_OPTIONAL) {
-			omitEmpty = ",omitempty"
-		}
-		xdrt := ""
-		if len(tags) > 0 {
-			xdrt = fmt.Sprintf("xdr:\"%s\" ", strings.Join(tags, "/"))
-		}
-		s = fmt.Sprintf("%s `%sjson:\"%s%s\"`", s, xdrt, d.Name, omitEmpty)
-	}
-
-	comment := DocComment(d.Attributes, "")
-	if comment != "" {
-		s = fmt.Sprintf("%s\n%s", comment, s)
+		typ = pfx + typeName
 	}
 
-	return s, tags, nil
+	return typ, tags, nil
 }
@@ -0,0 +1,664 @@
+package gengo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"go.e43.eu/xdrgen/ast"
+)
+
+// The maximum depth to which typedefs of pointer types will be expanded
+const maxTypedefDepth = 64
+
+// The most bytes of opaque data, and elements of arrays, which are allocated
+// at once when decoding a length read from the data, so that a corrupt
+// length can't allocate much more memory than the data holds
+const (
+	maxOpaqueChunk = 1 << 16
+	maxSliceChunk  = 1 << 10
+)
+
+// marshalGen generates the bodies of MarshalXDR and UnmarshalXDR methods,
+// so that generated types are encoded without using reflection.
+//
+// Marshalling code reads the value from a Go expression, while unmarshalling
+// code writes the value to an (addressable) Go expression
+type marshalGen struct {
+	s     *ast.Specification
+	w     strings.Builder
+	vars  int
+	depth int
+	// usesErr is set if the generated code needs an err variable to be declared
+	usesErr bool
+}
+
+func newMarshalGen(s *ast.Specification) *marshalGen {
+	return &marshalGen{s: s}
+}
+
+func (g *marshalGen) printf(fmts string, params ...interface{}) {
+	fmt.Fprintf(&g.w, fmts, params...)
+	g.w.WriteByte('\n')
+}
+
+// check emits a call which returns an error, returning it if non-nil
+func (g *marshalGen) check(fmts string, params ...interface{}) {
+	g.printf("if err := %s; err != nil {\nreturn err\n}", fmt.Sprintf(fmts, params...))
+}
+
+// decode emits a call to a decoder method, assigning the result to expr
+func (g *marshalGen) decode(expr, method string) {
+	g.usesErr = true
+	g.printf("if %s, err = d.%s(); err != nil {\nreturn err\n}", expr, method)
+}
+
+// tmp returns a new unique variable name
+func (g *marshalGen) tmp(prefix string) string {
+	g.vars++
+	return fmt.Sprintf("%s%d", prefix, g.vars)
+}
+
+// String returns the generated code
+func (g *marshalGen) String() string {
+	if g.usesErr {
+		return "var err error\n" + g.w.String()
+	}
+	return g.w.String()
+}
+
+// isPointerTypedef returns true if the Go type generated for a typedef is a
+// pointer type, and therefore may not have methods
+func isPointerTypedef(s *ast.Specification, d *ast.Declaration) bool {
+	for i := 0; i < maxTypedefDepth; i++ {
+		switch d.Modifier.Kind {
+		case ast.DECLARATION_MODIFIER_OPTIONAL:
+			return true
+		case ast.DECLARATION_MODIFIER_NONE:
+		default:
+			return false
+		}
+
+		if d.Type.Kind != ast.TYPE_REF || d.Attributes.GetString("mode") == "map" {
+			return false
+		}
+
+		_, rt, err := d.Type.FollowRef(s)
+		if err != nil {
+			return false
+		}
+
+		switch rt.Kind {
+		case ast.TYPE_STRUCT, ast.TYPE_UNION:
+			return true
+		case ast.TYPE_TYPEDEF:
+			d = rt.TypeDef
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// typedefInline returns the typedef referenced by t if it has no methods,
+// and so needs to be marshalled inline along with the Go type it is
+// generated as
+func (g *marshalGen) typedefInline(t *ast.Type) (*ast.Declaration, string, error) {
+	_, rt, err := t.FollowRef(g.s)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if rt.Kind != ast.TYPE_TYPEDEF || !isPointerTypedef(g.s, rt.TypeDef) {
+		return nil, "", nil
+	}
+
+	g.depth++
+	if g.depth > maxTypedefDepth {
+		return nil, "", fmt.Errorf("Typedefs nested too deeply")
+	}
+
+	typ, _, err := goDeclarationType(g.s, rt.TypeDef)
+	return rt.TypeDef, typ, err
+}
+
+func (g *marshalGen) checkMaxLen(expr string, d *ast.Declaration, path string) {
+	if d.Modifier.Kind == ast.DECLARATION_MODIFIER_FLEXIBLE {
+		g.printf("if len(%s) > %d {\nreturn fmt.Errorf(\"%s: length %%d exceeds maximum of %d\", len(%s))\n}",
+			expr, d.Modifier.Size, path, d.Modifier.Size, expr)
+	}
+}
+
+func (g *marshalGen) decodeLen(d *ast.Declaration, path string) string {
+	n := g.tmp("n")
+	g.printf("%s, err := d.DecodeUnsignedInt()\nif err != nil {\nreturn err\n}", n)
+	if d.Modifier.Kind == ast.DECLARATION_MODIFIER_FLEXIBLE {
+		g.printf("if %s > %d {\nreturn fmt.Errorf(\"%s: length %%d exceeds maximum of %d\", %s)\n}",
+			n, d.Modifier.Size, path, d.Modifier.Size, n)
+	}
+	return n
+}
+
+// isChunked returns true if the declaration is longer than max elements,
+// and so needs to be allocated in chunks as it is decoded
+func isChunked(d *ast.Declaration, max uint32) bool {
+	switch d.Modifier.Kind {
+	case ast.DECLARATION_MODIFIER_UNBOUNDED:
+		return true
+	case ast.DECLARATION_MODIFIER_FLEXIBLE:
+		return d.Modifier.Size > max
+	}
+	return false
+}
+
+// decodeOpaqueChunks generates code to decode n bytes of opaque data into
+// the []byte variable b, in chunks of at most maxOpaqueChunk bytes. The
+// chunks are a multiple of 4 bytes, so only the last is padded
+func (g *marshalGen) decodeOpaqueChunks(b, n string) {
+	c := g.tmp("c")
+	g.printf("%s := []byte{}", b)
+	g.printf("for uint32(len(%s)) < %s {", b, n)
+	g.printf("%s := %s - uint32(len(%s))\nif %s > %d {\n%s = %d\n}", c, n, b, c, maxOpaqueChunk, c, maxOpaqueChunk)
+	g.printf("%s = append(%s, make([]byte, %s)...)", b, b, c)
+	g.check("d.DecodeFixedOpaque(%s[uint32(len(%s))-%s:])", b, b, c)
+	g.printf("}")
+}
+
+// Marshal generates code to encode the declaration d, which is read from expr
+func (g *marshalGen) Marshal(d *ast.Declaration, expr, path string) error {
+	if d.Attributes.GetString("mode") == "map" {
+		return g.marshalMap(d, expr, path)
+	}
+
+	switch d.Type.Kind {
+	case ast.TYPE_VOID:
+		return nil
+
+	case ast.TYPE_STRING, ast.TYPE_OPAQUE:
+		bytes := expr
+		if d.Type.Kind == ast.TYPE_STRING {
+			bytes = fmt.Sprintf("[]byte(%s)", expr)
+		}
+
+		switch d.Modifier.Kind {
+		case ast.DECLARATION_MODIFIER_FIXED:
+			if d.Type.Kind == ast.TYPE_STRING {
+				g.printf("if len(%s) != %d {\nreturn fmt.Errorf(\"%s: length %%d is not %d\", len(%s))\n}",
+					expr, d.Modifier.Size, path, d.Modifier.Size, expr)
+			} else {
+				bytes = expr + "[:]"
+			}
+		case ast.DECLARATION_MODIFIER_FLEXIBLE, ast.DECLARATION_MODIFIER_UNBOUNDED:
+			g.checkMaxLen(expr, d, path)
+			g.check("e.EncodeUnsignedInt(uint32(len(%s)))", expr)
+		default:
+			return fmt.Errorf("Non-array %s", d.Type.Kind)
+		}
+		g.check("e.EncodeFixedOpaque(%s)", bytes)
+		return nil
+	}
+
+	switch d.Modifier.Kind {
+	case ast.DECLARATION_MODIFIER_NONE:
+		return g.marshalValue(d.Type, expr, path)
+
+	case ast.DECLARATION_MODIFIER_OPTIONAL:
+		pfx, _, err := GoTypeName(g.s, d.Type)
+		if err != nil {
+			return err
+		}
+
+		g.check("e.EncodeBool(%s != nil)", expr)
+		g.printf("if %s != nil {", expr)
+		if pfx == "" {
+			if err := g.marshalValue(d.Type, fmt.Sprintf("(*%s)", expr), path); err != nil {
+				return err
+			}
+		} else {
+			// Already known not to be nil
+			g.check("%s.MarshalXDR(e)", expr)
+		}
+		g.printf("}")
+		return nil
+
+	case ast.DECLARATION_MODIFIER_FLEXIBLE, ast.DECLARATION_MODIFIER_UNBOUNDED:
+		g.checkMaxLen(expr, d, path)
+		g.check("e.EncodeUnsignedInt(uint32(len(%s)))", expr)
+		fallthrough
+
+	case ast.DECLARATION_MODIFIER_FIXED:
+		i := g.tmp("i")
+		g.printf("for %s := range %s {", i, expr)
+		if err := g.marshalValue(d.Type, fmt.Sprintf("%s[%s]", expr, i), path); err != nil {
+			return err
+		}
+		g.printf("}")
+		return nil
+
+	default:
+		return fmt.Errorf("Unknown modifier %s", d.Modifier.Kind)
+	}
+}
+
+func (g *marshalGen) marshalMap(d *ast.Declaration, expr, path string) error {
+	t, err := d.Type.Resolve(g.s)
+	if err != nil {
+		return err
+	}
+
+	g.checkMaxLen(expr, d, path)
+	g.check("e.EncodeUnsignedInt(uint32(len(%s)))", expr)
+
+	k, v := g.tmp("k"), g.tmp("v")
+	g.printf("for %s, %s := range %s {", k, v, expr)
+	if err := g.marshalEntry(t.StructSpec.Members[0], k, path); err != nil {
+		return err
+	}
+	if err := g.marshalEntry(t.StructSpec.Members[1], v, path); err != nil {
+		return err
+	}
+	g.printf("}")
+	return nil
+}
+
+// marshalEntry generates code to encode the key or value of a map. These
+// are generated as the Go type of the member's type, ignoring any modifier,
+// except for strings
+func (g *marshalGen) marshalEntry(d *ast.Declaration, expr, path string) error {
+	if d.Type.Kind == ast.TYPE_STRING {
+		return g.Marshal(d, expr, path)
+	}
+	return g.marshalValue(d.Type, expr, path)
+}
+
+func (g *marshalGen) marshalValue(t *ast.Type, expr, path string) error {
+	switch t.Kind {
+	case ast.TYPE_BOOL:
+		g.check("e.EncodeBool(%s)", expr)
+	case ast.TYPE_INT:
+		g.check("e.EncodeInt(%s)", expr)
+	case ast.TYPE_UNSIGNED_INT:
+		g.check("e.EncodeUnsignedInt(%s)", expr)
+	case ast.TYPE_HYPER:
+		g.check("e.EncodeHyper(%s)", expr)
+	case ast.TYPE_UNSIGNED_HYPER:
+		g.check("e.EncodeUnsignedHyper(%s)", expr)
+	case ast.TYPE_FLOAT:
+		g.check("e.EncodeFloat(%s)", expr)
+	case ast.TYPE_DOUBLE:
+		g.check("e.EncodeDouble(%s)", expr)
+
+	case ast.TYPE_REF:
+		td, typ, err := g.typedefInline(t)
+		if err != nil {
+			return err
+		} else if td != nil {
+			defer func() { g.depth-- }()
+			return g.Marshal(td, fmt.Sprintf("(%s)(%s)", typ, expr), path)
+		}
+
+		pfx, _, err := GoTypeName(g.s, t)
+		if err != nil {
+			return err
+		}
+		if pfx != "" {
+			g.printf("if %s == nil {\nreturn errors.New(\"%s: value is nil\")\n}", expr, path)
+		}
+		g.check("%s.MarshalXDR(e)", expr)
+
+	default:
+		return fmt.Errorf("Don't know how to marshal a %s", t.Kind)
+	}
+	return nil
+}
+
+// Unmarshal generates code to decode the declaration d into expr
+func (g *marshalGen) Unmarshal(d *ast.Declaration, expr, path string) error {
+	if d.Attributes.GetString("mode") == "map" {
+		return g.unmarshalMap(d, expr, path)
+	}
+
+	switch d.Type.Kind {
+	case ast.TYPE_VOID:
+		return nil
+
+	case ast.TYPE_STRING, ast.TYPE_OPAQUE:
+		var n string
+		switch d.Modifier.Kind {
+		case ast.DECLARATION_MODIFIER_FIXED:
+			if d.Type.Kind == ast.TYPE_OPAQUE {
+				g.check("d.DecodeFixedOpaque(%s[:])", expr)
+				return nil
+			}
+			n = fmt.Sprintf("%d", d.Modifier.Size)
+		case ast.DECLARATION_MODIFIER_FLEXIBLE, ast.DECLARATION_MODIFIER_UNBOUNDED:
+			n = g.decodeLen(d, path)
+		default:
+			return fmt.Errorf("Non-array %s", d.Type.Kind)
+		}
+
+		if isChunked(d, maxOpaqueChunk) {
+			b := g.tmp("b")
+			g.decodeOpaqueChunks(b, n)
+			if d.Type.Kind == ast.TYPE_STRING {
+				g.printf("%s = string(%s)", expr, b)
+			} else {
+				g.printf("%s = %s", expr, b)
+			}
+		} else if d.Type.Kind == ast.TYPE_STRING {
+			b := g.tmp("b")
+			g.printf("%s := make([]byte, %s)", b, n)
+			g.check("d.DecodeFixedOpaque(%s)", b)
+			g.printf("%s = string(%s)", expr, b)
+		} else {
+			g.printf("%s = make([]byte, %s)", expr, n)
+			g.check("d.DecodeFixedOpaque(%s)", expr)
+		}
+		return nil
+	}
+
+	switch d.Modifier.Kind {
+	case ast.DECLARATION_MODIFIER_NONE:
+		return g.unmarshalValue(d.Type, expr, path)
+
+	case ast.DECLARATION_MODIFIER_OPTIONAL:
+		pfx, name, err := GoTypeName(g.s, d.Type)
+		if err != nil {
+			return err
+		}
+
+		p := g.tmp("p")
+		g.printf("%s, err := d.DecodeBool()\nif err != nil {\nreturn err\n}", p)
+		g.printf("if %s {", p)
+		value := expr
+		if pfx == "" {
+			g.printf("%s = new(%s)", expr, name)
+			value = fmt.Sprintf("(*%s)", expr)
+		}
+		if err := g.unmarshalValue(d.Type, value, path); err != nil {
+			return err
+		}
+		g.printf("} else {\n%s = nil\n}", expr)
+		return nil
+
+	case ast.DECLARATION_MODIFIER_FLEXIBLE, ast.DECLARATION_MODIFIER_UNBOUNDED:
+		pfx, name, err := GoTypeName(g.s, d.Type)
+		if err != nil {
+			return err
+		}
+
+		n := g.decodeLen(d, path)
+		if !isChunked(d, maxSliceChunk) {
+			g.printf("%s = make([]%s%s, %s)", expr, pfx, name, n)
+			return g.unmarshalElements(d.Type, expr, path)
+		}
+
+		// The slice is grown as elements are decoded
+		c, i, v := g.tmp("c"), g.tmp("i"), g.tmp("v")
+		g.printf("%s := %s\nif %s > %d {\n%s = %d\n}", c, n, c, maxSliceChunk, c, maxSliceChunk)
+		g.printf("%s = make([]%s%s, 0, %s)", expr, pfx, name, c)
+		g.printf("for %s := uint32(0); %s < %s; %s++ {", i, i, n, i)
+		g.printf("var %s %s%s", v, pfx, name)
+		if err := g.unmarshalValue(d.Type, v, path); err != nil {
+			return err
+		}
+		g.printf("%s = append(%s, %s)\n}", expr, expr, v)
+		return nil
+
+	case ast.DECLARATION_MODIFIER_FIXED:
+		return g.unmarshalElements(d.Type, expr, path)
+
+	default:
+		return fmt.Errorf("Unknown modifier %s", d.Modifier.Kind)
+	}
+}
+
+// unmarshalElements generates code to decode each element of the array or
+// slice expr
+func (g *marshalGen) unmarshalElements(t *ast.Type, expr, path string) error {
+	i := g.tmp("i")
+	g.printf("for %s := range %s {", i, expr)
+	if err := g.unmarshalValue(t, fmt.Sprintf("%s[%s]", expr, i), path); err != nil {
+		return err
+	}
+	g.printf("}")
+	return nil
+}
+
+func (g *marshalGen) unmarshalMap(d *ast.Declaration, expr, path string) error {
+	t, err := d.Type.Resolve(g.s)
+	if err != nil {
+		return err
+	}
+
+	key, val := t.StructSpec.Members[0].Type, t.StructSpec.Members[1].Type
+	_, keyType, err := GoTypeName(g.s, key)
+	if err != nil {
+		return err
+	}
+	valPfx, valType, err := GoTypeName(g.s, val)
+	if err != nil {
+		return err
+	}
+
+	n := g.decodeLen(d, path)
+	g.printf("%s = make(map[%s]%s%s)", expr, keyType, valPfx, valType)
+
+	i, k, v := g.tmp("i"), g.tmp("k"), g.tmp("v")
+	g.printf("for %s := uint32(0); %s < %s; %s++ {", i, i, n, i)
+	g.printf("var %s %s\nvar %s %s%s", k, keyType, v, valPfx, valType)
+	if err := g.unmarshalEntry(t.StructSpec.Members[0], k, path); err != nil {
+		return err
+	}
+	if err := g.unmarshalEntry(t.StructSpec.Members[1], v, path); err != nil {
+		return err
+	}
+	g.printf("%s[%s] = %s\n}", expr, k, v)
+	return nil
+}
+
+func (g *marshalGen) unmarshalEntry(d *ast.Declaration, expr, path string) error {
+	if d.Type.Kind == ast.TYPE_STRING {
+		return g.Unmarshal(d, expr, path)
+	}
+	return g.unmarshalValue(d.Type, expr, path)
+}
+
+func (g *marshalGen) unmarshalValue(t *ast.Type, expr, path string) error {
+	switch t.Kind {
+	case ast.TYPE_BOOL:
+		g.decode(expr, "DecodeBool")
+	case ast.TYPE_INT:
+		g.decode(expr, "DecodeInt")
+	case ast.TYPE_UNSIGNED_INT:
+		g.decode(expr, "DecodeUnsignedInt")
+	case ast.TYPE_HYPER:
+		g.decode(expr, "DecodeHyper")
+	case ast.TYPE_UNSIGNED_HYPER:
+		g.decode(expr, "DecodeUnsignedHyper")
+	case ast.TYPE_FLOAT:
+		g.decode(expr, "DecodeFloat")
+	case ast.TYPE_DOUBLE:
+		g.decode(expr, "DecodeDouble")
+
+	case ast.TYPE_REF:
+		td, typ, err := g.typedefInline(t)
+		if err != nil {
+			return err
+		} else if td != nil {
+			defer func() { g.depth-- }()
+			return g.Unmarshal(td, fmt.Sprintf("(*(*%s)(&%s))", typ, expr), path)
+		}
+
+		pfx, name, err := GoTypeName(g.s, t)
+		if err != nil {
+			return err
+		}
+		if pfx != "" {
+			g.printf("%s = new(%s)", expr, name)
+		}
+		g.check("%s.UnmarshalXDR(d)", expr)
+
+	default:
+		return fmt.Errorf("Don't know how to unmarshal a %s", t.Kind)
+	}
+	return nil
+}
+
+// Template for the MarshalXDR and UnmarshalXDR methods of structs, unions
+// and typedefs
+var marshalerTemplate = compileTemplate("marshaler", `
+// MarshalXDR satisfies xdr.Marshaler
+func (v {{.Receiver}}) MarshalXDR(e xdr.Encoder) error {
+	{{.Marshal}}
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *{{.GoType}}) UnmarshalXDR(d xdr.Decoder) error {
+	{{.Unmarshal}}
+	return nil
+}
+
+var _ xdr.Marshaler = new({{.GoType}})
+`)
+
+func genMarshaler(w io.Writer, goType, receiver string, marshal, unmarshal *marshalGen) error {
+	return marshalerTemplate.Execute(w, map[string]interface{}{
+		"GoType":    goType,
+		"Receiver":  receiver,
+		"Marshal":   marshal.String(),
+		"Unmarshal": unmarshal.String(),
+	})
+}
+
+// GenStructMarshaler generates the MarshalXDR and UnmarshalXDR methods of a
+// struct, which encode each member in turn
+func GenStructMarshaler(w io.Writer, s *ast.Specification, name string, ss *ast.StructSpec) error {
+	return genStructMarshaler(w, s, CamelCase(name), name, ss.Members)
+}
+
+func genStructMarshaler(w io.Writer, s *ast.Specification, goType, name string, members []*ast.Declaration) error {
+	m, u := newMarshalGen(s), newMarshalGen(s)
+	for _, d := range members {
+		expr := "v." + CamelCase(d.Name)
+		path := name + "." + d.Name
+		if err := m.Marshal(d, expr, path); err != nil {
+			return err
+		}
+		if err := u.Unmarshal(d, expr, path); err != nil {
+			return err
+		}
+	}
+
+	return genMarshaler(w, goType, "*"+goType, m, u)
+}
+
+// unionCase is a case label of a union, and the member it selects
+type unionCase struct {
+	value  int32
+	label  string
+	member uint32
+}
+
+// GenUnionMarshaler generates the MarshalXDR and UnmarshalXDR methods of a
+// union, which encode the discriminant followed by the selected member
+func GenUnionMarshaler(w io.Writer, s *ast.Specification, name string, us *ast.UnionSpec, labels map[int32]string) error {
+	cases := make([]unionCase, 0, len(us.Options))
+	for value, membPos := range us.Options {
+		cases = append(cases, unionCase{
+			value:  value,
+			label:  labels[value],
+			member: membPos,
+		})
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].value < cases[j].value })
+
+	// Cases which select the same member share an arm, which is placed at
+	// the first of them
+	var (
+		arms      []uint32
+		armLabels = make(map[uint32][]string)
+	)
+	for _, c := range cases {
+		if _, exists := armLabels[c.member]; !exists {
+			arms = append(arms, c.member)
+		}
+		armLabels[c.member] = append(armLabels[c.member], c.label)
+	}
+
+	m, u := newMarshalGen(s), newMarshalGen(s)
+	disc := "v." + CamelCase(us.Discriminant.Name)
+	if err := m.Marshal(us.Discriminant, disc, name+"."+us.Discriminant.Name); err != nil {
+		return err
+	}
+	if err := u.Unmarshal(us.Discriminant, disc, name+"."+us.Discriminant.Name); err != nil {
+		return err
+	}
+
+	m.printf("switch %s {", disc)
+	u.printf("switch %s {", disc)
+
+	arm := func(d *ast.Declaration) error {
+		expr := "v." + CamelCase(d.Name)
+		path := name + "." + d.Name
+		if err := m.Marshal(d, expr, path); err != nil {
+			return err
+		}
+		return u.Unmarshal(d, expr, path)
+	}
+
+	for _, membPos := range arms {
+		labels := strings.Join(armLabels[membPos], ", ")
+		m.printf("case %s:", labels)
+		u.printf("case %s:", labels)
+		if err := arm(us.Members[membPos]); err != nil {
+			return err
+		}
+	}
+
+	m.printf("default:")
+	u.printf("default:")
+	if us.DefaultMember != nil {
+		if err := arm(us.Members[*us.DefaultMember]); err != nil {
+			return err
+		}
+	} else {
+		m.printf("return errors.New(\"Invalid discriminant\")")
+		u.printf("return errors.New(\"Invalid discriminant\")")
+	}
+
+	m.printf("}")
+	u.printf("}")
+	return genMarshaler(w, CamelCase(name), "*"+CamelCase(name), m, u)
+}
+
+// GenTypedefMarshaler generates the MarshalXDR and UnmarshalXDR methods of a
+// typedef, which convert the value to the underlying type before encoding it.
+//
+// Typedefs of pointer types can't have methods; these are instead encoded
+// wherever they are used
+func GenTypedefMarshaler(w io.Writer, s *ast.Specification, name string, d *ast.Declaration) error {
+	if isPointerTypedef(s, d) {
+		return nil
+	}
+
+	typ, _, err := goDeclarationType(s, d)
+	if err != nil {
+		return err
+	}
+
+	m, u := newMarshalGen(s), newMarshalGen(s)
+	m.printf("x := (%s)(v)", typ)
+	if err := m.Marshal(d, "x", name); err != nil {
+		return err
+	}
+
+	u.printf("x := (*%s)(v)", typ)
+	if err := u.Unmarshal(d, "(*x)", name); err != nil {
+		return err
+	}
+
+	return genMarshaler(w, CamelCase(name), CamelCase(name), m, u)
+}
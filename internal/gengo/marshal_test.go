@@ -0,0 +1,133 @@
+package gengo_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"go.e43.eu/xdr"
+	"go.e43.eu/xdrgen/internal/gengo/testdata/bench"
+)
+
+//go:generate xdrgen -Ggo testdata/bench/bench.x
+
+// reflectEntry and reflectListing have the same encoding as bench.Entry and
+// bench.Listing, but no methods, so are encoded using reflection as all
+// types were before MarshalXDR and UnmarshalXDR methods were generated
+type reflectEntry struct {
+	Name      string
+	Size      uint64
+	Directory bool
+}
+
+type reflectListing struct {
+	Status  int32
+	Cookie  [8]byte
+	Entries []reflectEntry
+	Data    []byte
+}
+
+func newListing() *bench.Listing {
+	l := &bench.Listing{
+		Status: 1,
+		Cookie: [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Data:   bytes.Repeat([]byte{0xa5}, 1000),
+	}
+	for i := 0; i < 100; i++ {
+		l.Entries = append(l.Entries, &bench.Entry{
+			Name:      fmt.Sprintf("file%d", i),
+			Size:      uint64(i) << 20,
+			Directory: i%10 == 0,
+		})
+	}
+	return l
+}
+
+func newReflectListing() *reflectListing {
+	l := newListing()
+	r := &reflectListing{Status: l.Status, Cookie: l.Cookie, Data: l.Data}
+	for _, e := range l.Entries {
+		r.Entries = append(r.Entries, reflectEntry{e.Name, e.Size, e.Directory})
+	}
+	return r
+}
+
+func TestMarshalMatchesReflection(t *testing.T) {
+	gen, err := xdr.Marshal(newListing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	refl, err := xdr.Marshal(newReflectListing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gen, refl) {
+		t.Fatalf("Generated encoding differs from reflection:\n%x\n%x", gen, refl)
+	}
+
+	var l bench.Listing
+	if err := xdr.Read(bytes.NewReader(gen), &l); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Entries) != 100 || *l.Entries[42] != *newListing().Entries[42] || !bytes.Equal(l.Data, newListing().Data) {
+		t.Fatalf("Decoded %+v", l)
+	}
+}
+
+func TestUnmarshalLongLength(t *testing.T) {
+	header := make([]byte, 12)
+	for _, b := range [][]byte{
+		// 2^32-1 entries
+		append(header, 0xff, 0xff, 0xff, 0xff),
+		// No entries, and 2^32-1 bytes of data
+		append(header, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff),
+	} {
+		var l bench.Listing
+		if err := xdr.Read(bytes.NewReader(b), &l); err == nil {
+			t.Errorf("Decoding %x succeeded", b)
+		}
+	}
+}
+
+func benchmarkMarshal(b *testing.B, v interface{}) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := xdr.Marshal(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkUnmarshal(b *testing.B, data []byte, v func() interface{}) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if err := xdr.Read(bytes.NewReader(data), v()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalGenerated(b *testing.B) {
+	benchmarkMarshal(b, newListing())
+}
+
+func BenchmarkMarshalReflection(b *testing.B) {
+	benchmarkMarshal(b, newReflectListing())
+}
+
+func BenchmarkUnmarshalGenerated(b *testing.B) {
+	data, err := xdr.Marshal(newListing())
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkUnmarshal(b, data, func() interface{} { return new(bench.Listing) })
+}
+
+func BenchmarkUnmarshalReflection(b *testing.B) {
+	data, err := xdr.Marshal(newReflectListing())
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkUnmarshal(b, data, func() interface{} { return new(reflectListing) })
+}
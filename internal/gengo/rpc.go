@@ -0,0 +1,261 @@
+package gengo
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"go.e43.eu/xdrgen/ast"
+)
+
+// hasPrograms returns if any programs are defined by the specification
+// (rather than imported into it)
+func hasPrograms(s *ast.Specification) bool {
+	for _, d := range s.Definitions {
+		if !d.IsImported() && d.Body.Kind == ast.DEFINITION_KIND_PROGRAM {
+			return true
+		}
+	}
+	return false
+}
+
+// rpcProcedure describes how a procedure is called from Go
+type rpcProcedure struct {
+	*ast.Procedure
+
+	// Params is the Go parameter list for the arguments of the procedure,
+	// including a leading comma
+	Params string
+	// Args is the Go expression passed as the arguments of the call
+	Args string
+	// DecodeArgs is the Go code which decodes the arguments of the call in
+	// a dispatcher, and CallArgs the arguments then passed to the server
+	DecodeArgs string
+	CallArgs   string
+	// ArgsType is the type which multiple arguments are wrapped in, if any
+	ArgsType string
+	// Result is the Go type of the result of the procedure, or empty if
+	// the procedure returns void
+	Result string
+	// ResultElem is the type pointed to by Result if it is a pointer type,
+	// or empty otherwise
+	ResultElem string
+}
+
+func rpcProcedures(s *ast.Specification, v *ast.VersionSpec) ([]*rpcProcedure, error) {
+	procs := make([]*rpcProcedure, len(v.Procedures))
+	for i, p := range v.Procedures {
+		rp := &rpcProcedure{Procedure: p}
+		procs[i] = rp
+
+		var (
+			params []string
+			names  []string
+		)
+		for j, arg := range p.Arguments {
+			pfx, name, err := GoTypeName(s, arg)
+			if err != nil {
+				return nil, fmt.Errorf("Procedure '%s' argument %d: %v", p.Name, j+1, err)
+			}
+
+			argName := "arg"
+			if len(p.Arguments) > 1 {
+				argName = fmt.Sprintf("arg%d", j+1)
+			}
+			names = append(names, argName)
+			params = append(params, fmt.Sprintf(", %s %s%s", argName, pfx, name))
+		}
+		rp.Params = strings.Join(params, "")
+
+		const garbageArgs = "if err := decode(%s); err != nil {\nreturn nil, rpc.GARBAGE_ARGS\n}"
+		switch len(names) {
+		case 0:
+			rp.Args = "nil"
+		case 1:
+			rp.Args = names[0]
+			rp.CallArgs = ", arg"
+
+			pfx, name, _ := GoTypeName(s, p.Arguments[0])
+			if pfx == "*" {
+				rp.DecodeArgs = fmt.Sprintf("arg := new(%s)\n"+garbageArgs, name, "arg")
+			} else {
+				rp.DecodeArgs = fmt.Sprintf("var arg %s\n"+garbageArgs, name, "&arg")
+			}
+		default:
+			rp.ArgsType = fmt.Sprintf("x%s%sArgs", CamelCase(v.Name), CamelCase(p.Name))
+			fields := make([]string, len(names))
+			for j, n := range names {
+				fields[j] = fmt.Sprintf("%s: %s", CamelCase(n), n)
+				rp.CallArgs += ", args." + CamelCase(n)
+			}
+			rp.Args = fmt.Sprintf("&%s{%s}", rp.ArgsType, strings.Join(fields, ", "))
+			rp.DecodeArgs = fmt.Sprintf("var args %s\n"+garbageArgs, rp.ArgsType, "&args")
+		}
+
+		if p.Result.Kind != ast.TYPE_VOID {
+			pfx, name, err := GoTypeName(s, p.Result)
+			if err != nil {
+				return nil, fmt.Errorf("Procedure '%s' result: %v", p.Name, err)
+			}
+
+			rp.Result = pfx + name
+			if pfx == "*" {
+				rp.ResultElem = name
+			}
+		}
+	}
+	return procs, nil
+}
+
+// genArgsType generates the type which the arguments of a procedure taking
+// more than one argument are wrapped in. The encoding of such a struct is
+// the same as that of the arguments in sequence
+func genArgsType(w io.Writer, s *ast.Specification, p *rpcProcedure) error {
+	members := make([]*ast.Declaration, len(p.Arguments))
+	for i, arg := range p.Arguments {
+		members[i] = &ast.Declaration{
+			Name:     fmt.Sprintf("arg%d", i+1),
+			Type:     arg,
+			Modifier: &ast.Declaration_Modifier{Kind: ast.DECLARATION_MODIFIER_NONE},
+		}
+	}
+
+	if err := argsTypeTemplate.Execute(w, map[string]interface{}{
+		"GoType":        p.ArgsType,
+		"Procedure":     p.Name,
+		"Members":       members,
+		"Specification": s,
+	}); err != nil {
+		return err
+	}
+	return genStructMarshaler(w, s, p.ArgsType, p.Name, members)
+}
+
+var argsTypeTemplate = compileTemplate("argsType", `
+// {{.GoType}} holds the arguments of procedure {{.Procedure}}
+type {{.GoType}} struct {
+{{- range .Members}}
+	{{Declaration $.Specification .}}
+{{- end}}
+}
+`)
+
+var clientTemplate = compileTemplate("client", `
+{{- $Version := .Version}}
+{{- $Client := printf "%sClient" (GoName .Version.Name)}}
+// {{$Client}} is a client for version {{.Version.Number}} of program {{.ProgName}}
+type {{$Client}} struct {
+	Transport rpc.Transport
+}
+
+// New{{$Client}} returns a client which sends calls using t
+func New{{$Client}}(t rpc.Transport) *{{$Client}} {
+	return &{{$Client}}{Transport: t}
+}
+{{- range .Procedures}}
+
+{{DocComment .Attributes (printf "%s calls procedure %s" (GoName .Name) .Name)}}
+func (c *{{$Client}}) {{GoName .Name}}(ctx context.Context{{.Params}}) {{if .Result}}({{.Result}}, error){{else}}error{{end}} {
+{{- if not .Result}}
+	return c.Transport.Call(ctx, {{GoName $.ProgName}}, {{GoName $Version.Name}}, {{GoName .Name}}, {{.Args}}, nil)
+{{- else if .ResultElem}}
+	res := new({{.ResultElem}})
+	if err := c.Transport.Call(ctx, {{GoName $.ProgName}}, {{GoName $Version.Name}}, {{GoName .Name}}, {{.Args}}, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+{{- else}}
+	var res {{.Result}}
+	err := c.Transport.Call(ctx, {{GoName $.ProgName}}, {{GoName $Version.Name}}, {{GoName .Name}}, {{.Args}}, &res)
+	return res, err
+{{- end}}
+}
+{{- end}}
+`)
+
+var serverTemplate = compileTemplate("server", `
+{{- $Version := .Version}}
+{{- $Server := printf "%sServer" (GoName .Version.Name)}}
+{{- $Handler := printf "x%sHandler" (GoName .Version.Name)}}
+// {{$Server}} is implemented by servers of version {{.Version.Number}} of program {{.ProgName}}
+type {{$Server}} interface {
+{{- range .Procedures}}
+	{{- with DocComment .Attributes ""}}
+	{{.}}
+	{{- end}}
+	{{GoName .Name}}(ctx context.Context{{.Params}}) {{if .Result}}({{.Result}}, error){{else}}error{{end}}
+{{- end}}
+}
+
+type {{$Handler}} struct {
+	srv {{$Server}}
+}
+
+// New{{GoName .Version.Name}}Handler returns an rpc.Handler which dispatches calls to srv
+func New{{GoName .Version.Name}}Handler(srv {{$Server}}) rpc.Handler {
+	return {{$Handler}}{srv}
+}
+
+func (h {{$Handler}}) Program() uint32 {
+	return {{GoName .ProgName}}
+}
+
+func (h {{$Handler}}) Version() uint32 {
+	return {{GoName .Version.Name}}
+}
+
+func (h {{$Handler}}) Dispatch(ctx context.Context, proc uint32, decode func(interface{}) error) (interface{}, error) {
+	switch proc {
+{{- range .Procedures}}
+	case {{GoName .Name}}:
+	{{- with .DecodeArgs}}
+		{{.}}
+	{{- end}}
+	{{- if .ResultElem}}
+		res, err := h.srv.{{GoName .Name}}(ctx{{.CallArgs}})
+		if err == nil && res == nil {
+			// A nil result can't be encoded
+			return nil, rpc.SYSTEM_ERR
+		}
+		return res, err
+	{{- else if .Result}}
+		return h.srv.{{GoName .Name}}(ctx{{.CallArgs}})
+	{{- else}}
+		return nil, h.srv.{{GoName .Name}}(ctx{{.CallArgs}})
+	{{- end}}
+{{- end}}
+	default:
+		return nil, rpc.PROC_UNAVAIL
+	}
+}
+`)
+
+// GenVersionStubs generates a client for a version of a program, with a
+// method for each procedure, and the interface implemented by servers with a
+// handler which dispatches calls to them
+func GenVersionStubs(w io.Writer, s *ast.Specification, progName string, v *ast.VersionSpec) error {
+	procs, err := rpcProcedures(s, v)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range procs {
+		if p.ArgsType != "" {
+			if err := genArgsType(w, s, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	params := map[string]interface{}{
+		"ProgName":   progName,
+		"Version":    v,
+		"Procedures": procs,
+	}
+	if err := clientTemplate.Execute(w, params); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	return serverTemplate.Execute(w, params)
+}
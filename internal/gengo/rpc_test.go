@@ -0,0 +1,174 @@
+package gengo_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"go.e43.eu/xdr"
+	"go.e43.eu/xdrgen/internal/gengo/testdata/echo"
+	"go.e43.eu/xdrgen/rpc"
+)
+
+//go:generate xdrgen -Ggo testdata/echo/echo.x
+
+// call is a call made through a transport
+type call struct {
+	prog, vers, proc uint32
+	args, res        interface{}
+}
+
+// transport records the calls made through it, and answers them by decoding
+// the encoded arguments as the result
+type transport struct {
+	calls []call
+	err   error
+}
+
+func (t *transport) Call(ctx context.Context, prog, vers, proc uint32, args, res interface{}) error {
+	t.calls = append(t.calls, call{prog, vers, proc, args, res})
+	if t.err != nil || res == nil {
+		return t.err
+	}
+
+	b, err := xdr.Marshal(args)
+	if err != nil {
+		return err
+	}
+	return xdr.Read(bytes.NewReader(b), res)
+}
+
+func TestGeneratedClient(t *testing.T) {
+	tr := &transport{}
+	c := echo.NewECHO_V1Client(tr)
+	ctx := context.Background()
+
+	if err := c.ECHOPROC_NULL(ctx); err != nil {
+		t.Errorf("NULL: %v", err)
+	}
+
+	arg := &echo.Message{Text: "hello"}
+	res, err := c.ECHOPROC_ECHO(ctx, arg)
+	if err != nil {
+		t.Errorf("ECHO: %v", err)
+	} else if res.Text != "hello" {
+		t.Errorf("ECHO returned %q", res.Text)
+	}
+
+	want := []call{
+		{echo.ECHO_PROGRAM, echo.ECHO_V1, echo.ECHOPROC_NULL, nil, nil},
+		{echo.ECHO_PROGRAM, echo.ECHO_V1, echo.ECHOPROC_ECHO, arg, res},
+	}
+	if !reflect.DeepEqual(tr.calls, want) {
+		t.Errorf("Made calls %+v, expected %+v", tr.calls, want)
+	}
+
+	// Errors from the transport are returned without a result
+	tr.err = errors.New("failed")
+	if res, err := c.ECHOPROC_ECHO(ctx, arg); res != nil || err != tr.err {
+		t.Errorf("ECHO with a failing transport returned %v, %v", res, err)
+	}
+}
+
+var errFailed = errors.New("failed")
+
+// echoServer echoes messages, except "fail", for which it returns errFailed,
+// and "nil", for which it returns a nil result
+type echoServer struct{}
+
+func (echoServer) ECHOPROC_NULL(ctx context.Context) error {
+	return nil
+}
+
+func (echoServer) ECHOPROC_ECHO(ctx context.Context, arg *echo.Message) (*echo.Message, error) {
+	switch arg.Text {
+	case "fail":
+		return nil, errFailed
+	case "nil":
+		return nil, nil
+	}
+	return arg, nil
+}
+
+func TestGeneratedHandler(t *testing.T) {
+	h := echo.NewECHO_V1Handler(echoServer{})
+	if h.Program() != echo.ECHO_PROGRAM || h.Version() != echo.ECHO_V1 {
+		t.Errorf("Handler is for program %d version %d", h.Program(), h.Version())
+	}
+
+	encode := func(text string) []byte {
+		b, err := xdr.Marshal(&echo.Message{Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name string
+		proc uint32
+		args []byte
+		res  interface{}
+		err  error
+	}{
+		{"NULL", echo.ECHOPROC_NULL, nil, nil, nil},
+		{"ECHO", echo.ECHOPROC_ECHO, encode("hello"), &echo.Message{Text: "hello"}, nil},
+		{"ECHO failing", echo.ECHOPROC_ECHO, encode("fail"), nil, errFailed},
+		{"ECHO returning nil", echo.ECHOPROC_ECHO, encode("nil"), nil, rpc.SYSTEM_ERR},
+		{"ECHO with truncated arguments", echo.ECHOPROC_ECHO, []byte{0, 0, 0, 5, 'a'}, nil, rpc.GARBAGE_ARGS},
+		{"Unknown procedure", 2, nil, nil, rpc.PROC_UNAVAIL},
+	}
+
+	for _, test := range tests {
+		decode := func(args interface{}) error {
+			return xdr.Read(bytes.NewReader(test.args), args)
+		}
+		res, err := h.Dispatch(context.Background(), test.proc, decode)
+		if err != test.err {
+			t.Errorf("%s: got error %v, expected %v", test.name, err, test.err)
+		} else if err == nil && !reflect.DeepEqual(res, test.res) {
+			t.Errorf("%s: returned %#v, expected %#v", test.name, res, test.res)
+		}
+	}
+}
+
+func TestGeneratedRPC(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := rpc.NewServer()
+	s.Register(echo.NewECHO_V1Handler(echoServer{}))
+	go s.Serve(l)
+
+	conn, err := rpc.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := echo.NewECHO_V1Client(conn)
+
+	ctx := context.Background()
+	if err := c.ECHOPROC_NULL(ctx); err != nil {
+		t.Errorf("NULL: %v", err)
+	}
+
+	if res, err := c.ECHOPROC_ECHO(ctx, &echo.Message{Text: "hello"}); err != nil {
+		t.Errorf("ECHO: %v", err)
+	} else if res.Text != "hello" {
+		t.Errorf("ECHO returned %q", res.Text)
+	}
+
+	// A nil result fails the call, rather than the server
+	if _, err := c.ECHOPROC_ECHO(ctx, &echo.Message{Text: "nil"}); err != rpc.SYSTEM_ERR {
+		t.Errorf("ECHO returning nil: got error %v, expected %v", err, rpc.SYSTEM_ERR)
+	}
+	if _, err := c.ECHOPROC_ECHO(ctx, &echo.Message{Text: "again"}); err != nil {
+		t.Errorf("ECHO after nil result: %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import "text/template"
 var templateFuncs = map[string]interface{}{
 	"GoName":                 CamelCase,
 	"GoValue":                GoValue,
+	"DocComment":             DocComment,
 	"Declaration":            GenBasicDeclaration,
 	"UnionSwitchDeclaration": GenUnionSwitchDeclaration,
 	"UnionDeclaration":       GenUnionDeclaration,
@@ -22,12 +23,21 @@ var headerTemplate = compileTemplate("header", `
 package {{.PackageName}}
 
 import (
+{{- if .RPC}}
+	"context"
+{{- end}}
 	"encoding"
 	"errors"
 	"fmt"
 	"strconv"
 
 	xdr "go.e43.eu/xdr/interfaces"
+{{- if .RPC}}
+	"go.e43.eu/xdrgen/rpc"
+{{- end}}
+{{- range .Imports}}
+	{{.Alias}} "{{.Path}}"
+{{- end}}
 )
 
 `)
@@ -45,37 +55,17 @@ var (
 )
 `)
 
-// Template for generating an xdr.Marshaler "proxy" implementation for typedefs
-var typedefProxyTemplate = compileTemplate("typedefProxy", `
-{{- $GoType := GoName .TypeName}}
-type x{{$GoType}} struct {
-	{{Declaration .Specification .Decl}}
-}
-
-// MarshalXDR satisfies xdr.Marshaler
-func (v {{$GoType}}) MarshalXDR(e xdr.Encoder) error {
-	return e.Encode(x{{$GoType}}{v})
-}
-
-// UnmarshalXDR satisfies xdr.Marshaler
-func (v *{{$GoType}}) UnmarshalXDR(d xdr.Decoder) error
-	xv := x{{$GoType}}{}
-	err := d.Decode(&xv)
-	*v = xv.{{GoName .Decl.Name}}
-	return err
-}
-
-var _ xdr.Marshaler = new({{$GoType}})
-`)
-
 // Used to generate enum declarations
 var enumTemplate = compileTemplate("enum", `
 {{- $TypeName := .TypeName}}
 {{- $GoType := GoName $TypeName}}
 {{.Doc}}
-type {{$GoType}} uint32
+type {{$GoType}} int32
 const (
 {{- range .Options}}
+	{{- with DocComment .Attributes ""}}
+	{{.}}
+	{{- end}}
 	{{GoName .Name}} {{GoName $TypeName}} = {{.Value}}
 {{- end}}
 )
@@ -122,7 +112,20 @@ func (v {{$GoType}}) IsKnown() bool {
 	return ok
 }
 
+// MarshalXDR satisfies xdr.Marshaler
+func (v {{$GoType}}) MarshalXDR(e xdr.Encoder) error {
+	return e.EncodeInt(int32(v))
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *{{$GoType}}) UnmarshalXDR(d xdr.Decoder) error {
+	x, err := d.DecodeInt()
+	*v = {{$GoType}}(x)
+	return err
+}
+
 var (
+	_ xdr.Marshaler = new({{$GoType}})
 	_ fmt.Stringer = {{$GoType}}(0)
 	_ encoding.TextMarshaler = {{$GoType}}(0)
 	_ encoding.TextUnmarshaler = new({{$GoType}})
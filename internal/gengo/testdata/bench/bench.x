@@ -0,0 +1,17 @@
+#[
+	doc("Types used to benchmark the generated MarshalXDR and UnmarshalXDR methods"),
+	go_package("bench"),
+]
+
+struct entry {
+	string name<>;
+	unsigned hyper size;
+	bool directory;
+};
+
+struct listing {
+	int status;
+	opaque cookie[8];
+	entry entries<>;
+	opaque data<>;
+};
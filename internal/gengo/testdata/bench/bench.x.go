@@ -0,0 +1,164 @@
+// Code generated by xdrgen-go - DO NOT EDIT.
+
+// Types used to benchmark the generated MarshalXDR and UnmarshalXDR methods
+package bench
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"strconv"
+
+	xdr "go.e43.eu/xdr/interfaces"
+)
+
+// Entry is struct entry
+type Entry struct {
+	Name      string `json:"name"`
+	Size      uint64 `json:"size"`
+	Directory bool   `json:"directory"`
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Entry) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(uint32(len(v.Name))); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque([]byte(v.Name)); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedHyper(v.Size); err != nil {
+		return err
+	}
+	if err := e.EncodeBool(v.Directory); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Entry) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	b2 := []byte{}
+	for uint32(len(b2)) < n1 {
+		c3 := n1 - uint32(len(b2))
+		if c3 > 65536 {
+			c3 = 65536
+		}
+		b2 = append(b2, make([]byte, c3)...)
+		if err := d.DecodeFixedOpaque(b2[uint32(len(b2))-c3:]); err != nil {
+			return err
+		}
+	}
+	v.Name = string(b2)
+	if v.Size, err = d.DecodeUnsignedHyper(); err != nil {
+		return err
+	}
+	if v.Directory, err = d.DecodeBool(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Entry)
+
+// Listing is struct listing
+type Listing struct {
+	Status  int32    `json:"status"`
+	Cookie  [8]byte  `xdr:"opaque" json:"cookie"`
+	Entries []*Entry `json:"entries"`
+	Data    []byte   `xdr:"opaque" json:"data"`
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *Listing) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeInt(v.Status); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque(v.Cookie[:]); err != nil {
+		return err
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.Entries))); err != nil {
+		return err
+	}
+	for i1 := range v.Entries {
+		if v.Entries[i1] == nil {
+			return errors.New("listing.entries: value is nil")
+		}
+		if err := v.Entries[i1].MarshalXDR(e); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeUnsignedInt(uint32(len(v.Data))); err != nil {
+		return err
+	}
+	if err := e.EncodeFixedOpaque(v.Data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Listing) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	if v.Status, err = d.DecodeInt(); err != nil {
+		return err
+	}
+	if err := d.DecodeFixedOpaque(v.Cookie[:]); err != nil {
+		return err
+	}
+	n1, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	c2 := n1
+	if c2 > 1024 {
+		c2 = 1024
+	}
+	v.Entries = make([]*Entry, 0, c2)
+	for i3 := uint32(0); i3 < n1; i3++ {
+		var v4 *Entry
+		v4 = new(Entry)
+		if err := v4.UnmarshalXDR(d); err != nil {
+			return err
+		}
+		v.Entries = append(v.Entries, v4)
+	}
+	n5, err := d.DecodeUnsignedInt()
+	if err != nil {
+		return err
+	}
+	b6 := []byte{}
+	for uint32(len(b6)) < n5 {
+		c7 := n5 - uint32(len(b6))
+		if c7 > 65536 {
+			c7 = 65536
+		}
+		b6 = append(b6, make([]byte, c7)...)
+		if err := d.DecodeFixedOpaque(b6[uint32(len(b6))-c7:]); err != nil {
+			return err
+		}
+	}
+	v.Data = b6
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(Listing)
+
+// Dummy type assertions - added to ensure that no errors are generated
+// because we didn't use one of our imports
+var (
+	_ encoding.TextMarshaler = nil
+	_ fmt.Stringer           = nil
+	_ xdr.Marshaler          = nil
+	_                        = strconv.ErrSyntax
+	_                        = errors.New
+)
@@ -0,0 +1,15 @@
+#[
+	doc("A program used to test the generated RPC code"),
+	go_package("echo"),
+]
+
+struct message {
+	string text<>;
+};
+
+program ECHO_PROGRAM {
+	version ECHO_V1 {
+		void ECHOPROC_NULL(void) = 0;
+		message ECHOPROC_ECHO(message) = 1;
+	} = 1;
+} = 0x20000001;
@@ -0,0 +1,33 @@
+#[
+	doc("Types used to test enums and unions with negative values"),
+	go_package("signed"),
+]
+
+enum nfsstat3 {
+	NFS3_OK = 0,
+	NFS3ERR_X = -1,
+	NFS3ERR_MIN = -2147483648
+};
+
+union signed_res switch (int status) {
+case -1:
+	int x;
+case -2147483648:
+	void;
+default:
+	void;
+};
+
+union unsigned_res switch (unsigned int status) {
+case 0:
+	void;
+case 0xFFFFFFFF:
+	int x;
+};
+
+union enum_res switch (nfsstat3 status) {
+case NFS3ERR_X:
+	int x;
+default:
+	void;
+};
@@ -0,0 +1,268 @@
+// Code generated by xdrgen-go - DO NOT EDIT.
+
+// Types used to test enums and unions with negative values
+package signed
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"strconv"
+
+	xdr "go.e43.eu/xdr/interfaces"
+)
+
+// Nfsstat3 is enum nfsstat3
+type Nfsstat3 int32
+
+const (
+	NFS3_OK     Nfsstat3 = 0
+	NFS3ERR_X   Nfsstat3 = -1
+	NFS3ERR_MIN Nfsstat3 = -2147483648
+)
+
+var xNfsstat3ValToStr = map[Nfsstat3]string{
+	NFS3ERR_MIN: "NFS3ERR_MIN", // -2147483648
+	NFS3ERR_X:   "NFS3ERR_X",   // -1
+	NFS3_OK:     "NFS3_OK",     // 0
+}
+
+var xNfsstat3StrToVal = map[string]Nfsstat3{
+	"NFS3_OK":     NFS3_OK,
+	"NFS3ERR_X":   NFS3ERR_X,
+	"NFS3ERR_MIN": NFS3ERR_MIN,
+}
+
+// String satisfies fmt.Stringer
+func (v Nfsstat3) String() string {
+	if s, ok := xNfsstat3ValToStr[v]; ok {
+		return s
+	}
+	return strconv.Itoa(int(v))
+}
+
+// MarshalText satisfies encoding.TextMarshaler
+func (v Nfsstat3) MarshalText() ([]byte, error) {
+	if s, ok := xNfsstat3ValToStr[v]; ok {
+		return []byte(s), nil
+	}
+	return nil, errors.New("Invalid enum value")
+}
+
+// UnmarshalText satisfies encoding.TextUnmarshaler
+func (v *Nfsstat3) UnmarshalText(buf []byte) error {
+	if nv, ok := xNfsstat3StrToVal[string(buf)]; ok {
+		*v = nv
+		return nil
+	}
+	return errors.New("Invalid enum value")
+}
+
+func (v Nfsstat3) IsKnown() bool {
+	_, ok := xNfsstat3ValToStr[v]
+	return ok
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v Nfsstat3) MarshalXDR(e xdr.Encoder) error {
+	return e.EncodeInt(int32(v))
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *Nfsstat3) UnmarshalXDR(d xdr.Decoder) error {
+	x, err := d.DecodeInt()
+	*v = Nfsstat3(x)
+	return err
+}
+
+var (
+	_ xdr.Marshaler            = new(Nfsstat3)
+	_ fmt.Stringer             = Nfsstat3(0)
+	_ encoding.TextMarshaler   = Nfsstat3(0)
+	_ encoding.TextUnmarshaler = new(Nfsstat3)
+)
+
+// SignedRes is union signed_res
+type SignedRes struct {
+	Status int32    `xdr:"union:switch" json:"status"`
+	X      int32    `xdr:"union:-1" json:"x,omitempty"`
+	_      struct{} `xdr:"union:default"`
+}
+
+func (u *SignedRes) UnionDiscriminant() interface{} {
+	return u.Status
+}
+
+func (u *SignedRes) UnionValue() (interface{}, error) {
+	switch u.Status {
+	case -1:
+		return u.X, nil
+	case -2147483648:
+		return nil, nil
+	default:
+		return nil, nil
+	}
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *SignedRes) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeInt(v.Status); err != nil {
+		return err
+	}
+	switch v.Status {
+	case -2147483648:
+	case -1:
+		if err := e.EncodeInt(v.X); err != nil {
+			return err
+		}
+	default:
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *SignedRes) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	if v.Status, err = d.DecodeInt(); err != nil {
+		return err
+	}
+	switch v.Status {
+	case -2147483648:
+	case -1:
+		if v.X, err = d.DecodeInt(); err != nil {
+			return err
+		}
+	default:
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(SignedRes)
+
+// UnsignedRes is union unsigned_res
+type UnsignedRes struct {
+	Status uint32   `xdr:"union:switch" json:"status"`
+	_      struct{} `xdr:"union:0"`
+	X      int32    `xdr:"union:4294967295" json:"x,omitempty"`
+}
+
+func (u *UnsignedRes) UnionDiscriminant() interface{} {
+	return u.Status
+}
+
+func (u *UnsignedRes) UnionValue() (interface{}, error) {
+	switch u.Status {
+	case 0:
+		return nil, nil
+	case 4294967295:
+		return u.X, nil
+	default:
+		return nil, errors.New("Invalid discriminant")
+	}
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *UnsignedRes) MarshalXDR(e xdr.Encoder) error {
+	if err := e.EncodeUnsignedInt(v.Status); err != nil {
+		return err
+	}
+	switch v.Status {
+	case 4294967295:
+		if err := e.EncodeInt(v.X); err != nil {
+			return err
+		}
+	case 0:
+	default:
+		return errors.New("Invalid discriminant")
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *UnsignedRes) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	if v.Status, err = d.DecodeUnsignedInt(); err != nil {
+		return err
+	}
+	switch v.Status {
+	case 4294967295:
+		if v.X, err = d.DecodeInt(); err != nil {
+			return err
+		}
+	case 0:
+	default:
+		return errors.New("Invalid discriminant")
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(UnsignedRes)
+
+// EnumRes is union enum_res
+type EnumRes struct {
+	Status Nfsstat3 `xdr:"union:switch" json:"status"`
+	X      int32    `xdr:"union:-1" json:"x,omitempty"`
+	_      struct{} `xdr:"union:default"`
+}
+
+func (u *EnumRes) UnionDiscriminant() interface{} {
+	return u.Status
+}
+
+func (u *EnumRes) UnionValue() (interface{}, error) {
+	switch u.Status {
+	case NFS3ERR_X:
+		return u.X, nil
+	default:
+		return nil, nil
+	}
+}
+
+// MarshalXDR satisfies xdr.Marshaler
+func (v *EnumRes) MarshalXDR(e xdr.Encoder) error {
+	if err := v.Status.MarshalXDR(e); err != nil {
+		return err
+	}
+	switch v.Status {
+	case NFS3ERR_X:
+		if err := e.EncodeInt(v.X); err != nil {
+			return err
+		}
+	default:
+	}
+
+	return nil
+}
+
+// UnmarshalXDR satisfies xdr.Marshaler
+func (v *EnumRes) UnmarshalXDR(d xdr.Decoder) error {
+	var err error
+	if err := v.Status.UnmarshalXDR(d); err != nil {
+		return err
+	}
+	switch v.Status {
+	case NFS3ERR_X:
+		if v.X, err = d.DecodeInt(); err != nil {
+			return err
+		}
+	default:
+	}
+
+	return nil
+}
+
+var _ xdr.Marshaler = new(EnumRes)
+
+// Dummy type assertions - added to ensure that no errors are generated
+// because we didn't use one of our imports
+var (
+	_ encoding.TextMarshaler = nil
+	_ fmt.Stringer           = nil
+	_ xdr.Marshaler          = nil
+	_                        = strconv.ErrSyntax
+	_                        = errors.New
+)
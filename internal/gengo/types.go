@@ -50,12 +50,103 @@ func GoTypeName(
 		case ast.TYPE_STRUCT, ast.TYPE_UNION:
 			prefix = "*"
 		}
-		return prefix, CamelCase(defn.Name), nil
+
+		qual, err := goQualifier(s, defn)
+		if err != nil {
+			return "", "", err
+		}
+		return prefix, qual + CamelCase(defn.Name), nil
 	default:
 		return "", "", fmt.Errorf("Don't know how to name a %s", t.Kind)
 	}
 }
 
+// GoImport determines the Go package which definitions imported from the
+// specified import are generated in, and the alias we import it as.
+// If the imported specification is generated into the same package as s,
+// path is empty
+func GoImport(s *ast.Specification, idx uint32) (alias string, path string, err error) {
+	imp := s.Imports[idx]
+	pkg := imp.Attributes.GetStringDefault("go_package", "x")
+	path = imp.Attributes.GetString("go_import")
+	if path == "" {
+		if pkg == s.Attributes.GetStringDefault("go_package", "x") {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("Imported specification '%s' has no go_import attribute", imp.Path)
+	}
+
+	// Disambiguate packages which share a name
+	for i := uint32(0); i < idx; i++ {
+		other := s.Imports[i]
+		if other.Attributes.GetStringDefault("go_package", "x") == pkg &&
+			other.Attributes.GetString("go_import") != path {
+			return fmt.Sprintf("%s%d", pkg, idx), path, nil
+		}
+	}
+	return pkg, path, nil
+}
+
+// goQualifier returns the package qualifier to be used when referring to the
+// Go type or constant generated for a definition
+func goQualifier(s *ast.Specification, d *ast.Definition) (string, error) {
+	if d.ImportedFrom == nil {
+		return "", nil
+	}
+
+	alias, path, err := GoImport(s, *d.ImportedFrom)
+	if err != nil || path == "" {
+		return "", err
+	}
+	return alias + ".", nil
+}
+
+// goImports returns the list of Go packages which need to be imported by
+// the code generated for the definitions of s
+func goImports(s *ast.Specification) ([]goImport, error) {
+	used := make(map[uint32]bool)
+	for _, d := range s.Definitions {
+		if d.IsImported() {
+			continue
+		}
+
+		d.VisitTypes(func(t *ast.Type) {
+			if t.Kind != ast.TYPE_REF || uint(t.Ref) >= uint(len(s.Definitions)) {
+				return
+			}
+
+			if xd := s.Definitions[t.Ref]; xd.ImportedFrom != nil {
+				used[*xd.ImportedFrom] = true
+			}
+		})
+	}
+
+	var imports []goImport
+	seen := make(map[string]bool)
+	for idx := range s.Imports {
+		if !used[uint32(idx)] {
+			continue
+		}
+
+		alias, path, err := GoImport(s, uint32(idx))
+		if err != nil {
+			return nil, err
+		}
+
+		if path != "" && !seen[path] {
+			seen[path] = true
+			imports = append(imports, goImport{Alias: alias, Path: path})
+		}
+	}
+	return imports, nil
+}
+
+// goImport is a Go package imported by the generated code
+type goImport struct {
+	Alias string
+	Path  string
+}
+
 // GoValue converts an ast.Constant into a go literal
 func GoValue(v *ast.Constant) string {
 	switch v.Type {
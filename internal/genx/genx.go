@@ -0,0 +1,591 @@
+// Package genx generates XDR source from a specification, so that
+// specifications distributed in the binary format may be read, and the parser
+// tested by parsing its output.
+//
+// Comments do not survive the trip through the AST, except as documentation
+// (which is printed as comments where possible). Constant expressions are
+// printed as the values they evaluate to
+package genx
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.e43.eu/xdrgen/ast"
+	"go.e43.eu/xdrgen/internal/format"
+)
+
+// GenSpecification generates the XDR source of a specification. The
+// definitions it imports are referenced using import directives
+func GenSpecification(s *ast.Specification) ([]byte, error) {
+	g := &generator{s: s, enumValues: make(map[uint32]bool)}
+	for _, d := range s.Definitions {
+		d.VisitTypes(func(t *ast.Type) {
+			if t.Kind == ast.TYPE_ENUM {
+				for i := uint32(0); i < t.EnumSpec.Count; i++ {
+					g.enumValues[t.EnumSpec.Base+i] = true
+				}
+			}
+		})
+	}
+
+	if err := g.specification(); err != nil {
+		return nil, err
+	}
+
+	out, err := format.Source(g.buf.Bytes(), "")
+	if err != nil {
+		return nil, fmt.Errorf("Formatting generated source: %s\n%s", err, g.buf.String())
+	}
+	return out, nil
+}
+
+type generator struct {
+	s   *ast.Specification
+	buf bytes.Buffer
+	// file is the name of the file the specification was read from, if
+	// known
+	file string
+	// enumValues records the definitions which are values of enums, and
+	// are therefore generated along with them
+	enumValues map[uint32]bool
+}
+
+func (g *generator) printf(fmts string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, fmts, args...)
+}
+
+func (g *generator) specification() error {
+	s := g.s
+	if len(s.Attributes) > 0 {
+		attrs, err := attributes(s.Attributes)
+		if err != nil {
+			return fmt.Errorf("Specification attributes: %s", err)
+		}
+		g.printf("#%s\n\n", attrs)
+	}
+
+	order, byLocation := g.order()
+
+	// Imports are placed before the first definition following those
+	// imported from them
+	firstImported := make([]int, len(s.Imports))
+	for i := range firstImported {
+		firstImported[i] = -1
+	}
+	for i, d := range s.Definitions {
+		if d.ImportedFrom != nil && firstImported[*d.ImportedFrom] < 0 {
+			firstImported[*d.ImportedFrom] = i
+		}
+	}
+
+	imported := make([]bool, len(s.Imports))
+	for i, imp := range s.Imports {
+		if firstImported[i] < 0 {
+			imported[i] = true
+			g.printf("import %s;\n\n", strconv.Quote(g.importPath(imp)))
+		}
+	}
+
+	passthroughs := s.Passthroughs
+	for _, i := range order {
+		d := s.Definitions[i]
+		for len(passthroughs) > 0 && passthroughBefore(passthroughs[0], d, i, byLocation) {
+			g.printf("%%%s\n", passthroughs[0].Text)
+			passthroughs = passthroughs[1:]
+		}
+		for idx, first := range firstImported {
+			if !imported[idx] && first < i {
+				imported[idx] = true
+				g.printf("import %s;\n\n", strconv.Quote(g.importPath(s.Imports[idx])))
+			}
+		}
+
+		if err := g.definition(d); err != nil {
+			return fmt.Errorf("'%s': %s", d.Name, err)
+		}
+		g.printf("\n")
+	}
+
+	for idx, imp := range s.Imports {
+		if !imported[idx] {
+			g.printf("import %s;\n\n", strconv.Quote(g.importPath(imp)))
+		}
+	}
+	for _, p := range passthroughs {
+		g.printf("%%%s\n", p.Text)
+	}
+	return nil
+}
+
+// importPath returns the path with which an import is to be imported. The
+// paths of imports are as written in the file which imported them, which
+// for indirect imports is not the specification itself; so where the file
+// the specification was read from is known, imports which aren't found
+// relative to it are imported relative to it
+func (g *generator) importPath(imp *ast.ImportSpec) string {
+	if g.file == "" || imp.File == "" {
+		return imp.Path
+	}
+
+	// The files of imports are absolute
+	dir, err := filepath.Abs(filepath.Dir(g.file))
+	if err != nil {
+		return imp.Path
+	}
+	if filepath.Join(dir, imp.Path) == filepath.Clean(imp.File) {
+		return imp.Path
+	}
+	if rel, err := filepath.Rel(dir, imp.File); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return imp.Path
+}
+
+// order returns the indices of the definitions to be printed, in the order
+// they are printed. Definitions are numbered in the order they are first
+// referenced, which for types referenced before they are defined is not the
+// order in which they are defined. If the locations of the definitions are
+// known, they are therefore printed in the order they appeared in their
+// source file, which the parser will number identically.
+//
+// byLocation is set if the definitions are ordered by their locations
+func (g *generator) order() (order []int, byLocation bool) {
+	byLocation = true
+	for i, d := range g.s.Definitions {
+		if d.IsImported() || g.enumValues[uint32(i)] {
+			continue
+		}
+
+		order = append(order, i)
+		if d.Location == nil || d.Location.File != g.s.Definitions[order[0]].Location.File {
+			byLocation = false
+		}
+	}
+
+	if byLocation && len(order) > 0 {
+		g.file = g.s.Definitions[order[0]].Location.File
+		sort.SliceStable(order, func(a, b int) bool {
+			return before(g.s.Definitions[order[a]].Location, g.s.Definitions[order[b]].Location)
+		})
+	}
+	return order, byLocation
+}
+
+// passthroughBefore returns true if a passthrough line precedes definition i
+func passthroughBefore(p *ast.Passthrough, d *ast.Definition, i int, byLocation bool) bool {
+	if byLocation && p.Location != nil && p.Location.File == d.Location.File {
+		return before(p.Location, d.Location)
+	}
+	return p.Position <= uint32(i)
+}
+
+func before(a, b *ast.Location) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+func (g *generator) definition(d *ast.Definition) error {
+	if err := g.attributes(d.Attributes); err != nil {
+		return err
+	}
+
+	switch d.Body.Kind {
+	case ast.DEFINITION_KIND_CONSTANT:
+		v, err := constant(d.Body.Constant)
+		if err != nil {
+			return err
+		}
+		g.printf("const %s = %s;\n", d.Name, v)
+		return nil
+
+	case ast.DEFINITION_KIND_PROGRAM:
+		return g.program(d.Name, d.Body.ProgramSpec)
+	}
+
+	t := d.Body.Type
+	if t == nil {
+		return fmt.Errorf("Type is referenced but not defined")
+	}
+
+	var err error
+	switch t.Kind {
+	case ast.TYPE_TYPEDEF:
+		g.printf("typedef ")
+		err = g.declaration(t.TypeDef, true)
+	case ast.TYPE_STRUCT:
+		g.printf("struct %s ", d.Name)
+		err = g.structBody(t.StructSpec)
+	case ast.TYPE_UNION:
+		g.printf("union %s ", d.Name)
+		err = g.unionBody(t.UnionSpec)
+	case ast.TYPE_ENUM:
+		g.printf("enum %s ", d.Name)
+		err = g.enumBody(t.EnumSpec)
+	default:
+		g.printf("typedef ")
+		if err = g.typeSpecifier(t); err == nil {
+			g.printf(" %s", d.Name)
+		}
+	}
+	g.printf(";\n")
+	return err
+}
+
+func (g *generator) program(name string, p *ast.ProgramSpec) error {
+	g.printf("program %s {\n", name)
+	for _, v := range p.Versions {
+		if err := g.attributes(v.Attributes); err != nil {
+			return err
+		}
+
+		g.printf("version %s {\n", v.Name)
+		for _, proc := range v.Procedures {
+			if err := g.attributes(proc.Attributes); err != nil {
+				return err
+			}
+
+			if err := g.typeSpecifier(proc.Result); err != nil {
+				return err
+			}
+			g.printf(" %s(", proc.Name)
+			if len(proc.Arguments) == 0 {
+				g.printf("void")
+			}
+			for i, arg := range proc.Arguments {
+				if i > 0 {
+					g.printf(", ")
+				}
+				if err := g.typeSpecifier(arg); err != nil {
+					return err
+				}
+			}
+			g.printf(") = %d;\n", proc.Number)
+		}
+		g.printf("} = %d;\n", v.Number)
+	}
+	g.printf("} = %d;\n", p.Number)
+	return nil
+}
+
+func (g *generator) structBody(ss *ast.StructSpec) error {
+	g.printf("{\n")
+	for _, m := range ss.Members {
+		if err := g.declaration(m, false); err != nil {
+			return err
+		}
+		g.printf(";\n")
+	}
+	g.printf("}")
+	return nil
+}
+
+func (g *generator) unionBody(us *ast.UnionSpec) error {
+	g.printf("switch (")
+	if err := g.declaration(us.Discriminant, true); err != nil {
+		return err
+	}
+	g.printf(") {\n")
+
+	discrim, err := us.Discriminant.Type.Resolve(g.s)
+	if err != nil {
+		return err
+	}
+
+	labels := make([][]int32, len(us.Members))
+	for v, m := range us.Options {
+		if m >= uint32(len(us.Members)) {
+			return fmt.Errorf("Union option refers to nonexistent member %d", m)
+		}
+		labels[m] = append(labels[m], v)
+	}
+
+	for i, m := range us.Members {
+		values := labels[i]
+		if len(values) == 0 {
+			continue
+		}
+		sort.Slice(values, func(a, b int) bool { return values[a] < values[b] })
+
+		// Documentation precedes the case labels
+		if err := g.doc(m.Attributes); err != nil {
+			return err
+		}
+		for _, v := range values {
+			g.printf("case %s:\n", g.caseValue(discrim, v))
+		}
+		if err := g.declaration(m, true); err != nil {
+			return err
+		}
+		g.printf(";\n")
+	}
+
+	if us.DefaultMember != nil {
+		if *us.DefaultMember >= uint32(len(us.Members)) {
+			return fmt.Errorf("Union default refers to nonexistent member %d", *us.DefaultMember)
+		}
+
+		m := us.Members[*us.DefaultMember]
+		if err := g.doc(m.Attributes); err != nil {
+			return err
+		}
+		g.printf("default:\n")
+		if err := g.declaration(m, true); err != nil {
+			return err
+		}
+		g.printf(";\n")
+	}
+	g.printf("}")
+	return nil
+}
+
+// caseValue formats a case label of a union with the specified (resolved)
+// discriminant type
+func (g *generator) caseValue(discrim *ast.Type, v int32) string {
+	switch discrim.Kind {
+	case ast.TYPE_ENUM:
+		if name := discrim.EnumSpec.GetName(g.s, v); name != "" {
+			return name
+		}
+	case ast.TYPE_UNSIGNED_INT:
+		return strconv.FormatUint(uint64(uint32(v)), 10)
+	}
+	return strconv.FormatInt(int64(v), 10)
+}
+
+func (g *generator) enumBody(es *ast.EnumSpec) error {
+	g.printf("{\n")
+	for i := uint32(0); i < es.Count; i++ {
+		if es.Base+i >= uint32(len(g.s.Definitions)) {
+			return fmt.Errorf("Enum value refers to nonexistent definition %d", es.Base+i)
+		}
+
+		d := g.s.Definitions[es.Base+i]
+		if d.Body.Kind != ast.DEFINITION_KIND_CONSTANT || d.Body.Constant == nil {
+			return fmt.Errorf("Enum value '%s' is not a constant", d.Name)
+		}
+		if err := g.attributes(d.Attributes); err != nil {
+			return err
+		}
+
+		g.printf("%s = %d", d.Name, d.Body.Constant.VEnum)
+		if i+1 < es.Count {
+			g.printf(",")
+		}
+		g.printf("\n")
+	}
+	g.printf("}")
+	return nil
+}
+
+// declaration prints a declaration. Attributes are printed on the lines
+// preceding it, unless inline is set. Union arms are printed inline, with
+// their documentation preceding their case labels
+func (g *generator) declaration(d *ast.Declaration, inline bool) error {
+	if inline {
+		attrs := d.Attributes
+		if isCommentDoc(attrs["doc"]) {
+			attrs = withoutDoc(attrs)
+		}
+		if len(attrs) > 0 {
+			str, err := attributes(attrs)
+			if err != nil {
+				return err
+			}
+			g.printf("%s ", str)
+		}
+	} else if err := g.attributes(d.Attributes); err != nil {
+		return err
+	}
+
+	if err := g.typeSpecifier(d.Type); err != nil {
+		return err
+	}
+	if d.Type.Kind == ast.TYPE_VOID {
+		return nil
+	}
+
+	switch d.Modifier.Kind {
+	case ast.DECLARATION_MODIFIER_NONE:
+		g.printf(" %s", d.Name)
+	case ast.DECLARATION_MODIFIER_OPTIONAL:
+		g.printf(" *%s", d.Name)
+	case ast.DECLARATION_MODIFIER_FIXED:
+		g.printf(" %s[%d]", d.Name, d.Modifier.Size)
+	case ast.DECLARATION_MODIFIER_FLEXIBLE:
+		g.printf(" %s<%d>", d.Name, d.Modifier.Size)
+	case ast.DECLARATION_MODIFIER_UNBOUNDED:
+		g.printf(" %s<>", d.Name)
+	default:
+		return fmt.Errorf("Unknown declaration modifier %s", d.Modifier.Kind)
+	}
+	return nil
+}
+
+var typeKeywords = map[ast.TypeKind]string{
+	ast.TYPE_VOID:           "void",
+	ast.TYPE_BOOL:           "bool",
+	ast.TYPE_INT:            "int",
+	ast.TYPE_UNSIGNED_INT:   "unsigned int",
+	ast.TYPE_HYPER:          "hyper",
+	ast.TYPE_UNSIGNED_HYPER: "unsigned hyper",
+	ast.TYPE_FLOAT:          "float",
+	ast.TYPE_DOUBLE:         "double",
+	ast.TYPE_STRING:         "string",
+	ast.TYPE_OPAQUE:         "opaque",
+}
+
+// typeSpecifier prints a type specifier. Anonymous types are printed inline
+func (g *generator) typeSpecifier(t *ast.Type) error {
+	if kw, ok := typeKeywords[t.Kind]; ok {
+		g.printf("%s", kw)
+		return nil
+	}
+
+	switch t.Kind {
+	case ast.TYPE_REF:
+		if t.Ref >= uint32(len(g.s.Definitions)) {
+			return fmt.Errorf("Reference to nonexistent definition %d", t.Ref)
+		}
+		g.printf("%s", g.s.Definitions[t.Ref].Name)
+		return nil
+	case ast.TYPE_STRUCT:
+		g.printf("struct ")
+		return g.structBody(t.StructSpec)
+	case ast.TYPE_UNION:
+		g.printf("union ")
+		return g.unionBody(t.UnionSpec)
+	case ast.TYPE_ENUM:
+		g.printf("enum ")
+		return g.enumBody(t.EnumSpec)
+	default:
+		return fmt.Errorf("A %s can't be used as an anonymous type", t.Kind)
+	}
+}
+
+// attributes prints attributes on the lines preceding the item they belong
+// to. Documentation is printed as a comment, if it can be
+func (g *generator) attributes(a ast.Attributes) error {
+	if err := g.doc(a); err != nil {
+		return err
+	}
+
+	rest := a
+	if isCommentDoc(a["doc"]) {
+		rest = withoutDoc(a)
+	}
+	if len(rest) == 0 {
+		return nil
+	}
+
+	attrs, err := attributes(rest)
+	if err != nil {
+		return err
+	}
+	g.printf("%s\n", attrs)
+	return nil
+}
+
+// doc prints the documentation of an item as a comment, if it can be
+func (g *generator) doc(a ast.Attributes) error {
+	if v := a["doc"]; isCommentDoc(v) {
+		for _, line := range strings.Split(v.VString, "\n") {
+			if line == "" {
+				g.printf("//\n")
+			} else {
+				g.printf("// %s\n", line)
+			}
+		}
+	}
+	return nil
+}
+
+func withoutDoc(a ast.Attributes) ast.Attributes {
+	rest := make(ast.Attributes)
+	for name, v := range a {
+		if name != "doc" {
+			rest[name] = v
+		}
+	}
+	return rest
+}
+
+// isCommentDoc returns true if documentation would be parsed back from a
+// comment unchanged
+func isCommentDoc(v *ast.Constant) bool {
+	if v == nil || v.Type != ast.CONST_STRING || v.VString == "" {
+		return false
+	}
+
+	for _, line := range strings.Split(v.VString, "\n") {
+		if line != strings.TrimSpace(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// attributes formats an attribute set, sorted by name
+func attributes(a ast.Attributes) (string, error) {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		v := a[name]
+		if v.Type == ast.CONST_BOOL && v.VBool {
+			parts[i] = name
+			continue
+		}
+
+		str, err := constant(v)
+		if err != nil {
+			return "", fmt.Errorf("Attribute '%s': %s", name, err)
+		}
+		parts[i] = fmt.Sprintf("%s(%s)", name, str)
+	}
+	return "[" + strings.Join(parts, ", ") + "]", nil
+}
+
+// constant formats the value of a constant
+func constant(c *ast.Constant) (string, error) {
+	switch c.Type {
+	case ast.CONST_POS_INT:
+		return strconv.FormatUint(c.VPosInt, 10), nil
+	case ast.CONST_NEG_INT:
+		return "-" + strconv.FormatUint(c.VNegInt, 10), nil
+	case ast.CONST_ENUM:
+		return strconv.FormatInt(int64(c.VEnum), 10), nil
+	case ast.CONST_STRING:
+		return strconv.Quote(c.VString), nil
+	case ast.CONST_FLOAT:
+		if math.IsInf(c.VFloat, 0) || math.IsNaN(c.VFloat) {
+			break
+		}
+
+		// Ensure that the value is read back as a float
+		str := strconv.FormatFloat(c.VFloat, 'g', -1, 64)
+		if !strings.ContainsAny(str, ".e") {
+			str += ".0"
+		}
+		return str, nil
+	}
+	return "", fmt.Errorf("A %s constant with value %s can't be represented", c.Type, constantValue(c))
+}
+
+func constantValue(c *ast.Constant) string {
+	switch c.Type {
+	case ast.CONST_BOOL:
+		return strconv.FormatBool(c.VBool)
+	case ast.CONST_FLOAT:
+		return strconv.FormatFloat(c.VFloat, 'g', -1, 64)
+	}
+	return "void"
+}
@@ -0,0 +1,76 @@
+package genx
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"go.e43.eu/xdrgen/ast"
+	"go.e43.eu/xdrgen/parser"
+)
+
+var locationType = reflect.TypeOf((*ast.Location)(nil))
+
+// clearLocations clears every location in v, which can't be expected to
+// survive generating source
+func clearLocations(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type() == locationType {
+			v.Set(reflect.Zero(locationType))
+		} else if !v.IsNil() {
+			clearLocations(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				clearLocations(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearLocations(v.Index(i))
+		}
+	}
+}
+
+func parseFile(t *testing.T, name string) *ast.Specification {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s, err := parser.ParseSpecification(f, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// TestRoundTrip checks that the source generated for a specification
+// parses to the same specification
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{"testdata/roundtrip.x", "../../ast/ast.x"} {
+		s := parseFile(t, name)
+		src, err := GenSpecification(s)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		parsed, err := parser.ParseSpecification(bytes.NewReader(src), name)
+		if err != nil {
+			t.Fatalf("%s: parsing generated source: %v\n%s", name, err, src)
+		}
+
+		clearLocations(reflect.ValueOf(s))
+		clearLocations(reflect.ValueOf(parsed))
+		if !reflect.DeepEqual(s, parsed) {
+			want, _ := json.MarshalIndent(s, "", "  ")
+			got, _ := json.MarshalIndent(parsed, "", "  ")
+			t.Errorf("%s: generated source\n%s\nparses as\n%s\nexpected\n%s", name, src, got, want)
+		}
+	}
+}
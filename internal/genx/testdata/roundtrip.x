@@ -0,0 +1,82 @@
+#[doc("Every kind of definition, to test that the generated source parses to the same specification")]
+
+%#include <stdint.h>
+
+const FHSIZE = 32;
+const MAXNAME = 0x100;
+const NEGATIVE = -5;
+const DERIVED = (FHSIZE * 2) + 1;
+
+[doc("Status of a call")]
+enum stat {
+	OK = 0,
+	[doc("An error")]
+	ERR_IO = 5,
+	ERR_X = -1,
+	ERR_MIN = -2147483648
+};
+
+typedef opaque fhandle[FHSIZE];
+typedef string filename<MAXNAME>;
+typedef unsigned hyper sizes<>;
+typedef int *maybe_int;
+typedef float coords[3];
+
+struct entry {
+	filename name;
+	unsigned hyper size;
+	double mtime;
+	bool directory;
+	entry *next;
+};
+
+struct node {
+	opaque data<>;
+	struct {
+		int x;
+		union switch (bool set) {
+		case 1:
+			hyper value;
+		case 0:
+			void;
+		} inner;
+	} nested;
+	enum { RED = 1, GREEN = 2 } colour;
+};
+
+union result switch (stat status) {
+case OK:
+	entry *entries;
+case ERR_X:
+case ERR_MIN:
+	int detail;
+default:
+	void;
+};
+
+union big switch (unsigned int kind) {
+case 0:
+	void;
+case 0xFFFFFFFF:
+	string text<>;
+};
+
+union signed_res switch (int d) {
+case -1:
+	int negative;
+case 1:
+	float unused;
+default:
+	fhandle fh;
+};
+
+program FILES_PROGRAM {
+	version FILES_V1 {
+		void FILESPROC_NULL(void) = 0;
+		[doc("Looks up a name")]
+		result FILESPROC_LOOKUP(fhandle, filename) = 1;
+	} = 1;
+	version FILES_V2 {
+		void FILESPROC_NULL(void) = 0;
+	} = 2;
+} = 0x20000002;
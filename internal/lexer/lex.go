@@ -3,9 +3,12 @@ package lexer
 import (
 	"fmt"
 	"io"
-	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"text/scanner"
+
+	"go.e43.eu/xdrgen/diag"
 )
 
 const (
@@ -25,14 +28,25 @@ const (
 	TokFloat
 	TokInt
 	TokHyper
+	TokImport
 	TokOpaque
+	TokProgram
 	TokString
 	TokStruct
 	TokSwitch
 	TokTypedef
 	TokUnion
 	TokUnsigned
+	TokVersion
 	TokVoid
+
+	// Operators consisting of more than one character
+	TokShl
+	TokShr
+
+	// Tokens only returned in raw mode
+	TokComment
+	TokLine
 )
 
 var (
@@ -45,29 +59,58 @@ var (
 		TokEnum:     "enum",
 		TokFloat:    "float",
 		TokHyper:    "hyper",
+		TokImport:   "import",
 		TokInt:      "int",
 		TokOpaque:   "opaque",
+		TokProgram:  "program",
 		TokString:   "string",
 		TokStruct:   "struct",
 		TokSwitch:   "switch",
 		TokTypedef:  "typedef",
 		TokUnion:    "union",
 		TokUnsigned: "unsigned",
+		TokVersion:  "version",
 		TokVoid:     "void",
 	}
 	stringToTok map[string]rune
+
+	// contextualKeywords are only keywords where an identifier can't appear
+	// (at the top level of a specification, or within a program), so that
+	// specifications which predate them may still use them as identifiers.
+	// They are scanned as identifiers, and matched by Token.Is
+	contextualKeywords = map[rune]bool{
+		TokImport:  true,
+		TokProgram: true,
+		TokVersion: true,
+	}
+
+	operatorToString = map[rune]string{
+		TokShl: "<<",
+		TokShr: ">>",
+	}
+
+	rawToString = map[rune]string{
+		TokComment: "comment",
+		TokLine:    "passthrough line or directive",
+	}
 )
 
 func init() {
 	stringToTok = make(map[string]rune)
 	for k, v := range tokToString {
-		stringToTok[v] = k
+		if !contextualKeywords[k] {
+			stringToTok[v] = k
+		}
 	}
 }
 
 func tokenIDName(r rune) string {
 	if s, ok := tokToString[r]; ok {
 		return s
+	} else if s, ok := operatorToString[r]; ok {
+		return strconv.Quote(s)
+	} else if s, ok := rawToString[r]; ok {
+		return s
 	}
 	return scanner.TokenString(r)
 }
@@ -76,18 +119,36 @@ type Token struct {
 	ID       rune
 	Value    string
 	Position scanner.Position
+	// End is the position immediately following the token
+	End scanner.Position
+	// Doc is the text of the comments immediately preceding the token, with
+	// the comment markers removed
+	Doc string
 }
 
 func (t *Token) String() string {
 	return tokenIDName(t.ID)
 }
 
+// Is returns if the token is tok, or is the identifier spelling the
+// contextual keyword tok
+func (t *Token) Is(tok rune) bool {
+	if t.ID == TokIdent && contextualKeywords[tok] {
+		return t.Value == tokToString[tok]
+	}
+	return t.ID == tok
+}
+
 func (t *Token) Error(str string) error {
-	return fmt.Errorf("%s: %s\n", t.Position, str)
+	return diag.Errorf(t.Position, "%s", str)
 }
 
 func (t *Token) Errorf(fmts string, params ...interface{}) error {
-	return t.Error(fmt.Sprintf(fmts, params...))
+	return diag.Errorf(t.Position, fmts, params...)
+}
+
+func (t *Token) Warnf(fmts string, params ...interface{}) *diag.Diagnostic {
+	return diag.Warnf(t.Position, fmts, params...)
 }
 
 func (t *Token) Unexpected(ctx string, toks ...rune) error {
@@ -105,8 +166,38 @@ func (t *Token) Unexpected(ctx string, toks ...rune) error {
 }
 
 type Lexer struct {
-	s  *scanner.Scanner
-	nt *Token
+	// Raw, if set, causes comments, passthrough lines and preprocessor
+	// directives to be returned as tokens (TokComment and TokLine) rather than
+	// interpreted. Positions are not adjusted by line markers
+	Raw bool
+
+	s     *scanner.Scanner
+	nt    *Token
+	depth int
+	diags diag.List
+
+	// The last two tokens consumed, so that we can restore last on Unget
+	last, prevLast *Token
+
+	// The line on which the last token scanned ended, used to distinguish
+	// trailing comments from leading ones
+	lastLine int
+
+	// The file name and line offset set by the last line marker, which are
+	// applied to the positions of tokens following it
+	markerFile  string
+	markerDelta int
+	hasMarker   bool
+
+	// The passthrough lines scanned and not yet taken
+	passthroughs []*Passthrough
+}
+
+// Passthrough is a line beginning with '%', which rpcgen copies to its output
+type Passthrough struct {
+	// Text is the text of the line following the '%'
+	Text          string
+	Position, End scanner.Position
 }
 
 func NewLexer(rdr io.Reader, filename string) *Lexer {
@@ -116,51 +207,289 @@ func NewLexer(rdr io.Reader, filename string) *Lexer {
 	}
 
 	l.s.Init(rdr)
+	l.s.Mode = scanner.GoTokens &^ scanner.SkipComments
 	l.s.Error = func(s *scanner.Scanner, err string) {
 		pos := l.s.Position
 		if !pos.IsValid() {
 			pos = s.Pos()
 		}
-		fmt.Fprintf(os.Stderr, "%s: %s\n", pos, err)
-		os.Exit(1)
+		l.diags.Add(diag.Errorf(l.mapPosition(pos), "%s", err))
 	}
 
 	l.s.Position.Filename = filename
 	return l
 }
 
+// Report records a diagnostic. Errors which are not diagnostics are
+// reported at the current position
+func (l *Lexer) Report(err error) {
+	l.diags.AddError(l.Position(), err)
+}
+
+// Diagnostics returns the diagnostics reported so far
+func (l *Lexer) Diagnostics() diag.List {
+	return l.diags
+}
+
+// Depth returns the number of braces which have been opened and not yet
+// closed by the tokens consumed so far. Unbalanced closing braces may
+// cause this to become negative
+func (l *Lexer) Depth() int {
+	return l.depth
+}
+
 func (l *Lexer) Position() scanner.Position {
 	if l.s.Position.IsValid() {
-		return l.s.Position
+		return l.mapPosition(l.s.Position)
 	} else {
-		return l.s.Pos()
+		return l.mapPosition(l.s.Pos())
 	}
 }
 
+// mapPosition maps a position in the input to the position in the original
+// source given by the last line marker
+func (l *Lexer) mapPosition(pos scanner.Position) scanner.Position {
+	if l.hasMarker {
+		pos.Filename = l.markerFile
+		pos.Line += l.markerDelta
+	}
+	return pos
+}
+
+// Passthroughs returns the passthrough lines scanned since it was last
+// called. Lines are scanned ahead of the tokens following them
+func (l *Lexer) Passthroughs() []*Passthrough {
+	p := l.passthroughs
+	l.passthroughs = nil
+	return p
+}
+
+// LastEnd returns the position immediately following the last token consumed
+func (l *Lexer) LastEnd() scanner.Position {
+	if l.last == nil {
+		return l.Position()
+	}
+	return l.last.End
+}
+
 func (l *Lexer) Peek() *Token {
 	if l.nt == nil {
+		l.nt = l.scan()
+	}
+
+	return l.nt
+}
+
+// scan scans the next token, collecting the comments preceding it.
+//
+// Comments on consecutive lines form a group. The last group becomes the
+// documentation of the token if there is no blank line between them. Comments
+// which begin on the same line as the end of the previous token are trailing
+// comments, and are ignored.
+//
+// Lines beginning with '%' are passthrough lines, and are collected separately.
+// Lines beginning with '#' (other than spec attributes) are line markers, as
+// output by the C preprocessor
+func (l *Lexer) scan() *Token {
+	var (
+		doc    []string
+		docEnd int
+	)
+
+	for {
 		id := l.s.Scan()
+		if l.Raw {
+			return l.scanRaw(id)
+		}
 
-		l.nt = &Token{
-			ID:       id,
-			Value:    l.s.TokenText(),
-			Position: l.s.Position,
+		if (id == '%' || id == '#') && l.s.Position.Column == 1 && l.scanLine(id) {
+			doc = nil
+			continue
 		}
 
-		if id == TokIdent {
-			if newID, ok := stringToTok[l.nt.Value]; ok {
-				l.nt.ID = newID
+		if id != scanner.Comment {
+			t := l.token(id)
+			if len(doc) > 0 && docEnd >= t.Position.Line-1 {
+				t.Doc = strings.Join(doc, "\n")
 			}
+
+			l.lastLine = t.End.Line
+			t.Position = l.mapPosition(t.Position)
+			t.End = l.mapPosition(t.End)
+			return t
 		}
+
+		pos := l.s.Position
+		switch {
+		case pos.Line == l.lastLine:
+			continue
+		case len(doc) > 0 && pos.Line > docEnd+1:
+			doc = commentText(l.s.TokenText())
+		default:
+			doc = append(doc, commentText(l.s.TokenText())...)
+		}
+		docEnd = l.s.Pos().Line
 	}
+}
 
-	return l.nt
+// token returns the token whose first character has just been scanned
+func (l *Lexer) token(id rune) *Token {
+	t := &Token{
+		ID:       id,
+		Value:    l.s.TokenText(),
+		Position: l.s.Position,
+		End:      l.s.Pos(),
+	}
+
+	switch id {
+	case TokIdent:
+		if newID, ok := stringToTok[t.Value]; ok {
+			t.ID = newID
+		}
+
+	case '<', '>':
+		// Shift operators are only recognised when their characters
+		// are adjacent
+		if l.s.Peek() == id {
+			l.s.Next()
+			t.ID = TokShl
+			if id == '>' {
+				t.ID = TokShr
+			}
+			t.Value += t.Value
+			t.End = l.s.Pos()
+		}
+	}
+	return t
+}
+
+// scanRaw returns the token whose first character has just been scanned in
+// raw mode. Comments, passthrough lines and preprocessor directives (which,
+// as in C, may be indented) are returned as tokens
+func (l *Lexer) scanRaw(id rune) *Token {
+	pos := l.s.Position
+	var t *Token
+	switch {
+	case id == scanner.Comment:
+		t = &Token{ID: TokComment, Value: l.s.TokenText(), Position: pos, End: l.s.Pos()}
+
+	case id == '%' && pos.Column == 1,
+		id == '#' && pos.Line > l.lastLine && l.s.Peek() != '[':
+		text, end := l.readLine(id == '#')
+		t = &Token{ID: TokLine, Value: string(id) + text, Position: pos, End: end}
+
+	default:
+		t = l.token(id)
+	}
+
+	l.lastLine = t.End.Line
+	return t
+}
+
+// readLine reads the remainder of the current line, returning its text and
+// the position of its end. The newline is consumed. If continued is set,
+// lines ending with a backslash are continued by the next, as for
+// preprocessor directives
+func (l *Lexer) readLine(continued bool) (string, scanner.Position) {
+	var b strings.Builder
+	for ch := l.s.Peek(); ch != scanner.EOF; ch = l.s.Peek() {
+		if ch == '\n' {
+			if !continued || !strings.HasSuffix(strings.TrimSuffix(b.String(), "\r"), "\\") {
+				break
+			}
+		}
+		b.WriteRune(l.s.Next())
+	}
+	text := strings.TrimSuffix(b.String(), "\r")
+	end := l.s.Pos()
+	l.s.Next()
+	return text, end
+}
+
+// lineMarkerRe matches the line markers output by the C preprocessor, in
+// both the '# 12 "file"' and '#line 12 "file"' forms. Any flags following
+// the file name are ignored
+var lineMarkerRe = regexp.MustCompile(`^(?:line)?[ \t]+([0-9]+)(?:[ \t]+"((?:[^"\\]|\\.)*)")?(?:[ \t]+[0-9]+)*[ \t]*$`)
+
+// scanLine handles a line beginning with '%' or '#', whose first character
+// has just been scanned. It returns false if the line should instead be
+// scanned as tokens, which is the case for spec attributes
+func (l *Lexer) scanLine(id rune) bool {
+	if id == '#' && l.s.Peek() == '[' {
+		return false
+	}
+
+	pos := l.s.Position
+	text, end := l.readLine(false)
+	if id == '%' {
+		l.passthroughs = append(l.passthroughs, &Passthrough{
+			Text:     text,
+			Position: l.mapPosition(pos),
+			End:      l.mapPosition(end),
+		})
+		return true
+	}
+
+	m := lineMarkerRe.FindStringSubmatch(text)
+	if m == nil {
+		l.diags.Add(diag.Errorf(l.mapPosition(pos), "Unsupported preprocessor directive '#%s'", text))
+		return true
+	}
+
+	line, err := strconv.Atoi(m[1])
+	if err != nil {
+		l.diags.Add(diag.Errorf(l.mapPosition(pos), "Invalid line number in line marker: %s", err))
+		return true
+	}
+
+	if m[2] != "" {
+		file, err := strconv.Unquote(`"` + m[2] + `"`)
+		if err != nil {
+			file = m[2]
+		}
+		l.markerFile = file
+	} else if !l.hasMarker {
+		l.markerFile = pos.Filename
+	}
+
+	// The line following the marker has the line number it gives
+	l.markerDelta = line - (pos.Line + 1)
+	l.hasMarker = true
+	return true
+}
+
+// commentText returns the lines of a comment with the comment markers and
+// any leading asterisks removed
+func commentText(c string) []string {
+	if strings.HasPrefix(c, "//") {
+		return []string{strings.TrimSpace(c[2:])}
+	}
+
+	c = strings.TrimSuffix(strings.TrimPrefix(c, "/*"), "*/")
+	lines := strings.Split(c, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.Trim(line, "*") == "" {
+			line = ""
+		} else if strings.HasPrefix(line, "*") {
+			line = strings.TrimSpace(line[1:])
+		}
+		lines[i] = line
+	}
+
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
 }
 
 func (l *Lexer) PeekExpect(ctx string, toks ...rune) (*Token, error) {
 	t := l.Peek()
 	for _, tok := range toks {
-		if tok == t.ID {
+		if t.Is(tok) {
 			return t, nil
 		}
 	}
@@ -171,13 +500,21 @@ func (l *Lexer) PeekExpect(ctx string, toks ...rune) (*Token, error) {
 func (l *Lexer) Next() *Token {
 	t := l.Peek()
 	l.nt = nil
+	l.prevLast, l.last = l.last, t
+
+	switch t.ID {
+	case '{':
+		l.depth++
+	case '}':
+		l.depth--
+	}
 	return t
 }
 
 func (l *Lexer) NextOneOf(toks ...rune) *Token {
 	t := l.Next()
 	for _, tok := range toks {
-		if tok == t.ID {
+		if t.Is(tok) {
 			return t
 		}
 	}
@@ -186,11 +523,13 @@ func (l *Lexer) NextOneOf(toks ...rune) *Token {
 	return nil
 }
 
+// Expect consumes the next token if it is one of toks. Otherwise, it is left
+// unconsumed and an error is returned
 func (l *Lexer) Expect(ctx string, toks ...rune) (*Token, error) {
-	t := l.Next()
+	t := l.Peek()
 	for _, tok := range toks {
-		if tok == t.ID {
-			return t, nil
+		if t.Is(tok) {
+			return l.Next(), nil
 		}
 	}
 
@@ -203,4 +542,15 @@ func (l *Lexer) Unget(t *Token) {
 	} else {
 		panic("attempt to unget a token when there is already one in the buffer")
 	}
+
+	if l.last == t {
+		l.last = l.prevLast
+	}
+
+	switch t.ID {
+	case '{':
+		l.depth--
+	case '}':
+		l.depth++
+	}
 }
@@ -0,0 +1,308 @@
+package preproc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The binary operators of #if expressions, and their precedence
+var binaryPrec = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, ">": 7, "<=": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+}
+
+// Operators of more than one character
+var longOperators = []string{"<<", ">>", "<=", ">=", "==", "!=", "&&", "||"}
+
+// evaluate evaluates the expression of an #if directive. Macros are
+// expanded, and any identifiers which remain are replaced by 0
+func (p *preprocessor) evaluate(expr string) (int64, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return 0, err
+	}
+
+	toks, err = p.expandTokens(toks, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(toks) == 0 {
+		return 0, errors.New("Missing expression")
+	}
+
+	e := &exprParser{toks: toks}
+	v, err := e.conditional()
+	if err != nil {
+		return 0, err
+	} else if e.pos < len(toks) {
+		return 0, fmt.Errorf("Unexpected '%s'", toks[e.pos])
+	}
+	return v, nil
+}
+
+// expandTokens evaluates defined operators and expands macros
+func (p *preprocessor) expandTokens(toks []string, disabled map[string]bool) ([]string, error) {
+	var out []string
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch {
+		case t == "defined":
+			var name string
+			switch {
+			case i+1 < len(toks) && isIdent(toks[i+1]):
+				name = toks[i+1]
+				i++
+			case i+3 < len(toks) && toks[i+1] == "(" && isIdent(toks[i+2]) && toks[i+3] == ")":
+				name = toks[i+2]
+				i += 3
+			default:
+				return nil, errors.New("Operator 'defined' requires a macro name")
+			}
+
+			if _, ok := p.macros[name]; ok {
+				out = append(out, "1")
+			} else {
+				out = append(out, "0")
+			}
+
+		case isIdent(t):
+			value, ok := p.macros[t]
+			if !ok || disabled[t] {
+				out = append(out, "0")
+				continue
+			}
+
+			inner := map[string]bool{t: true}
+			for n := range disabled {
+				inner[n] = true
+			}
+
+			vtoks, err := tokenize(value)
+			if err != nil {
+				return nil, fmt.Errorf("In expansion of '%s': %s", t, err)
+			}
+			vtoks, err = p.expandTokens(vtoks, inner)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, vtoks...)
+
+		default:
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func tokenize(expr string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+
+		case isIdentChar(rune(c)):
+			j := i + 1
+			for j < len(expr) && isIdentChar(rune(expr[j])) {
+				j++
+			}
+			toks = append(toks, expr[i:j])
+			i = j
+
+		case strings.ContainsRune("+-*/%<>=!&|^~()?:", rune(c)):
+			tok := expr[i : i+1]
+			for _, op := range longOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					tok = op
+					break
+				}
+			}
+			toks = append(toks, tok)
+			i += len(tok)
+
+		default:
+			return nil, fmt.Errorf("Unexpected character %q", c)
+		}
+	}
+	return toks, nil
+}
+
+type exprParser struct {
+	toks []string
+	pos  int
+}
+
+func (e *exprParser) peek() string {
+	if e.pos < len(e.toks) {
+		return e.toks[e.pos]
+	}
+	return ""
+}
+
+func (e *exprParser) expect(tok string) error {
+	if t := e.peek(); t != tok {
+		if t == "" {
+			return fmt.Errorf("Expected '%s' at end of expression", tok)
+		}
+		return fmt.Errorf("Expected '%s', found '%s'", tok, t)
+	}
+	e.pos++
+	return nil
+}
+
+func (e *exprParser) conditional() (int64, error) {
+	cond, err := e.binary(1)
+	if err != nil || e.peek() != "?" {
+		return cond, err
+	}
+	e.pos++
+
+	a, err := e.conditional()
+	if err != nil {
+		return 0, err
+	}
+	if err := e.expect(":"); err != nil {
+		return 0, err
+	}
+	b, err := e.conditional()
+	if err != nil {
+		return 0, err
+	}
+
+	if cond != 0 {
+		return a, nil
+	}
+	return b, nil
+}
+
+func (e *exprParser) binary(minPrec int) (int64, error) {
+	x, err := e.unary()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		op := e.peek()
+		prec, ok := binaryPrec[op]
+		if !ok || prec < minPrec {
+			return x, nil
+		}
+		e.pos++
+
+		y, err := e.binary(prec + 1)
+		if err != nil {
+			return 0, err
+		}
+
+		if x, err = applyBinary(op, x, y); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (e *exprParser) unary() (int64, error) {
+	t := e.peek()
+	if t == "" {
+		return 0, errors.New("Unexpected end of expression")
+	}
+	e.pos++
+
+	switch t {
+	case "-", "+", "!", "~":
+		x, err := e.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch t {
+		case "-":
+			return -x, nil
+		case "+":
+			return x, nil
+		case "!":
+			return boolValue(x == 0), nil
+		default:
+			return ^x, nil
+		}
+
+	case "(":
+		x, err := e.conditional()
+		if err != nil {
+			return 0, err
+		}
+		return x, e.expect(")")
+	}
+
+	if !isDigit(t[0]) {
+		return 0, fmt.Errorf("Unexpected '%s'", t)
+	}
+
+	// Integer suffixes make no difference to us
+	v, err := strconv.ParseUint(strings.TrimRight(t, "uUlL"), 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid integer '%s'", t)
+	}
+	return int64(v), nil
+}
+
+func applyBinary(op string, x, y int64) (int64, error) {
+	switch op {
+	case "||":
+		return boolValue(x != 0 || y != 0), nil
+	case "&&":
+		return boolValue(x != 0 && y != 0), nil
+	case "|":
+		return x | y, nil
+	case "^":
+		return x ^ y, nil
+	case "&":
+		return x & y, nil
+	case "==":
+		return boolValue(x == y), nil
+	case "!=":
+		return boolValue(x != y), nil
+	case "<":
+		return boolValue(x < y), nil
+	case ">":
+		return boolValue(x > y), nil
+	case "<=":
+		return boolValue(x <= y), nil
+	case ">=":
+		return boolValue(x >= y), nil
+	case "<<":
+		return x << uint64(y), nil
+	case ">>":
+		return x >> uint64(y), nil
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	}
+
+	if y == 0 {
+		return 0, errors.New("Division by zero")
+	}
+	if op == "/" {
+		return x / y, nil
+	}
+	return x % y, nil
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
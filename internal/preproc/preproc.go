@@ -0,0 +1,461 @@
+// Package preproc implements the subset of the C preprocessor used by XDR
+// specifications which are shared with C programs: object-like macros,
+// conditionals and file inclusion.
+//
+// Comments are preserved, so that they may still be used as documentation.
+// The output contains line markers wherever its source changes, so that
+// positions reported by the lexer refer to the original files
+package preproc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"go.e43.eu/xdrgen/diag"
+)
+
+// The maximum depth of nested includes. Files may legitimately include
+// themselves when guarded by conditionals, so cycles can't be rejected
+// outright
+const maxIncludeDepth = 200
+
+// Config controls preprocessing
+type Config struct {
+	// IncludePath lists the directories searched for included files. Files
+	// included using quotes are first searched for relative to the including
+	// file
+	IncludePath []string
+
+	// Defines holds the macros defined before preprocessing, by name
+	Defines map[string]string
+}
+
+// Process preprocesses the source read from rdr. filename is used in
+// diagnostics and as the base for resolving relative includes. If any
+// errors are found, they are returned as a diag.List
+func (c *Config) Process(rdr io.Reader, filename string) ([]byte, error) {
+	p := &preprocessor{
+		config: c,
+		macros: make(map[string]string),
+	}
+	for name, value := range c.Defines {
+		p.macros[name] = value
+	}
+
+	if err := p.processFile(rdr, filename, 0); err != nil {
+		p.diags.AddError(scanner.Position{Filename: filename}, err)
+	}
+
+	p.diags.Sort()
+	if p.diags.HasErrors() {
+		return nil, p.diags
+	}
+	return p.out.Bytes(), nil
+}
+
+type preprocessor struct {
+	config *Config
+	macros map[string]string
+	out    bytes.Buffer
+	diags  diag.List
+}
+
+// file holds the state of the preprocessing of a single file
+type file struct {
+	name string
+	// line is the number of the line being processed
+	line int
+	// inComment is set if the line being processed begins within a block
+	// comment
+	inComment bool
+	conds     []*conditional
+}
+
+// conditional is an open #if, #ifdef or #ifndef directive
+type conditional struct {
+	pos scanner.Position
+	// active is set if lines in the current branch are included
+	active bool
+	// taken is set if any branch has been included
+	taken bool
+	// sawElse is set once the #else branch has been reached
+	sawElse bool
+	// outer is set if lines surrounding the conditional are included
+	outer bool
+}
+
+func (f *file) active() bool {
+	return len(f.conds) == 0 || f.conds[len(f.conds)-1].active
+}
+
+func (f *file) pos() scanner.Position {
+	return scanner.Position{Filename: f.name, Line: f.line, Column: 1}
+}
+
+func (p *preprocessor) processFile(rdr io.Reader, name string, depth int) error {
+	f := &file{name: name}
+	sc := bufio.NewScanner(rdr)
+	sc.Buffer(nil, 1<<20)
+
+	for sc.Scan() {
+		f.line++
+		start := f.line
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		for strings.HasSuffix(line, "\\") && sc.Scan() {
+			line = line[:len(line)-1] + strings.TrimSuffix(sc.Text(), "\r")
+			f.line++
+		}
+
+		trimmed := strings.TrimLeft(line, " \t")
+		switch {
+		case !f.inComment && isDirective(trimmed):
+			if p.directive(f, trimmed[1:], depth) {
+				break
+			}
+			fallthrough
+
+		default:
+			if !f.active() {
+				f.scanLine(line, false, nil)
+			} else if strings.HasPrefix(line, "%") && !f.inComment {
+				// Passthrough lines are copied untouched
+				p.out.WriteString(line)
+			} else {
+				p.out.WriteString(f.scanLine(line, true, func(name string) string {
+					return p.expand(name, nil)
+				}))
+			}
+			p.out.WriteByte('\n')
+		}
+
+		// Keep the line numbers of the output in step with the input
+		for i := start; i < f.line; i++ {
+			p.out.WriteByte('\n')
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	for _, c := range f.conds {
+		p.diags.Add(diag.Errorf(c.pos, "Unterminated conditional directive"))
+	}
+	return nil
+}
+
+// isDirective returns true if a line, with leading whitespace removed, is a
+// preprocessor directive. Spec attributes, which also begin with '#', are not
+func isDirective(line string) bool {
+	return strings.HasPrefix(line, "#") &&
+		!strings.HasPrefix(strings.TrimLeft(line[1:], " \t"), "[")
+}
+
+// directive processes a directive, following the '#'. It returns false if
+// the line should instead be copied to the output, which is the case for
+// line markers
+func (p *preprocessor) directive(f *file, text string, depth int) bool {
+	pos := f.pos()
+	text = strings.TrimSpace(f.scanLine(text, false, nil))
+	name, arg := text, ""
+	if i := strings.IndexAny(text, " \t(\"<"); i >= 0 {
+		name, arg = text[:i], strings.TrimSpace(text[i:])
+	}
+
+	switch name {
+	case "if", "ifdef", "ifndef":
+		c := &conditional{pos: pos, outer: f.active()}
+		if c.outer {
+			c.active = p.condition(pos, name, arg)
+			c.taken = c.active
+		}
+		f.conds = append(f.conds, c)
+
+	case "elif", "else":
+		if len(f.conds) == 0 {
+			p.diags.Add(diag.Errorf(pos, "#%s without #if", name))
+			break
+		}
+
+		c := f.conds[len(f.conds)-1]
+		if c.sawElse {
+			p.diags.Add(diag.Errorf(pos, "#%s after #else", name))
+			break
+		}
+		c.sawElse = name == "else"
+		c.active = c.outer && !c.taken && (name == "else" || p.condition(pos, "if", arg))
+		c.taken = c.taken || c.active
+
+	case "endif":
+		if len(f.conds) == 0 {
+			p.diags.Add(diag.Errorf(pos, "#endif without #if"))
+			break
+		}
+		f.conds = f.conds[:len(f.conds)-1]
+
+	default:
+		if !f.active() {
+			break
+		}
+		return p.activeDirective(f, pos, name, arg, depth)
+	}
+
+	p.out.WriteByte('\n')
+	return true
+}
+
+// activeDirective processes the directives which only take effect outside
+// of excluded conditional branches
+func (p *preprocessor) activeDirective(f *file, pos scanner.Position, name, arg string, depth int) bool {
+	switch {
+	case name == "":
+		// The null directive
+
+	case name == "define":
+		macro, value := arg, ""
+		if i := strings.IndexFunc(arg, func(r rune) bool { return !isIdentChar(r) }); i >= 0 {
+			macro, value = arg[:i], arg[i:]
+		}
+
+		switch {
+		case !isIdent(macro):
+			p.diags.Add(diag.Errorf(pos, "Macro name missing from #define"))
+		case strings.HasPrefix(value, "("):
+			p.diags.Add(diag.Errorf(pos, "Function-like macro '%s' is not supported", macro))
+		default:
+			p.macros[macro] = strings.TrimSpace(value)
+		}
+
+	case name == "undef":
+		if !isIdent(arg) {
+			p.diags.Add(diag.Errorf(pos, "Macro name missing from #undef"))
+		}
+		delete(p.macros, arg)
+
+	case name == "include":
+		return p.include(f, pos, arg, depth)
+
+	case name == "error":
+		p.diags.Add(diag.Errorf(pos, "#error %s", arg))
+
+	case name == "pragma":
+		// Pragmas are for the C compiler
+
+	case name == "line" || isNumber(name):
+		// Line markers are handled by the lexer
+		return false
+
+	default:
+		p.diags.Add(diag.Errorf(pos, "Unsupported preprocessor directive '#%s'", name))
+	}
+
+	p.out.WriteByte('\n')
+	return true
+}
+
+// condition evaluates the condition of an #if, #ifdef or #ifndef directive
+func (p *preprocessor) condition(pos scanner.Position, directive, arg string) bool {
+	if directive == "if" {
+		v, err := p.evaluate(arg)
+		if err != nil {
+			p.diags.Add(diag.Errorf(pos, "In #if: %s", err))
+			return false
+		}
+		return v != 0
+	}
+
+	if !isIdent(arg) {
+		p.diags.Add(diag.Errorf(pos, "Macro name missing from #%s", directive))
+		return false
+	}
+	_, ok := p.macros[arg]
+	return ok == (directive == "ifdef")
+}
+
+// include processes an #include directive
+func (p *preprocessor) include(f *file, pos scanner.Position, arg string, depth int) bool {
+	var dirs []string
+	switch {
+	case len(arg) >= 2 && arg[0] == '"' && arg[len(arg)-1] == '"':
+		dirs = append([]string{filepath.Dir(f.name)}, p.config.IncludePath...)
+	case len(arg) >= 2 && arg[0] == '<' && arg[len(arg)-1] == '>':
+		dirs = p.config.IncludePath
+	default:
+		p.diags.Add(diag.Errorf(pos, "#include expects \"FILENAME\" or <FILENAME>"))
+		p.out.WriteByte('\n')
+		return true
+	}
+	path := arg[1 : len(arg)-1]
+
+	fname := ""
+	if filepath.IsAbs(path) {
+		fname = path
+	} else {
+		for _, dir := range dirs {
+			if _, err := os.Stat(filepath.Join(dir, path)); err == nil {
+				fname = filepath.Join(dir, path)
+				break
+			}
+		}
+	}
+
+	switch {
+	case fname == "":
+		p.diags.Add(diag.Errorf(pos, "Unable to find '%s' in include path", path))
+		p.out.WriteByte('\n')
+		return true
+	case depth >= maxIncludeDepth:
+		p.diags.Add(diag.Errorf(pos, "#include nested too deeply"))
+		p.out.WriteByte('\n')
+		return true
+	}
+
+	inc, err := os.Open(fname)
+	if err != nil {
+		p.diags.Add(diag.Errorf(pos, "%s", err))
+		p.out.WriteByte('\n')
+		return true
+	}
+	defer inc.Close()
+
+	p.lineMarker(1, fname)
+	if err := p.processFile(inc, fname, depth+1); err != nil {
+		p.diags.Add(diag.Errorf(pos, "Reading '%s': %s", fname, err))
+	}
+	p.lineMarker(f.line+1, f.name)
+	return true
+}
+
+func (p *preprocessor) lineMarker(line int, fname string) {
+	p.out.WriteString("# " + strconv.Itoa(line) + " " + strconv.Quote(fname) + "\n")
+}
+
+// expand returns the expansion of an identifier. Macros are not expanded
+// within their own expansions
+func (p *preprocessor) expand(name string, disabled map[string]bool) string {
+	value, ok := p.macros[name]
+	if !ok || disabled[name] {
+		return name
+	}
+
+	inner := map[string]bool{name: true}
+	for n := range disabled {
+		inner[n] = true
+	}
+
+	f := new(file)
+	return f.scanLine(value, false, func(n string) string {
+		return p.expand(n, inner)
+	})
+}
+
+// scanLine scans a line, tracking whether it ends within a block comment.
+// Comments are removed unless keepComments is set. Identifiers outside of
+// comments and string and character constants are replaced by the result of
+// ident, if not nil
+func (f *file) scanLine(line string, keepComments bool, ident func(string) string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		if f.inComment {
+			end := strings.Index(line[i:], "*/")
+			if end < 0 {
+				if keepComments {
+					b.WriteString(line[i:])
+				}
+				break
+			}
+
+			if keepComments {
+				b.WriteString(line[i : i+end+2])
+			} else {
+				b.WriteByte(' ')
+			}
+			i += end + 2
+			f.inComment = false
+			continue
+		}
+
+		c := line[i]
+		j := i + 1
+		switch {
+		case strings.HasPrefix(line[i:], "/*"):
+			f.inComment = true
+			if keepComments {
+				b.WriteString("/*")
+			}
+			i += 2
+			continue
+
+		case strings.HasPrefix(line[i:], "//"):
+			if keepComments {
+				b.WriteString(line[i:])
+			}
+			i = len(line)
+			continue
+
+		case c == '"' || c == '\'':
+			for j < len(line) && line[j] != c {
+				if line[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(line) {
+				j++
+			} else {
+				j = len(line)
+			}
+
+		case isIdentChar(rune(c)):
+			for j < len(line) && isIdentChar(rune(line[j])) {
+				j++
+			}
+			if ident != nil && !isDigit(c) {
+				b.WriteString(ident(line[i:j]))
+				i = j
+				continue
+			}
+		}
+
+		b.WriteString(line[i:j])
+		i = j
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+func isIdent(s string) bool {
+	if s == "" || isDigit(s[0]) {
+		return false
+	}
+	for _, r := range s {
+		if !isIdentChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,239 @@
+package preproc
+
+import (
+	"strings"
+	"testing"
+)
+
+// lines returns the lines of output which aren't blank
+func lines(out []byte) []string {
+	var ls []string
+	for _, l := range strings.Split(string(out), "\n") {
+		if strings.TrimSpace(l) != "" {
+			ls = append(ls, l)
+		}
+	}
+	return ls
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name    string
+		defines map[string]string
+		src     string
+		out     []string
+	}{
+		{
+			"Nested conditionals",
+			nil,
+			"#define A\n#ifdef A\n#ifndef B\na\n#else\nnot a\n#endif\n#elif 1\nnot b\n#else\nnot c\n#endif\n",
+			[]string{"a"},
+		},
+		{
+			"#elif",
+			nil,
+			"#if 0\nnot a\n#elif 0\nnot b\n#elif 1\nc\n#elif 1\nnot d\n#else\nnot e\n#endif\n",
+			[]string{"c"},
+		},
+		{
+			"#else",
+			nil,
+			"#ifdef A\nnot a\n#elif defined B\nnot b\n#else\nc\n#endif\n",
+			[]string{"c"},
+		},
+		{
+			"Excluded nested conditionals",
+			nil,
+			"#if 0\n#if 1\nnot a\n#else\nnot b\n#endif\n#else\nc\n#endif\n",
+			[]string{"c"},
+		},
+		{
+			"Directives in excluded branches",
+			nil,
+			"#if 0\n#define A 1\n#include \"missing.h\"\n#bogus\n#error not reported\n#endif\nA\n",
+			[]string{"A"},
+		},
+		{
+			"Macro expansion",
+			nil,
+			"#define N 4\n#define M N * 2\nconst X = M; /* N */\n%N\n\"N\" 'N' N2\n#undef N\nN\n",
+			[]string{"const X = 4 * 2; /* N */", "%N", "\"N\" 'N' N2", "N"},
+		},
+		{
+			"Self-referential macros",
+			nil,
+			"#define X X + 1\n#define A B\n#define B A\nX A B\n",
+			[]string{"X + 1 A B"},
+		},
+		{
+			"Defaults for defines",
+			map[string]string{"N": "4"},
+			"#ifndef N\n#define N 2\n#endif\n#ifndef M\n#define M 3\n#endif\nN M\n",
+			[]string{"4 3"},
+		},
+		{
+			"Continued lines",
+			nil,
+			"#define A 1 \\\n + 2\nA\n",
+			[]string{"1  + 2"},
+		},
+		{
+			"Line markers and attributes",
+			nil,
+			"# 40 \"nfs.x\" 2\n#line 7\n#[doc(\"x\")]\n",
+			[]string{"# 40 \"nfs.x\" 2", "#line 7", "#[doc(\"x\")]"},
+		},
+	}
+
+	for _, test := range tests {
+		c := &Config{Defines: test.defines}
+		out, err := c.Process(strings.NewReader(test.src), "test.x")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if got := lines(out); strings.Join(got, "\n") != strings.Join(test.out, "\n") {
+			t.Errorf("%s: got\n\t%s\nexpected\n\t%s", test.name, strings.Join(got, "\n\t"), strings.Join(test.out, "\n\t"))
+		}
+	}
+}
+
+func TestConditionExpressions(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"1 + 2 * 3 == 7", true},
+		{"(1 + 2) * 3 == 7", false},
+		{"1 << 2 + 1 == 8", true},
+		{"1 | 2 ^ 3 & 1", true},
+		{"2 - 1 - 1", false},
+		{"-1 < 0 && !0", true},
+		{"0 || 0", false},
+		{"~0 == -1", true},
+		{"7 / 2 == 3 && 7 % 2 == 1", true},
+		{"0 ? 0 : 1 ? 2 : 0", true},
+		{"1 ? 0 : 1", false},
+		{"0x10 == 16", true},
+		{"defined A", true},
+		{"defined(A) && !defined B", true},
+		{"defined ( B )", false},
+		{"A == 2", true},
+		{"UNDEFINED", false},
+		{"UNDEFINED + 1", true},
+		{"SELF", false},
+	}
+
+	defines := map[string]string{"A": "2", "SELF": "SELF"}
+	for _, test := range tests {
+		c := &Config{Defines: defines}
+		out, err := c.Process(strings.NewReader("#if "+test.expr+"\ntrue\n#endif\n"), "test.x")
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+		} else if got := len(lines(out)) > 0; got != test.want {
+			t.Errorf("%s evaluated as %v, expected %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestProcessErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		errs []string
+	}{
+		{
+			"Division by zero",
+			"#if 1 / 0\n#endif\n#if 1 % (2 - 2)\n#endif\n",
+			[]string{
+				"test.x:1:1: error: In #if: Division by zero",
+				"test.x:3:1: error: In #if: Division by zero",
+			},
+		},
+		{
+			"Malformed conditions",
+			"#if\n#endif\n#if (1\n#endif\n#if defined\n#endif\n#ifdef\n#endif\n#if 1 ? 2\n#endif\n",
+			[]string{
+				"test.x:1:1: error: In #if: Missing expression",
+				"test.x:3:1: error: In #if: Expected ')' at end of expression",
+				"test.x:5:1: error: In #if: Operator 'defined' requires a macro name",
+				"test.x:7:1: error: Macro name missing from #ifdef",
+				"test.x:9:1: error: In #if: Expected ':' at end of expression",
+			},
+		},
+		{
+			"Unterminated conditionals",
+			"#ifdef A\n#if 1\n#endif\n#ifndef B\n",
+			[]string{
+				"test.x:1:1: error: Unterminated conditional directive",
+				"test.x:4:1: error: Unterminated conditional directive",
+			},
+		},
+		{
+			"Unmatched directives",
+			"#else\n#elif 1\n#endif\n#if 1\n#else\n#elif 1\n#else\n#endif\n",
+			[]string{
+				"test.x:1:1: error: #else without #if",
+				"test.x:2:1: error: #elif without #if",
+				"test.x:3:1: error: #endif without #if",
+				"test.x:6:1: error: #elif after #else",
+				"test.x:7:1: error: #else after #else",
+			},
+		},
+		{
+			"Unsupported directives",
+			"#define F(x) x\n#define\n#undef 1\n#import \"a.x\"\n#error Stop\n",
+			[]string{
+				"test.x:1:1: error: Function-like macro 'F' is not supported",
+				"test.x:2:1: error: Macro name missing from #define",
+				"test.x:3:1: error: Macro name missing from #undef",
+				"test.x:4:1: error: Unsupported preprocessor directive '#import'",
+				"test.x:5:1: error: #error Stop",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := new(Config).Process(strings.NewReader(test.src), "test.x")
+		if err == nil {
+			t.Errorf("%s: processed without errors", test.name)
+		} else if err.Error() != strings.Join(test.errs, "\n") {
+			t.Errorf("%s: got errors\n\t%s\nexpected\n\t%s", test.name, strings.Replace(err.Error(), "\n", "\n\t", -1), strings.Join(test.errs, "\n\t"))
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	c := &Config{IncludePath: []string{"testdata/include"}}
+	out, err := c.Process(strings.NewReader("const A = 1;\n#include \"testdata/main.x\"\nconst B = 2;\n"), "test.x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files included using quotes are found relative to the including file
+	// before the include path. Line markers give the position in each file
+	want := `const A = 1;
+# 1 "testdata/main.x"
+# 1 "testdata/inc.h"
+const LOCAL = 1;
+# 2 "testdata/main.x"
+# 1 "testdata/include/inc.h"
+const SYSTEM = 1;
+# 3 "testdata/main.x"
+const MAIN = 1;
+# 3 "test.x"
+const B = 2;
+`
+	if string(out) != want {
+		t.Errorf("Got\n%s\nexpected\n%s", out, want)
+	}
+
+	for src, want := range map[string]string{
+		"#include \"missing.h\"\n":       "test.x:1:1: error: Unable to find 'missing.h' in include path",
+		"#include missing.h\n":           "test.x:1:1: error: #include expects \"FILENAME\" or <FILENAME>",
+		"#include <main.x>\n":            "test.x:1:1: error: Unable to find 'main.x' in include path",
+		"#include \"testdata/self.h\"\n": "testdata/self.h:1:1: error: #include nested too deeply",
+	} {
+		if _, err := c.Process(strings.NewReader(src), "test.x"); err == nil || err.Error() != want {
+			t.Errorf("%q: got error %v, expected %q", src, err, want)
+		}
+	}
+}
@@ -0,0 +1 @@
+const LOCAL = 1;
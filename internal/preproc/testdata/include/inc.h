@@ -0,0 +1 @@
+const SYSTEM = 1;
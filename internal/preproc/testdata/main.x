@@ -0,0 +1,3 @@
+#include "inc.h"
+#include <inc.h>
+const MAIN = 1;
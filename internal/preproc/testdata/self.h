@@ -0,0 +1 @@
+#include "self.h"
@@ -0,0 +1,117 @@
+// Package specfile loads specifications for the commands which use them
+package specfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/scanner"
+
+	"github.com/spf13/pflag"
+	"go.e43.eu/xdr"
+	"go.e43.eu/xdrgen/ast"
+	"go.e43.eu/xdrgen/diag"
+	"go.e43.eu/xdrgen/parser"
+)
+
+// ParserFlags adds the flags which configure the parser to a flag set
+func ParserFlags(fs *pflag.FlagSet, config *parser.Config, defines *[]string) {
+	fs.StringSliceVarP(&config.IncludePath, "include", "I", nil, "Directories to search for imported and included specifications")
+	fs.BoolVar(&config.Preprocess, "preprocess", false, "Run the built-in preprocessor on specifications")
+	fs.StringArrayVarP(defines, "define", "D", nil, "Define a macro, as NAME or NAME=VALUE, for the preprocessor (implies --preprocess)")
+
+	config.Warnings = func(d *diag.Diagnostic) {
+		fmt.Fprintln(os.Stderr, d)
+	}
+}
+
+// SetDefines applies the macros defined using -D to the parser configuration
+func SetDefines(config *parser.Config, defines []string) {
+	if len(defines) == 0 {
+		return
+	}
+
+	config.Preprocess = true
+	config.Defines = make(map[string]string)
+	for _, d := range defines {
+		kv := strings.SplitN(d, "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "1")
+		}
+		config.Defines[kv[0]] = kv[1]
+	}
+}
+
+// Load parses and validates a specification, which may be either source or
+// in the binary format. Errors in the specification are returned as a
+// diag.List
+func Load(config *parser.Config, fname string) (*ast.Specification, error) {
+	inFile, err := os.Open(fname)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening '%s': %w", fname, err)
+	}
+	defer inFile.Close()
+
+	rdr := bufio.NewReader(inFile)
+	peeked, _ := rdr.Peek(8)
+	isBin := false
+	if len(peeked) == 8 {
+		isBin = bytes.Equal(peeked, []byte(ast.XDR_BIN_MAGIC_BYTES))
+	}
+
+	var spec *ast.Specification
+	if !isBin {
+		specx, err := config.ParseSpecification(rdr, fname)
+		if diags, ok := err.(diag.List); ok {
+			// Diagnostics are already annotated with their location
+			return nil, diags
+		} else if err != nil {
+			return nil, fmt.Errorf("Error parsing '%s': %w", fname, err)
+		}
+		spec = specx
+	} else {
+		err := xdr.Read(rdr, &spec)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading '%s': %w", fname, err)
+		}
+	}
+
+	if err := spec.Validate(); err != nil {
+		if verrs, ok := err.(ast.ValidationErrors); ok {
+			return nil, validationDiagnostics(fname, verrs)
+		}
+		return nil, fmt.Errorf("Invalid specification '%s':\n%w", fname, err)
+	}
+
+	return spec, nil
+}
+
+// validationDiagnostics converts validation errors into diagnostics, so that
+// they are printed in the same format as parse errors
+func validationDiagnostics(fname string, verrs ast.ValidationErrors) diag.List {
+	var diags diag.List
+	for _, verr := range verrs {
+		pos := scanner.Position{Filename: fname}
+		if loc := verr.Location; loc != nil {
+			pos.Filename = loc.File
+			pos.Line = int(loc.Line)
+			pos.Column = int(loc.Column)
+		}
+		diags.Add(diag.Errorf(pos, "%s: %s", verr.Definition, verr.Message))
+	}
+	diags.Sort()
+	return diags
+}
+
+// PrintError prints an error, printing each diagnostic of a diag.List on a
+// line of its own
+func PrintError(err error) {
+	if diags, ok := err.(diag.List); ok {
+		diags.Print(os.Stderr)
+	} else {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,527 @@
+package parser
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.e43.eu/xdrgen/ast"
+	"go.e43.eu/xdrgen/internal/lexer"
+)
+
+// The range of integers which may be represented by a constant. Negative
+// constants are limited to the range of a signed hyper
+var (
+	minConstant = new(big.Int).Lsh(big.NewInt(-1), 63)
+	maxConstant = new(big.Int).SetUint64(^uint64(0))
+)
+
+// binaryPrecedence gives the precedence of each binary operator, which is
+// the same as in C
+var binaryPrecedence = map[rune]int{
+	'|':          1,
+	'^':          2,
+	'&':          3,
+	lexer.TokShl: 4,
+	lexer.TokShr: 4,
+	'+':          5,
+	'-':          5,
+	'*':          6,
+	'/':          6,
+	'%':          6,
+}
+
+// operand is a value within a constant expression
+type operand struct {
+	// c is the constant, if the operand is a literal or named constant which
+	// has not been operated on
+	c *ast.Constant
+	// i is the value of integer operands (including enumeration values).
+	// Integers are not limited in size until an operation is complete, so
+	// that overflow can be detected
+	i *big.Int
+}
+
+func constantOperand(c *ast.Constant) *operand {
+	o := &operand{c: c}
+	switch c.Type {
+	case ast.CONST_POS_INT:
+		o.i = new(big.Int).SetUint64(c.VPosInt)
+	case ast.CONST_NEG_INT:
+		o.i = new(big.Int).SetUint64(c.VNegInt)
+		o.i.Neg(o.i)
+	case ast.CONST_ENUM:
+		o.i = big.NewInt(int64(c.VEnum))
+	}
+	return o
+}
+
+// constant returns the constant the operand evaluates to
+func (o *operand) constant() *ast.Constant {
+	switch {
+	case o.c != nil:
+		return o.c
+	case o.i.Sign() < 0:
+		return &ast.Constant{
+			Type:    ast.CONST_NEG_INT,
+			VNegInt: new(big.Int).Neg(o.i).Uint64(),
+		}
+	default:
+		return &ast.Constant{
+			Type:    ast.CONST_POS_INT,
+			VPosInt: o.i.Uint64(),
+		}
+	}
+}
+
+// kind describes the type of an operand in error messages
+func (o *operand) kind() string {
+	if o.i != nil {
+		return "integer"
+	}
+
+	switch o.c.Type {
+	case ast.CONST_BOOL:
+		return "boolean"
+	case ast.CONST_FLOAT:
+		return "floating point"
+	case ast.CONST_STRING:
+		return "string"
+	default:
+		return "void"
+	}
+}
+
+func inRange(i *big.Int) bool {
+	return i.Cmp(minConstant) >= 0 && i.Cmp(maxConstant) <= 0
+}
+
+// expr is a parsed constant expression
+type expr interface {
+	// eval evaluates the expression. If it refers to a constant which is
+	// not defined, or whose value is not yet known, an *unresolvedError is
+	// returned
+	eval(s *ast.Specification) (*operand, error)
+	// refs returns the tokens naming the constants the expression refers to
+	refs() []*lexer.Token
+}
+
+type literalExpr struct {
+	o *operand
+}
+
+type nameExpr struct {
+	name *lexer.Token
+}
+
+type unaryExpr struct {
+	op *lexer.Token
+	x  expr
+}
+
+type binaryExpr struct {
+	op   *lexer.Token
+	x, y expr
+}
+
+// unresolvedError is returned when evaluating an expression which refers to
+// a constant which is not defined, or whose value is not yet known
+type unresolvedError struct {
+	name *lexer.Token
+}
+
+func (err *unresolvedError) Error() string {
+	return "'" + err.name.Value + "': " + ast.ErrDefinitionNotFound.Error()
+}
+
+func (e *literalExpr) eval(s *ast.Specification) (*operand, error) {
+	return e.o, nil
+}
+
+func (e *literalExpr) refs() []*lexer.Token {
+	return nil
+}
+
+func (e *nameExpr) eval(s *ast.Specification) (*operand, error) {
+	d := s.NamedDefinition(e.name.Value)
+	if d == nil || (d.Body.Kind == ast.DEFINITION_KIND_CONSTANT && d.Body.Constant == nil) {
+		return nil, &unresolvedError{e.name}
+	}
+
+	c, err := s.GetConstant(e.name.Value)
+	if err != nil {
+		return nil, e.name.Errorf("'%s': %s", e.name.Value, err)
+	}
+	return constantOperand(c), nil
+}
+
+func (e *nameExpr) refs() []*lexer.Token {
+	return []*lexer.Token{e.name}
+}
+
+func (e *unaryExpr) eval(s *ast.Specification) (*operand, error) {
+	x, err := e.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	return applyUnary(e.op, x)
+}
+
+func (e *unaryExpr) refs() []*lexer.Token {
+	return e.x.refs()
+}
+
+func (e *binaryExpr) eval(s *ast.Specification) (*operand, error) {
+	x, err := e.x.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := e.y.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	return applyBinary(e.op, x, y)
+}
+
+func (e *binaryExpr) refs() []*lexer.Token {
+	return append(e.x.refs(), e.y.refs()...)
+}
+
+// pendingValue is a constant expression which refers to constants whose
+// values were not known when it was parsed
+type pendingValue struct {
+	// name is the constant whose value this is, if any
+	name  string
+	start *lexer.Token
+	x     expr
+	set   func(c *ast.Constant) error
+}
+
+// resolve evaluates the expression, and sets its value. It returns false if
+// the expression refers to constants whose values are still unknown
+func (p *pendingValue) resolve(s *ast.Specification) (bool, error) {
+	o, err := p.x.eval(s)
+	if _, ok := err.(*unresolvedError); ok {
+		return false, nil
+	} else if err != nil {
+		return true, err
+	}
+
+	if err := p.set(o.constant()); err != nil {
+		return true, p.start.Error(err.Error())
+	}
+	return true, nil
+}
+
+// parseValue parses a constant expression, and calls set with its value.
+// If the expression refers to constants which are not yet defined, set is
+// called once they are, after the rest of the file has been parsed. Errors
+// returned by set are reported at the start of the expression.
+//
+// Integer expressions may use the unary operators - + and ~, and the binary
+// operators of C (other than the logical and comparison operators) with
+// the same precedence, and may be parenthesized. Other constants may only
+// be used alone, except that floating point values may be negated
+func parseValue(s *ast.Specification, l *parser, set func(c *ast.Constant) error) error {
+	return parseConstant(s, l, "", set)
+}
+
+// parseConstant is like parseValue, but parses the value of the named
+// constant, so that constants defined in terms of themselves are detected
+func parseConstant(s *ast.Specification, l *parser, name string, set func(c *ast.Constant) error) error {
+	start := l.Peek()
+	x, err := parseExpression(l, 1)
+	if err != nil {
+		return err
+	}
+
+	p := &pendingValue{name: name, start: start, x: x, set: set}
+	if ok, err := p.resolve(s); ok || err != nil {
+		return err
+	}
+
+	l.pending = append(l.pending, p)
+	return nil
+}
+
+// parseNumber parses a constant expression which must evaluate to an
+// unsigned int, and stores its value in dest, as for parseValue
+func parseNumber(s *ast.Specification, l *parser, dest *uint32) error {
+	return parseValue(s, l, func(c *ast.Constant) (err error) {
+		*dest, err = c.AsU32()
+		return err
+	})
+}
+
+// afterResolution calls check once the values of all the constant
+// expressions parsed so far are known. If they already are, check is called
+// immediately and its error returned. Otherwise, it is called once the file
+// has been parsed, and its error reported then
+func (l *parser) afterResolution(check func() error) error {
+	if len(l.pending) == 0 {
+		return check()
+	}
+
+	l.checks = append(l.checks, check)
+	return nil
+}
+
+// resolvePending evaluates the expressions which referred to constants
+// defined after them, once the whole file has been parsed, and then runs
+// the checks which were waiting for their values. Expressions which refer to
+// constants which are never defined, or are defined in terms of themselves,
+// are reported
+func (l *parser) resolvePending(s *ast.Specification) {
+	for progress := true; progress; {
+		progress = false
+
+		var remaining []*pendingValue
+		for _, p := range l.pending {
+			ok, err := p.resolve(s)
+			if err != nil {
+				l.Report(err)
+			}
+
+			if ok {
+				progress = true
+			} else {
+				remaining = append(remaining, p)
+			}
+		}
+		l.pending = remaining
+	}
+
+	if len(l.pending) > 0 {
+		l.reportUnresolved(s)
+		return
+	}
+
+	for _, check := range l.checks {
+		if err := check(); err != nil {
+			l.Report(err)
+		}
+	}
+	l.checks = nil
+}
+
+// reportUnresolved reports why the values of the pending expressions could
+// not be determined
+func (l *parser) reportUnresolved(s *ast.Specification) {
+	byName := make(map[string]*pendingValue)
+	for _, p := range l.pending {
+		if p.name != "" {
+			byName[p.name] = p
+		}
+
+		for _, ref := range p.x.refs() {
+			if s.NamedDefinition(ref.Value) == nil {
+				l.Report(ref.Errorf("'%s': %s", ref.Value, ast.ErrDefinitionNotFound))
+			}
+		}
+	}
+
+	// Constants in a cycle are all pending. Each cycle is found once by a
+	// depth first search of the references between pending constants
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	var (
+		state = make(map[string]int)
+		path  []string
+		visit func(name string)
+	)
+	visit = func(name string) {
+		p := byName[name]
+		switch {
+		case p == nil || state[name] == visited:
+			return
+
+		case state[name] == visiting:
+			for i, n := range path {
+				if n == name {
+					cycle := append(path[i:len(path):len(path)], name)
+					l.Report(byName[name].start.Errorf("Constant '%s' is defined in terms of itself (%s)",
+						name, strings.Join(cycle, " -> ")))
+				}
+			}
+			return
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, ref := range p.x.refs() {
+			visit(ref.Value)
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+	}
+
+	for _, p := range l.pending {
+		visit(p.name)
+	}
+	l.pending = nil
+}
+
+// parseExpression parses an expression made up of binary operators with at
+// least the given precedence
+func parseExpression(l *parser, minPrecedence int) (expr, error) {
+	lhs, err := parseUnary(l)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := l.Peek()
+		prec, ok := binaryPrecedence[op.ID]
+		if !ok || prec < minPrecedence {
+			return lhs, nil
+		}
+		l.Next()
+
+		rhs, err := parseExpression(l, prec+1)
+		if err != nil {
+			return nil, err
+		}
+		lhs = &binaryExpr{op: op, x: lhs, y: rhs}
+	}
+}
+
+func parseUnary(l *parser) (expr, error) {
+	t := l.Next()
+	switch t.ID {
+	case '-', '+', '~':
+		x, err := parseUnary(l)
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: t, x: x}, nil
+
+	case '(':
+		x, err := parseExpression(l, 1)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := l.Expect("constant expression", ')'); err != nil {
+			return nil, err
+		}
+		return x, nil
+
+	case lexer.TokIdent:
+		return &nameExpr{name: t}, nil
+
+	case lexer.TokIntConst:
+		i, ok := new(big.Int).SetString(t.Value, 0)
+		if !ok {
+			return nil, t.Errorf("Invalid integer constant %s", t.Value)
+		} else if !inRange(i) {
+			return nil, t.Errorf("Integer constant %s is out of range", t.Value)
+		}
+		return &literalExpr{&operand{i: i}}, nil
+
+	case lexer.TokFloatConst:
+		f, err := strconv.ParseFloat(t.Value, 64)
+		if err != nil {
+			return nil, t.Error(err.Error())
+		}
+
+		return &literalExpr{&operand{c: &ast.Constant{
+			Type:   ast.CONST_FLOAT,
+			VFloat: f,
+		}}}, nil
+
+	case lexer.TokStringConst:
+		str, err := strconv.Unquote(t.Value)
+		if err != nil {
+			return nil, t.Error(err.Error())
+		}
+		return &literalExpr{&operand{c: &ast.Constant{
+			Type:    ast.CONST_STRING,
+			VString: str,
+		}}}, nil
+
+	default:
+		return nil, t.Unexpected("constant")
+	}
+}
+
+func applyUnary(op *lexer.Token, o *operand) (*operand, error) {
+	if o.i == nil {
+		if op.ID == '-' && o.c.Type == ast.CONST_FLOAT {
+			return &operand{c: &ast.Constant{
+				Type:   ast.CONST_FLOAT,
+				VFloat: -o.c.VFloat,
+			}}, nil
+		}
+		return nil, op.Errorf("Operator '%s' can't be applied to a %s constant", op.Value, o.kind())
+	}
+
+	r := new(big.Int)
+	switch op.ID {
+	case '-':
+		r.Neg(o.i)
+	case '+':
+		r.Set(o.i)
+	case '~':
+		r.Not(o.i)
+	}
+
+	if !inRange(r) {
+		return nil, op.Errorf("Constant expression overflows: %s%s is out of range", op.Value, o.i)
+	}
+	return &operand{i: r}, nil
+}
+
+func applyBinary(op *lexer.Token, lhs, rhs *operand) (*operand, error) {
+	for _, o := range []*operand{lhs, rhs} {
+		if o.i == nil {
+			return nil, op.Errorf("Operator '%s' can't be applied to a %s constant", op.Value, o.kind())
+		}
+	}
+
+	x, y := lhs.i, rhs.i
+	r := new(big.Int)
+	switch op.ID {
+	case '|':
+		r.Or(x, y)
+	case '^':
+		r.Xor(x, y)
+	case '&':
+		r.And(x, y)
+	case '+':
+		r.Add(x, y)
+	case '-':
+		r.Sub(x, y)
+	case '*':
+		r.Mul(x, y)
+
+	case '/', '%':
+		if y.Sign() == 0 {
+			return nil, op.Error("Division by zero in constant expression")
+		}
+
+		// Division truncates towards zero, as in C
+		if op.ID == '/' {
+			r.Quo(x, y)
+		} else {
+			r.Rem(x, y)
+		}
+
+	case lexer.TokShl, lexer.TokShr:
+		if y.Sign() < 0 || y.Cmp(big.NewInt(64)) >= 0 {
+			return nil, op.Errorf("Shift count %s is out of range", y)
+		}
+
+		if op.ID == lexer.TokShl {
+			r.Lsh(x, uint(y.Uint64()))
+		} else {
+			r.Rsh(x, uint(y.Uint64()))
+		}
+	}
+
+	if !inRange(r) {
+		return nil, op.Errorf("Constant expression overflows: %s %s %s is out of range", x, op.Value, y)
+	}
+	return &operand{i: r}, nil
+}
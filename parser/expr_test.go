@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.e43.eu/xdrgen/ast"
+)
+
+func TestExpressions(t *testing.T) {
+	pos := func(v uint64) *ast.Constant { return &ast.Constant{Type: ast.CONST_POS_INT, VPosInt: v} }
+	neg := func(v uint64) *ast.Constant { return &ast.Constant{Type: ast.CONST_NEG_INT, VNegInt: v} }
+
+	tests := []struct {
+		expr string
+		want *ast.Constant
+	}{
+		{"2 * 64", pos(128)},
+		{"-(3 + 4) * 2", neg(14)},
+		{"~0", neg(1)},
+		{"1 << 4 >> 1", pos(8)},
+		{"1 + 2 << 3", pos(24)},
+		{"7 % 4 | 8 & 12 ^ 1", pos(11)},
+		{"-0x8000000000000000", neg(1 << 63)},
+		{"0xFFFFFFFFFFFFFFFE + 1", pos(^uint64(0))},
+		{"\"s\"", &ast.Constant{Type: ast.CONST_STRING, VString: "s"}},
+	}
+
+	for _, test := range tests {
+		s := parse(t, "const X = "+test.expr+";")
+		c, err := s.GetConstant("X")
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+		} else if !reflect.DeepEqual(c, test.want) {
+			t.Errorf("%s = %+v, expected %+v", test.expr, c, test.want)
+		}
+	}
+
+	s := parse(t, "const MAX = 4; typedef opaque d<MAX + 4>;")
+	typ, err := s.GetType("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := typ.TypeDef.Modifier.Size; size != 8 {
+		t.Errorf("opaque d<MAX + 4> has size %d, expected 8", size)
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		// err is the expected error, which is reported at the operator
+		err string
+	}{
+		{"0xFFFFFFFFFFFFFFFF + 1", "test.x:1:30: error: Constant expression overflows: 18446744073709551615 + 1 is out of range"},
+		{"-0x8000000000000001", "test.x:1:11: error: Constant expression overflows: -9223372036854775809 is out of range"},
+		{"1 << 64", "test.x:1:13: error: Shift count 64 is out of range"},
+		{"\"s\" + 1", "test.x:1:15: error: Operator '+' can't be applied to a string constant"},
+		{"~\"s\"", "test.x:1:11: error: Operator '~' can't be applied to a string constant"},
+		{"1 / 0", "test.x:1:13: error: Division by zero in constant expression"},
+		{"1 % (2 - 2)", "test.x:1:13: error: Division by zero in constant expression"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseSpecification(strings.NewReader("const X = "+test.expr+";"), "test.x")
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: got error %v, expected %q", test.expr, err, test.err)
+		}
+	}
+}
+
+func TestForwardReferences(t *testing.T) {
+	s := parse(t, "typedef int a[N];\ntypedef opaque b<N * 2>;\nunion u switch (int d) { case A: int x; case B: void; };\nconst N = M + 1;\nconst M = 3;\nconst A = 1;\nconst B = 2;\n")
+
+	for name, want := range map[string]uint32{"a": 4, "b": 8} {
+		typ, err := s.GetType(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := typ.TypeDef.Modifier.Size; size != want {
+			t.Errorf("%s has size %d, expected %d", name, size, want)
+		}
+	}
+
+	typ, err := s.GetType("u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int32]uint32{1: 0, 2: 1}; !reflect.DeepEqual(typ.UnionSpec.Options, want) {
+		t.Errorf("u has options %v, expected %v", typ.UnionSpec.Options, want)
+	}
+}
+
+func TestUnresolvedErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		err  string
+	}{
+		{
+			// Duplicate case labels are only detected once the values of
+			// the constants are known
+			"Duplicate forward case labels",
+			"union u switch (int d) { case A: int x; case B: void; }; const A = 1; const B = 1;",
+			"test.x:1:41: error: Value conflicts with existing alternative",
+		},
+		{
+			"Forward case label duplicating a literal",
+			"union u switch (int d) { case 1: int x; case A: void; }; const A = 1;",
+			"test.x:1:41: error: Value conflicts with existing alternative",
+		},
+		{
+			"Forward constant out of range",
+			"typedef int a[N]; const N = -1;",
+			"test.x:1:15: error: Constant -1 out of range for unsigned int",
+		},
+		{
+			"Cycle",
+			"const A = C + 1;\nconst C = D;\nconst D = C * 2;\n",
+			"test.x:2:11: error: Constant 'C' is defined in terms of itself (C -> D -> C)",
+		},
+		{
+			"Constant defined as itself",
+			"const S = S;",
+			"test.x:1:11: error: Constant 'S' is defined in terms of itself (S -> S)",
+		},
+		{
+			"Undefined name",
+			"typedef int a[UNDEFINED];",
+			"test.x:1:15: error: 'UNDEFINED': Definition not found",
+		},
+		{
+			"Undefined name in a constant",
+			"const A = B + 1; typedef int a[A];",
+			"test.x:1:11: error: 'B': Definition not found",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := ParseSpecification(strings.NewReader(test.spec), "test.x")
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: got error %v, expected %q", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.e43.eu/xdrgen/ast"
+	"go.e43.eu/xdrgen/internal/lexer"
+	"go.e43.eu/xdrgen/internal/preproc"
+)
+
+// importer tracks the state of an import operation, so that we can locate
+// imported files and detect import cycles
+type importer struct {
+	config *Config
+	stack  []string
+}
+
+// absPath returns the absolute name of a file, by which imports are
+// identified
+func absPath(fname string) string {
+	abs, err := filepath.Abs(fname)
+	if err != nil {
+		return fname
+	}
+	return abs
+}
+
+func (imp *importer) parse(rdr io.Reader, filename string) (*ast.Specification, error) {
+	imp.stack = append(imp.stack, absPath(filename))
+	defer func() { imp.stack = imp.stack[:len(imp.stack)-1] }()
+
+	if imp.config.Preprocess {
+		pp := &preproc.Config{
+			IncludePath: imp.config.IncludePath,
+			Defines:     imp.config.Defines,
+		}
+		buf, err := pp.Process(rdr, filename)
+		if err != nil {
+			return nil, err
+		}
+		rdr = bytes.NewReader(buf)
+	}
+
+	l := &parser{Lexer: lexer.NewLexer(rdr, filename)}
+	return parseSpecification(l, imp)
+}
+
+// resolve locates the file referred to by path, when imported from the
+// file named from
+func (imp *importer) resolve(path, from string) (string, error) {
+	if filepath.IsAbs(path) {
+		if _, err := os.Stat(path); err != nil {
+			return "", err
+		}
+		return filepath.Clean(path), nil
+	}
+
+	dirs := append([]string{filepath.Dir(from)}, imp.config.IncludePath...)
+	for _, dir := range dirs {
+		fname := filepath.Join(dir, path)
+		if _, err := os.Stat(fname); err == nil {
+			return fname, nil
+		}
+	}
+	return "", fmt.Errorf("Unable to find '%s' in include path", path)
+}
+
+func (imp *importer) checkCycle(fname string) error {
+	abs := absPath(fname)
+	for i, f := range imp.stack {
+		if f == abs {
+			cycle := append(append([]string{}, imp.stack[i:]...), abs)
+			return fmt.Errorf("Import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	return nil
+}
+
+func parseImport(s *ast.Specification, l *parser, imp *importer) error {
+	if _, err := l.Expect("import", lexer.TokImport); err != nil {
+		return err
+	}
+
+	pathTok, err := l.Expect("import", lexer.TokStringConst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.Expect("import", ';'); err != nil {
+		return err
+	}
+
+	path, err := strconv.Unquote(pathTok.Value)
+	if err != nil {
+		return pathTok.Error(err.Error())
+	}
+
+	fname, err := imp.resolve(path, pathTok.Position.Filename)
+	if err != nil {
+		return pathTok.Error(err.Error())
+	}
+
+	if err := imp.checkCycle(fname); err != nil {
+		return pathTok.Error(err.Error())
+	}
+
+	f, err := os.Open(fname)
+	if err != nil {
+		return pathTok.Error(err.Error())
+	}
+	defer f.Close()
+
+	is, err := imp.parse(f, fname)
+	if err != nil {
+		return err
+	}
+
+	// The same file may be found by different names, so imports are
+	// identified by its absolute name
+	if err := mergeImport(s, is, path, absPath(fname)); err != nil {
+		return pathTok.Errorf("Importing '%s': %s", path, err)
+	}
+	return nil
+}
+
+// putImport returns the index of the import record for the specified file,
+// creating it if it does not already exist. fname is the absolute name of
+// the file
+func putImport(s *ast.Specification, path, fname string, a ast.Attributes) uint32 {
+	if idx, ok := s.GetImport(fname); ok {
+		return idx
+	}
+
+	s.Imports = append(s.Imports, &ast.ImportSpec{
+		Path:       path,
+		File:       fname,
+		Attributes: a,
+	})
+	return uint32(len(s.Imports) - 1)
+}
+
+// mergeImport merges the definitions of the imported specification is
+// into s, marking each with the import it originated from. Definitions
+// which were already imported from the same file (for example, because
+// two imported specifications import a common third) are shared
+func mergeImport(s, is *ast.Specification, path, fname string) error {
+	origin := putImport(s, path, fname, is.Attributes)
+
+	importMap := make([]uint32, len(is.Imports))
+	for i, ii := range is.Imports {
+		importMap[i] = putImport(s, ii.Path, ii.File, ii.Attributes)
+	}
+
+	defMap := make([]uint32, len(is.Definitions))
+	added := make([]bool, len(is.Definitions))
+	for i, d := range is.Definitions {
+		defOrigin := origin
+		if d.ImportedFrom != nil {
+			defOrigin = importMap[*d.ImportedFrom]
+		}
+		d.ImportedFrom = &defOrigin
+
+		xdIdx, xd := -1, (*ast.Definition)(nil)
+		for j, x := range s.Definitions {
+			if x.Name == d.Name {
+				xdIdx, xd = j, x
+				break
+			}
+		}
+
+		switch {
+		case xd == nil:
+			s.Definitions = append(s.Definitions, d)
+			defMap[i] = uint32(len(s.Definitions) - 1)
+			added[i] = true
+
+		case xd.ImportedFrom != nil && *xd.ImportedFrom == defOrigin:
+			defMap[i] = uint32(xdIdx)
+
+		case xd.ImportedFrom == nil &&
+			xd.Body.Kind == ast.DEFINITION_KIND_TYPE &&
+			xd.Body.Type == nil &&
+			d.Body.Kind == ast.DEFINITION_KIND_TYPE:
+			// A placeholder created by a reference which preceded the import
+			s.Definitions[xdIdx] = d
+			defMap[i] = uint32(xdIdx)
+			added[i] = true
+
+		default:
+			return fmt.Errorf("'%s' from '%s' conflicts with an existing definition",
+				d.Name, s.Imports[defOrigin].File)
+		}
+	}
+
+	for i, d := range is.Definitions {
+		if !added[i] {
+			// Already merged by a previous import
+			continue
+		}
+
+		var err error
+		d.VisitTypes(func(t *ast.Type) {
+			switch t.Kind {
+			case ast.TYPE_REF:
+				t.Ref = defMap[t.Ref]
+			case ast.TYPE_ENUM:
+				es := t.EnumSpec
+				if es.Count == 0 {
+					return
+				}
+
+				base := defMap[es.Base]
+				for j := uint32(0); j < es.Count; j++ {
+					if defMap[es.Base+j] != base+j && err == nil {
+						err = fmt.Errorf("Values of enum '%s' conflict with existing definitions", d.Name)
+					}
+				}
+				es.Base = base
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
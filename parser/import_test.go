@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestImportNames checks that a file imported by different names, relative
+// to the importing file and through the include path, is imported once
+func TestImportNames(t *testing.T) {
+	dir, err := filepath.Abs("testdata/import")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		include string
+		file    string
+	}{
+		{"Absolute include path", dir, "testdata/import/a.x"},
+		{"Relative include path", "testdata/import", filepath.Join(dir, "a.x")},
+		{"Absolute names", dir, filepath.Join(dir, "a.x")},
+	}
+
+	for _, test := range tests {
+		f, err := os.Open(test.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := &Config{IncludePath: []string{test.include}}
+		s, err := config.ParseSpecification(f, test.file)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		var files []string
+		for _, imp := range s.Imports {
+			files = append(files, imp.File)
+		}
+		want := []string{filepath.Join(dir, "common.x"), filepath.Join(dir, "sub", "b.x")}
+		if len(files) != len(want) || files[0] != want[0] || files[1] != want[1] {
+			t.Errorf("%s: imported %q, expected %q", test.name, files, want)
+		}
+
+		n := 0
+		for _, d := range s.Definitions {
+			if d.Name == "common" {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("%s: 'common' is defined %d times", test.name, n)
+		}
+	}
+}
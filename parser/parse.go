@@ -2,18 +2,63 @@ package parser
 
 import (
 	"io"
-	"strconv"
 
 	"go.e43.eu/xdrgen/ast"
+	"go.e43.eu/xdrgen/diag"
 	"go.e43.eu/xdrgen/internal/lexer"
 )
 
+// Config controls how specifications are parsed
+type Config struct {
+	// IncludePath lists the directories which are searched for imported
+	// specifications which cannot be found relative to the importing file.
+	// It is also searched for files included by the preprocessor
+	IncludePath []string
+
+	// Preprocess enables the built-in preprocessor, which supports object-like
+	// macros, conditionals and #include (see package internal/preproc).
+	// Imported specifications are preprocessed separately, starting with
+	// only the macros in Defines
+	Preprocess bool
+
+	// Defines holds the macros defined before preprocessing, by name
+	Defines map[string]string
+
+	// Warnings, if set, is called with each warning reported while parsing
+	Warnings func(d *diag.Diagnostic)
+}
+
+// ParseSpecification parses a specification using the default configuration
 func ParseSpecification(rdr io.Reader, filename string) (*ast.Specification, error) {
-	l := lexer.NewLexer(rdr, filename)
-	return parseSpecification(l)
+	return new(Config).ParseSpecification(rdr, filename)
+}
+
+// ParseSpecification parses the specification read from rdr. filename is used
+// in diagnostics and as the base for resolving relative imports.
+//
+// The parser attempts to recover from errors at definition boundaries, so
+// that as many problems as possible are reported. If any errors are found,
+// they are returned as a diag.List
+func (c *Config) ParseSpecification(rdr io.Reader, filename string) (*ast.Specification, error) {
+	imp := &importer{config: c}
+	return imp.parse(rdr, filename)
+}
+
+// parser holds the state of the parse of a file. It embeds the lexer, which
+// is used directly by most of the parse functions
+type parser struct {
+	*lexer.Lexer
+
+	// pending holds the constant expressions which refer to constants whose
+	// values are not yet known
+	pending []*pendingValue
+	// checks holds the checks waiting for pending values to be resolved
+	checks []func() error
+	// atEnd holds the checks waiting for the whole file to be parsed
+	atEnd []func() error
 }
 
-func parseSpecification(l *lexer.Lexer) (*ast.Specification, error) {
+func parseSpecification(l *parser, imp *importer) (*ast.Specification, error) {
 	s := new(ast.Specification)
 	s.Magic = ast.XDR_BIN_MAGIC
 
@@ -21,25 +66,125 @@ func parseSpecification(l *lexer.Lexer) (*ast.Specification, error) {
 		l.Next()
 		a, err := parseAttributes(s, l)
 		if err != nil {
-			return nil, err
+			l.Report(err)
+			synchronize(l, false)
 		}
 		s.Attributes = a
 	}
 
 	for t := l.Peek(); t.ID != lexer.TokEOF; t = l.Peek() {
-		d, err := parseDefinition(s, l)
-		if err != nil {
-			return nil, err
+		addPassthroughs(s, l)
+		if err := parseTopLevel(s, l, imp); err != nil {
+			l.Report(err)
+			synchronize(l, l.Peek() == t)
 		}
+	}
+	addPassthroughs(s, l)
+	l.resolvePending(s)
+	for _, check := range l.atEnd {
+		if err := check(); err != nil {
+			l.Report(err)
+		}
+	}
 
-		if _, err := s.PutDefinition(d); err != nil {
-			return nil, err
+	diags := l.Diagnostics()
+	diags.Sort()
+	if imp.config.Warnings != nil {
+		for _, d := range diags {
+			if d.Severity == diag.Warning {
+				imp.config.Warnings(d)
+			}
 		}
 	}
+
+	var errs diag.List
+	for _, d := range diags {
+		if d.Severity == diag.Error {
+			errs.Add(d)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
 	return s, nil
 }
 
-func parseAttributes(s *ast.Specification, l *lexer.Lexer) (ast.Attributes, error) {
+func parseTopLevel(s *ast.Specification, l *parser, imp *importer) error {
+	t := l.Peek()
+	if t.Is(lexer.TokImport) {
+		return parseImport(s, l, imp)
+	}
+
+	d, err := parseDefinition(s, l)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.PutDefinition(d); err != nil {
+		return t.Errorf("'%s': %s", d.Name, err)
+	}
+	return nil
+}
+
+// addPassthroughs records the passthrough lines scanned so far. Lines are
+// placed after the definitions parsed so far, so any which appear within a
+// definition are moved to follow it
+func addPassthroughs(s *ast.Specification, l *parser) {
+	for _, p := range l.Passthroughs() {
+		s.Passthroughs = append(s.Passthroughs, &ast.Passthrough{
+			Text:     p.Text,
+			Position: uint32(len(s.Definitions)),
+			Location: &ast.Location{
+				File:      p.Position.Filename,
+				Line:      uint32(p.Position.Line),
+				Column:    uint32(p.Position.Column),
+				EndLine:   uint32(p.End.Line),
+				EndColumn: uint32(p.End.Column),
+			},
+		})
+	}
+}
+
+// synchronize skips tokens until the end of the current definition, so
+// that parsing may resume after an error. If no tokens have been consumed
+// since the definition started, at least one token is skipped so that we
+// are guaranteed to make progress
+func synchronize(l *parser, mustAdvance bool) {
+	if mustAdvance {
+		if t := l.Next(); t.ID == ';' && l.Depth() <= 0 {
+			return
+		}
+	}
+
+	for {
+		t := l.Peek()
+		switch {
+		case t.ID == lexer.TokEOF:
+			return
+		case l.Depth() <= 0 && startsDefinition(t):
+			return
+		}
+
+		l.Next()
+		if t.ID == ';' && l.Depth() <= 0 {
+			return
+		}
+	}
+}
+
+// startsDefinition returns if t may be the first token of a definition
+func startsDefinition(t *lexer.Token) bool {
+	switch t.ID {
+	case lexer.TokTypedef, lexer.TokEnum, lexer.TokStruct, lexer.TokUnion,
+		lexer.TokConst, '[':
+		return true
+	default:
+		return t.Is(lexer.TokProgram) || t.Is(lexer.TokImport)
+	}
+}
+
+func parseAttributes(s *ast.Specification, l *parser) (ast.Attributes, error) {
 	if l.NextOneOf('[') == nil {
 		return nil, nil
 	}
@@ -59,24 +204,31 @@ func parseAttributes(s *ast.Specification, l *lexer.Lexer) (ast.Attributes, erro
 			return nil, err
 		}
 
+		if _, exists := a[ident.Value]; exists {
+			l.Report(ident.Warnf("Attribute '%s' specified more than once; the last value is used", ident.Value))
+		}
+
 		t := l.Next()
 		switch t.ID {
-		case ']':
-			return a, nil
-		case ',':
+		case ']', ',':
 			a[ident.Value] = &ast.Constant{
 				Type:  ast.CONST_BOOL,
 				VBool: true,
 			}
+			if t.ID == ']' {
+				return a, nil
+			}
 			continue
 		case '(':
-			val, err := parseValue(s, l)
+			name := ident.Value
+			err := parseValue(s, l, func(c *ast.Constant) error {
+				a[name] = c
+				return nil
+			})
 			if err != nil {
 				return nil, err
 			}
 
-			a[ident.Value] = val
-
 			if _, err := l.Expect("attribute", ')'); err != nil {
 				return nil, err
 			}
@@ -96,24 +248,27 @@ func parseAttributes(s *ast.Specification, l *lexer.Lexer) (ast.Attributes, erro
 	}
 }
 
-func parseDefinition(s *ast.Specification, l *lexer.Lexer) (d *ast.Definition, err error) {
+func parseDefinition(s *ast.Specification, l *parser) (d *ast.Definition, err error) {
+	start := l.Peek()
 	a, err := parseAttributes(s, l)
 	if err != nil {
 		return nil, err
 	}
 
 	t := l.Peek()
-	switch t.ID {
-	case lexer.TokTypedef:
+	switch {
+	case t.ID == lexer.TokTypedef:
 		d, err = parseTypedef(s, l)
-	case lexer.TokEnum:
+	case t.ID == lexer.TokEnum:
 		d, err = parseEnum(s, l)
-	case lexer.TokStruct:
+	case t.ID == lexer.TokStruct:
 		d, err = parseStruct(s, l)
-	case lexer.TokUnion:
+	case t.ID == lexer.TokUnion:
 		d, err = ParseUnion(s, l)
-	case lexer.TokConst:
+	case t.ID == lexer.TokConst:
 		d, err = parseConst(s, l)
+	case t.Is(lexer.TokProgram):
+		d, err = parseProgram(s, l)
 	default:
 		err = t.Unexpected("definition")
 	}
@@ -121,68 +276,44 @@ func parseDefinition(s *ast.Specification, l *lexer.Lexer) (d *ast.Definition, e
 	if err != nil {
 		return nil, err
 	}
-	d.Attributes = a
+	d.Attributes = docAttribute(a, start)
+	d.Location = location(start, l)
 	return d, nil
 }
 
-func parseValue(s *ast.Specification, l *lexer.Lexer) (*ast.Constant, error) {
-	t := l.Next()
-	switch t.ID {
-	case lexer.TokIdent:
-		return s.GetConstant(t.Value)
-
-	case lexer.TokIntConst:
-		istr := t.Value
-		negative := false
-		if istr[0] == '-' {
-			negative = true
-			istr = istr[1:]
-		}
-
-		ui, err := strconv.ParseUint(istr, 0, 64)
-		if err != nil {
-			return nil, t.Error(err.Error())
-		}
-
-		if negative {
-			return &ast.Constant{
-				Type:    ast.CONST_NEG_INT,
-				VPosInt: ui,
-			}, nil
-		} else {
-			return &ast.Constant{
-				Type:    ast.CONST_POS_INT,
-				VPosInt: ui,
-			}, nil
-		}
-
-	case lexer.TokFloatConst:
-		f, err := strconv.ParseFloat(t.Value, 64)
-		if err != nil {
-			return nil, t.Error(err.Error())
-		}
-
-		return &ast.Constant{
-			Type:   ast.CONST_FLOAT,
-			VFloat: f,
-		}, nil
+// docAttribute sets the doc attribute to the comment preceding the token t,
+// unless it has been specified explicitly
+func docAttribute(a ast.Attributes, t *lexer.Token) ast.Attributes {
+	if t.Doc == "" {
+		return a
+	} else if _, exists := a["doc"]; exists {
+		return a
+	}
 
-	case lexer.TokStringConst:
-		str, err := strconv.Unquote(t.Value)
-		if err != nil {
-			return nil, t.Error(err.Error())
-		}
-		return &ast.Constant{
-			Type:    ast.CONST_STRING,
-			VString: str,
-		}, nil
+	if a == nil {
+		a = make(ast.Attributes)
+	}
+	a["doc"] = &ast.Constant{
+		Type:    ast.CONST_STRING,
+		VString: t.Doc,
+	}
+	return a
+}
 
-	default:
-		return nil, t.Unexpected("constant")
+// location returns the location of the source text from the start token
+// up to the last token consumed
+func location(start *lexer.Token, l *parser) *ast.Location {
+	end := l.LastEnd()
+	return &ast.Location{
+		File:      start.Position.Filename,
+		Line:      uint32(start.Position.Line),
+		Column:    uint32(start.Position.Column),
+		EndLine:   uint32(end.Line),
+		EndColumn: uint32(end.Column),
 	}
 }
 
-func parseConst(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error) {
+func parseConst(s *ast.Specification, l *parser) (*ast.Definition, error) {
 	if _, err := l.Expect("const", lexer.TokConst); err != nil {
 		return nil, err
 	}
@@ -196,7 +327,14 @@ func parseConst(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error) {
 		return nil, err
 	}
 
-	val, err := parseValue(s, l)
+	d := &ast.Definition{
+		Name: ident.Value,
+		Body: &ast.Definition_Body{Kind: ast.DEFINITION_KIND_CONSTANT},
+	}
+	err = parseConstant(s, l, d.Name, func(c *ast.Constant) error {
+		d.Body.Constant = c
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -204,17 +342,10 @@ func parseConst(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error) {
 	if _, err := l.Expect("const", ';'); err != nil {
 		return nil, err
 	}
-
-	return &ast.Definition{
-		Name: ident.Value,
-		Body: &ast.Definition_Body{
-			Kind:     ast.DEFINITION_KIND_CONSTANT,
-			Constant: val,
-		},
-	}, nil
+	return d, nil
 }
 
-func parseTypedef(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error) {
+func parseTypedef(s *ast.Specification, l *parser) (*ast.Definition, error) {
 	if _, err := l.Expect("typedef", lexer.TokTypedef); err != nil {
 		return nil, err
 	}
@@ -240,80 +371,34 @@ func parseTypedef(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error)
 	}, nil
 }
 
-func parseDeclaration(s *ast.Specification, l *lexer.Lexer) (*ast.Declaration, error) {
+func parseDeclaration(s *ast.Specification, l *parser) (*ast.Declaration, error) {
 	var err error
 	d := &ast.Declaration{
 		Modifier: new(ast.Declaration_Modifier),
 	}
 
+	start := l.Peek()
 	d.Attributes, err = parseAttributes(s, l)
 	if err != nil {
 		return nil, err
 	}
+	d.Attributes = docAttribute(d.Attributes, start)
 
-	t := l.Next()
-	switch t.ID {
-	case lexer.TokUnsigned:
-		t, err := l.Expect("declaration", lexer.TokInt, lexer.TokHyper)
-		if err != nil {
-			return nil, err
-		}
+	d.Type, err = parseTypeSpecifier(s, l, "declaration")
+	if err != nil {
+		return nil, err
+	}
 
-		switch t.ID {
-		case lexer.TokInt:
-			d.Type = ast.UnsignedInt()
-		case lexer.TokHyper:
-			d.Type = ast.UnsignedHyper()
-		}
-	case lexer.TokInt:
-		d.Type = ast.Int()
-	case lexer.TokHyper:
-		d.Type = ast.Hyper()
-	case lexer.TokFloat:
-		d.Type = ast.Float()
-	case lexer.TokDouble:
-		d.Type = ast.Double()
-	case lexer.TokBool:
-		d.Type = ast.Bool()
-	case lexer.TokString:
-		d.Type = ast.String()
-	case lexer.TokOpaque:
-		d.Type = ast.Opaque()
-	case lexer.TokEnum:
-		l.Unget(t)
-		d.Type, err = parseEnumTypeSpec(s, l)
-		if err != nil {
-			return nil, err
-		}
-	case lexer.TokStruct:
-		l.Unget(t)
-		d.Type, err = parseStructTypeSpec(s, l)
-		if err != nil {
-			return nil, err
-		}
-	case lexer.TokUnion:
-		l.Unget(t)
-		d.Type, err = ParseUnionTypeSpec(s, l)
-		if err != nil {
-			return nil, err
-		}
-	case lexer.TokIdent:
-		d.Type, err = s.TypeRef(t.Value)
-		if err != nil {
-			return nil, err
-		}
-	case lexer.TokVoid:
-		d.Type = ast.Void()
+	if d.Type.Kind == ast.TYPE_VOID {
+		d.Location = location(start, l)
 		return d, nil
-	default:
-		return nil, t.Unexpected("declaration")
 	}
 
 	if l.NextOneOf('*') != nil {
 		d.Modifier.Kind = ast.DECLARATION_MODIFIER_OPTIONAL
 	}
 
-	t, err = l.Expect("declaration", lexer.TokIdent)
+	t, err := l.Expect("declaration", lexer.TokIdent)
 	if err != nil {
 		return nil, err
 	}
@@ -329,35 +414,19 @@ func parseDeclaration(s *ast.Specification, l *lexer.Lexer) (*ast.Declaration, e
 		if l.Peek().ID == '>' {
 			d.Modifier.Kind = ast.DECLARATION_MODIFIER_UNBOUNDED
 		} else {
-			val, err := parseValue(s, l)
-			if err != nil {
-				return nil, err
-			}
-
-			vu32, err := val.AsU32()
-			if err != nil {
+			d.Modifier.Kind = ast.DECLARATION_MODIFIER_FLEXIBLE
+			if err := parseNumber(s, l, &d.Modifier.Size); err != nil {
 				return nil, err
 			}
-
-			d.Modifier.Kind = ast.DECLARATION_MODIFIER_FLEXIBLE
-			d.Modifier.Size = vu32
 		}
 		if _, err := l.Expect("declaration", '>'); err != nil {
 			return nil, err
 		}
 	case t2 != nil && t2.ID == '[' && d.Type.Kind != ast.TYPE_STRING:
-		val, err := parseValue(s, l)
-		if err != nil {
-			return nil, err
-		}
-
-		vu32, err := val.AsU32()
-		if err != nil {
+		d.Modifier.Kind = ast.DECLARATION_MODIFIER_FIXED
+		if err := parseNumber(s, l, &d.Modifier.Size); err != nil {
 			return nil, err
 		}
-
-		d.Modifier.Kind = ast.DECLARATION_MODIFIER_FIXED
-		d.Modifier.Size = vu32
 		if _, err := l.Expect("declaration", ']'); err != nil {
 			return nil, err
 		}
@@ -365,15 +434,99 @@ func parseDeclaration(s *ast.Specification, l *lexer.Lexer) (*ast.Declaration, e
 		return nil, t.Errorf("string or opaque must have size specifier")
 	}
 
+	d.Location = location(start, l)
 	return d, nil
 }
 
-func parseEnumTypeSpec(s *ast.Specification, l *lexer.Lexer) (*ast.Type, error) {
-	l.Expect("enum", lexer.TokEnum)
+// parseTypeSpecifier parses a type specifier (the type portion of a
+// declaration, or a procedure argument or result)
+func parseTypeSpecifier(s *ast.Specification, l *parser, ctx string) (*ast.Type, error) {
+	t := l.Next()
+	switch t.ID {
+	case lexer.TokUnsigned:
+		t, err := l.Expect(ctx, lexer.TokInt, lexer.TokHyper)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.ID == lexer.TokHyper {
+			return ast.UnsignedHyper(), nil
+		}
+		return ast.UnsignedInt(), nil
+	case lexer.TokInt:
+		return ast.Int(), nil
+	case lexer.TokHyper:
+		return ast.Hyper(), nil
+	case lexer.TokFloat:
+		return ast.Float(), nil
+	case lexer.TokDouble:
+		return ast.Double(), nil
+	case lexer.TokBool:
+		return ast.Bool(), nil
+	case lexer.TokString:
+		return ast.String(), nil
+	case lexer.TokOpaque:
+		return ast.Opaque(), nil
+	case lexer.TokEnum:
+		l.Unget(t)
+		return parseEnumTypeSpec(s, l)
+	case lexer.TokStruct:
+		l.Unget(t)
+		return parseStructTypeSpec(s, l)
+	case lexer.TokUnion:
+		l.Unget(t)
+		return ParseUnionTypeSpec(s, l)
+	case lexer.TokIdent:
+		typ, err := s.TypeRef(t.Value)
+		if err != nil {
+			return nil, t.Errorf("'%s': %s", t.Value, err)
+		}
+		return typ, nil
+	case lexer.TokVoid:
+		return ast.Void(), nil
+	default:
+		return nil, t.Unexpected(ctx)
+	}
+}
+
+func parseEnumTypeSpec(s *ast.Specification, l *parser) (*ast.Type, error) {
+	kw, _ := l.Expect("enum", lexer.TokEnum)
+	if name := l.NextOneOf(lexer.TokIdent); name != nil {
+		return parseQualifiedTypeRef(s, l, kw, name, ast.TYPE_ENUM)
+	}
 	return parseEnumBody(s, l)
 }
 
-func parseEnum(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error) {
+// parseQualifiedTypeRef parses a reference to a named type qualified by the
+// keyword of its kind, as in C (i.e. "struct foo"). The type is checked to
+// be of that kind once the whole file has been parsed, as it may not yet
+// be defined
+func parseQualifiedTypeRef(s *ast.Specification, l *parser, kw, name *lexer.Token, kind ast.TypeKind) (*ast.Type, error) {
+	typ, err := s.TypeRef(name.Value)
+	if err != nil {
+		return nil, name.Errorf("'%s': %s", name.Value, err)
+	}
+
+	l.atEnd = append(l.atEnd, func() error {
+		// Types which are never defined are reported by validation
+		d := s.Definitions[typ.Ref]
+		if d.Body.Type != nil && d.Body.Type.Kind != kind {
+			return name.Errorf("'%s' is referenced as %s %s, but is not %s", name.Value, kw.Value, name.Value, kindArticle[kind])
+		}
+		return nil
+	})
+	return typ, nil
+}
+
+// kindArticle names the kinds of type which may qualify a type reference,
+// with their indefinite article
+var kindArticle = map[ast.TypeKind]string{
+	ast.TYPE_ENUM:   "an enum",
+	ast.TYPE_STRUCT: "a struct",
+	ast.TYPE_UNION:  "a union",
+}
+
+func parseEnum(s *ast.Specification, l *parser) (*ast.Definition, error) {
 	if _, err := l.Expect("enum", lexer.TokEnum); err != nil {
 		return nil, err
 	}
@@ -388,7 +541,7 @@ func parseEnum(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error) {
 	// in the output file)
 	_, err = s.TypeRef(ident.Value)
 	if err != nil {
-		return nil, err
+		return nil, ident.Errorf("'%s': %s", ident.Value, err)
 	}
 
 	body, err := parseEnumBody(s, l)
@@ -409,7 +562,7 @@ func parseEnum(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error) {
 	}, nil
 }
 
-func parseEnumBody(s *ast.Specification, l *lexer.Lexer) (*ast.Type, error) {
+func parseEnumBody(s *ast.Specification, l *parser) (*ast.Type, error) {
 	es := new(ast.EnumSpec)
 
 	if _, err := l.Expect("enum", '{'); err != nil {
@@ -425,6 +578,7 @@ body:
 			return nil, err
 		}
 
+		start := t
 		var attributes ast.Attributes
 		if t.ID == '[' {
 			l.Unget(t)
@@ -443,26 +597,28 @@ body:
 			if _, err := l.Expect("enum body", '='); err != nil {
 				return nil, err
 			}
-			v, err := parseValue(s, l)
-			if err != nil {
-				return nil, err
+
+			d := &ast.Definition{
+				Name:       t.Value,
+				Body:       &ast.Definition_Body{Kind: ast.DEFINITION_KIND_CONSTANT},
+				Attributes: docAttribute(attributes, start),
 			}
-			vu32, err := v.AsU32()
+			err := parseConstant(s, l, d.Name, func(c *ast.Constant) error {
+				v, err := c.AsI32()
+				d.Body.Constant = &ast.Constant{
+					Type:  ast.CONST_ENUM,
+					VEnum: v,
+				}
+				return err
+			})
 			if err != nil {
 				return nil, err
 			}
+			d.Location = location(start, l)
 
-			s.PutDefinition(&ast.Definition{
-				Name: t.Value,
-				Body: &ast.Definition_Body{
-					Kind: ast.DEFINITION_KIND_CONSTANT,
-					Constant: &ast.Constant{
-						Type:  ast.CONST_ENUM,
-						VEnum: vu32,
-					},
-				},
-				Attributes: attributes,
-			})
+			if _, err := s.PutDefinition(d); err != nil {
+				return nil, t.Errorf("'%s': %s", t.Value, err)
+			}
 
 			t, err = l.Expect("enum body", ',', '}')
 			if err != nil {
@@ -490,7 +646,7 @@ body:
 	}, nil
 }
 
-func parseStruct(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error) {
+func parseStruct(s *ast.Specification, l *parser) (*ast.Definition, error) {
 	if _, err := l.Expect("struct", lexer.TokStruct); err != nil {
 		return nil, err
 	}
@@ -504,7 +660,7 @@ func parseStruct(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error)
 	// (This helps the order of our output more closely reflect out input)
 	_, err = s.TypeRef(ident.Value)
 	if err != nil {
-		return nil, err
+		return nil, ident.Errorf("'%s': %s", ident.Value, err)
 	}
 
 	body, err := parseStructBody(s, l)
@@ -525,15 +681,19 @@ func parseStruct(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error)
 	}, nil
 }
 
-func parseStructTypeSpec(s *ast.Specification, l *lexer.Lexer) (*ast.Type, error) {
-	if _, err := l.Expect("struct", lexer.TokStruct); err != nil {
+func parseStructTypeSpec(s *ast.Specification, l *parser) (*ast.Type, error) {
+	kw, err := l.Expect("struct", lexer.TokStruct)
+	if err != nil {
 		return nil, err
 	}
 
+	if name := l.NextOneOf(lexer.TokIdent); name != nil {
+		return parseQualifiedTypeRef(s, l, kw, name, ast.TYPE_STRUCT)
+	}
 	return parseStructBody(s, l)
 }
 
-func parseStructBody(s *ast.Specification, l *lexer.Lexer) (*ast.Type, error) {
+func parseStructBody(s *ast.Specification, l *parser) (*ast.Type, error) {
 	if _, err := l.Expect("struct", '{'); err != nil {
 		return nil, err
 	}
@@ -568,7 +728,7 @@ body:
 	}, nil
 }
 
-func ParseUnion(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error) {
+func ParseUnion(s *ast.Specification, l *parser) (*ast.Definition, error) {
 	if _, err := l.Expect("union", lexer.TokUnion); err != nil {
 		return nil, err
 	}
@@ -582,7 +742,7 @@ func ParseUnion(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error) {
 	// (This helps the order of our output more closely reflect out input)
 	_, err = s.TypeRef(ident.Value)
 	if err != nil {
-		return nil, err
+		return nil, ident.Errorf("'%s': %s", ident.Value, err)
 	}
 
 	body, err := ParseUnionBody(s, l)
@@ -602,15 +762,18 @@ func ParseUnion(s *ast.Specification, l *lexer.Lexer) (*ast.Definition, error) {
 	}, nil
 }
 
-func ParseUnionTypeSpec(s *ast.Specification, l *lexer.Lexer) (*ast.Type, error) {
-	l.Expect("union", lexer.TokUnion)
+func ParseUnionTypeSpec(s *ast.Specification, l *parser) (*ast.Type, error) {
+	kw, _ := l.Expect("union", lexer.TokUnion)
+	if name := l.NextOneOf(lexer.TokIdent); name != nil {
+		return parseQualifiedTypeRef(s, l, kw, name, ast.TYPE_UNION)
+	}
 	return ParseUnionBody(s, l)
 }
 
-func ParseUnionBody(s *ast.Specification, l *lexer.Lexer) (*ast.Type, error) {
+func ParseUnionBody(s *ast.Specification, l *parser) (*ast.Type, error) {
 	var err error
 	us := &ast.UnionSpec{
-		Options: make(map[uint32]uint32),
+		Options: make(map[int32]uint32),
 	}
 
 	if _, err := l.Expect("union", lexer.TokSwitch); err != nil {
@@ -639,46 +802,69 @@ body:
 			break body
 		}
 
-		caseTok, err := l.Expect("union", lexer.TokCase)
-		if err != nil {
-			return nil, err
-		}
-		discriminantVal, err := parseValue(s, l)
-		if err != nil {
-			return nil, err
-		}
-		discriminant, err := discriminantVal.AsU32()
-		if err != nil {
-			return nil, err
+		// Several case labels may share an arm, i.e. "case A: case B: int x;"
+		type caseLabel struct {
+			tok   *lexer.Token
+			value *int32
 		}
-		if _, err := l.Expect("union", ':'); err != nil {
-			return nil, err
+		var labels []caseLabel
+		for {
+			caseTok, err := l.Expect("union", lexer.TokCase)
+			if err != nil {
+				return nil, err
+			}
+			label := caseLabel{caseTok, new(int32)}
+			if err := parseCaseValue(s, l, label.value); err != nil {
+				return nil, err
+			}
+			if _, err := l.Expect("union", ':'); err != nil {
+				return nil, err
+			}
+
+			labels = append(labels, label)
+			if l.Peek().ID != lexer.TokCase {
+				break
+			}
 		}
+		caseTok := labels[0].tok
+
 		declaration, err := parseDeclaration(s, l)
 		if err != nil {
 			return nil, err
 		}
+		// Comments usually precede the case label rather than the declaration
+		declaration.Attributes = docAttribute(declaration.Attributes, caseTok)
 		if _, err := l.Expect("union", ';'); err != nil {
 			return nil, err
 		}
 
-		if us.HasOption(discriminant) {
-			return nil, caseTok.Errorf("Value conflicts with existing alternative")
-		} else if declaration.Name == us.Discriminant.Name {
+		if declaration.Name == us.Discriminant.Name {
 			return nil, caseTok.Errorf("Alternative name '%s' conflicts with that of union discriminant", declaration.Name)
 		}
 
 		pos, existing := us.GetMember(declaration.Name)
 		if existing != nil {
 			if !existing.Equal(declaration) {
-				caseTok.Error("Alternative name is not unique and type mismatches")
+				l.Report(caseTok.Errorf("Alternative name '%s' is not unique and type mismatches", declaration.Name))
 			}
 		} else {
 			pos = uint32(len(us.Members))
 			us.Members = append(us.Members, declaration)
 		}
 
-		us.Options[discriminant] = pos
+		for _, label := range labels {
+			label := label
+			err = l.afterResolution(func() error {
+				if us.HasOption(*label.value) {
+					return label.tok.Errorf("Value conflicts with existing alternative")
+				}
+				us.Options[*label.value] = pos
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	if caseTok := l.NextOneOf(lexer.TokDefault); caseTok != nil {
@@ -689,6 +875,8 @@ body:
 		if err != nil {
 			return nil, err
 		}
+		// Comments usually precede the case label rather than the declaration
+		declaration.Attributes = docAttribute(declaration.Attributes, caseTok)
 		if _, err := l.Expect("union", ';'); err != nil {
 			return nil, err
 		}
@@ -700,7 +888,7 @@ body:
 		pos, existing := us.GetMember(declaration.Name)
 		if existing != nil {
 			if !existing.Equal(declaration) {
-				caseTok.Error("Alternative name is not unique and type mismatches")
+				l.Report(caseTok.Errorf("Alternative name '%s' is not unique and type mismatches", declaration.Name))
 			}
 		} else {
 			pos = uint32(len(us.Members))
@@ -719,3 +907,240 @@ body:
 		UnionSpec: us,
 	}, nil
 }
+
+// parseCaseValue parses the value of a union case label. Values outside the
+// range of an int (which are only valid for unsigned int discriminants) are
+// stored as the int with the same encoding
+func parseCaseValue(s *ast.Specification, l *parser, dest *int32) error {
+	return parseValue(s, l, func(c *ast.Constant) (err error) {
+		*dest, err = c.AsI32()
+		if err != nil && c.Type == ast.CONST_POS_INT {
+			var v uint32
+			v, err = c.AsU32()
+			*dest = int32(v)
+		}
+		return err
+	})
+}
+
+func parseProgram(s *ast.Specification, l *parser) (*ast.Definition, error) {
+	if _, err := l.Expect("program", lexer.TokProgram); err != nil {
+		return nil, err
+	}
+
+	ident, err := l.Expect("program", lexer.TokIdent)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := l.Expect("program", '{'); err != nil {
+		return nil, err
+	}
+
+	p := new(ast.ProgramSpec)
+	for l.NextOneOf('}') == nil {
+		t := l.Peek()
+		v, err := parseVersion(s, l)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.GetVersion(v.Name) != nil {
+			return nil, t.Errorf("Attempt to redefine version '%s'", v.Name)
+		}
+
+		prior := p.Versions
+		err = l.afterResolution(func() error {
+			for _, x := range prior {
+				if x.Number == v.Number {
+					return t.Errorf("Version '%s' number %d conflicts with existing version", v.Name, v.Number)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		p.Versions = append(p.Versions, v)
+	}
+
+	if len(p.Versions) == 0 {
+		return nil, ident.Errorf("Program '%s' must define at least one version", ident.Value)
+	}
+
+	if _, err := l.Expect("program", '='); err != nil {
+		return nil, err
+	}
+
+	if err := parseNumber(s, l, &p.Number); err != nil {
+		return nil, err
+	}
+
+	if _, err := l.Expect("program", ';'); err != nil {
+		return nil, err
+	}
+
+	return &ast.Definition{
+		Name: ident.Value,
+		Body: &ast.Definition_Body{
+			Kind:        ast.DEFINITION_KIND_PROGRAM,
+			ProgramSpec: p,
+		},
+	}, nil
+}
+
+func parseVersion(s *ast.Specification, l *parser) (*ast.VersionSpec, error) {
+	var err error
+	v := new(ast.VersionSpec)
+	start := l.Peek()
+
+	v.Attributes, err = parseAttributes(s, l)
+	if err != nil {
+		return nil, err
+	}
+	v.Attributes = docAttribute(v.Attributes, start)
+
+	if _, err := l.Expect("version", lexer.TokVersion); err != nil {
+		return nil, err
+	}
+
+	ident, err := l.Expect("version", lexer.TokIdent)
+	if err != nil {
+		return nil, err
+	}
+	v.Name = ident.Value
+
+	if _, err := l.Expect("version", '{'); err != nil {
+		return nil, err
+	}
+
+	for l.NextOneOf('}') == nil {
+		t := l.Peek()
+		p, err := parseProcedure(s, l)
+		if err != nil {
+			return nil, err
+		}
+
+		if v.GetProcedure(p.Name) != nil {
+			return nil, t.Errorf("Attempt to redefine procedure '%s'", p.Name)
+		}
+
+		prior := v.Procedures
+		err = l.afterResolution(func() error {
+			for _, x := range prior {
+				if x.Number == p.Number {
+					return t.Errorf("Procedure '%s' number %d conflicts with existing procedure", p.Name, p.Number)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		v.Procedures = append(v.Procedures, p)
+	}
+
+	if len(v.Procedures) == 0 {
+		return nil, ident.Errorf("Version '%s' must define at least one procedure", ident.Value)
+	}
+
+	if _, err := l.Expect("version", '='); err != nil {
+		return nil, err
+	}
+
+	if err := parseNumber(s, l, &v.Number); err != nil {
+		return nil, err
+	}
+
+	if _, err := l.Expect("version", ';'); err != nil {
+		return nil, err
+	}
+
+	v.Location = location(start, l)
+	return v, nil
+}
+
+func parseProcedure(s *ast.Specification, l *parser) (*ast.Procedure, error) {
+	var err error
+	p := new(ast.Procedure)
+	start := l.Peek()
+
+	p.Attributes, err = parseAttributes(s, l)
+	if err != nil {
+		return nil, err
+	}
+	p.Attributes = docAttribute(p.Attributes, start)
+
+	p.Result, err = parseProcedureType(s, l)
+	if err != nil {
+		return nil, err
+	}
+
+	ident, err := l.Expect("procedure", lexer.TokIdent)
+	if err != nil {
+		return nil, err
+	}
+	p.Name = ident.Value
+
+	if _, err := l.Expect("procedure", '('); err != nil {
+		return nil, err
+	}
+
+	for {
+		t := l.Peek()
+		arg, err := parseProcedureType(s, l)
+		if err != nil {
+			return nil, err
+		}
+
+		if arg.Kind == ast.TYPE_VOID {
+			if len(p.Arguments) > 0 || l.Peek().ID != ')' {
+				return nil, t.Errorf("void must be the only argument of procedure '%s'", p.Name)
+			}
+		} else {
+			p.Arguments = append(p.Arguments, arg)
+		}
+
+		t, err = l.Expect("procedure", ',', ')')
+		if err != nil {
+			return nil, err
+		}
+
+		if t.ID == ')' {
+			break
+		}
+	}
+
+	if _, err := l.Expect("procedure", '='); err != nil {
+		return nil, err
+	}
+
+	if err := parseNumber(s, l, &p.Number); err != nil {
+		return nil, err
+	}
+
+	if _, err := l.Expect("procedure", ';'); err != nil {
+		return nil, err
+	}
+
+	p.Location = location(start, l)
+	return p, nil
+}
+
+func parseProcedureType(s *ast.Specification, l *parser) (*ast.Type, error) {
+	t := l.Peek()
+	typ, err := parseTypeSpecifier(s, l, "procedure")
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ.Kind {
+	case ast.TYPE_STRING, ast.TYPE_OPAQUE:
+		return nil, t.Errorf("%s cannot be used in a procedure signature without a typedef", t)
+	case ast.TYPE_ENUM, ast.TYPE_STRUCT, ast.TYPE_UNION:
+		return nil, t.Errorf("Anonymous %s cannot be used in a procedure signature", t)
+	}
+	return typ, nil
+}
@@ -0,0 +1,320 @@
+package parser
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.e43.eu/xdrgen/ast"
+)
+
+const signedSpec = `
+enum nfsstat3 {
+	NFS3_OK = 0,
+	NFS3ERR_X = -1,
+	NFS3ERR_MIN = -2147483648,
+	NFS3ERR_MAX = 2147483647
+};
+
+union signed_res switch (int status) {
+case -1:
+	int x;
+case -2147483648:
+	void;
+default:
+	void;
+};
+
+union unsigned_res switch (unsigned int status) {
+case 0:
+	void;
+case 0xFFFFFFFF:
+	int x;
+};
+
+union enum_res switch (nfsstat3 status) {
+case NFS3ERR_X:
+	int x;
+default:
+	void;
+};
+`
+
+func parse(t *testing.T, spec string) *ast.Specification {
+	s, err := ParseSpecification(strings.NewReader(spec), "test.x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSignedValues(t *testing.T) {
+	s := parse(t, signedSpec)
+
+	typ, err := s.GetType("nfsstat3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]int32{
+		"NFS3_OK":     0,
+		"NFS3ERR_X":   -1,
+		"NFS3ERR_MIN": math.MinInt32,
+		"NFS3ERR_MAX": math.MaxInt32,
+	} {
+		if v, ok := typ.EnumSpec.GetValue(s, name); !ok || v != want {
+			t.Errorf("%s = %d, expected %d", name, v, want)
+		}
+	}
+
+	for name, cases := range map[string][]int32{
+		"signed_res": {-1, math.MinInt32},
+		// Case labels of unsigned discriminants are stored as the int with
+		// the same encoding
+		"unsigned_res": {0, -1},
+		"enum_res":     {-1},
+	} {
+		typ, err := s.GetType(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(typ.UnionSpec.Options) != len(cases) {
+			t.Errorf("%s has cases %v, expected %v", name, typ.UnionSpec.Options, cases)
+		}
+		for _, c := range cases {
+			if !typ.UnionSpec.HasOption(c) {
+				t.Errorf("%s has no case %d", name, c)
+			}
+		}
+	}
+
+	if err := s.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSignedValueErrors(t *testing.T) {
+	for _, spec := range []string{
+		"enum e { A = 2147483648 };",
+		"enum e { A = -2147483649 };",
+		"union u switch (int d) { case 4294967296: void; };",
+		"union u switch (int d) { case -2147483649: void; };",
+	} {
+		if _, err := ParseSpecification(strings.NewReader(spec), "test.x"); err == nil {
+			t.Errorf("Parsed %q", spec)
+		}
+	}
+
+	s := parse(t, "union u switch (bool d) { case -1: void; };")
+	if err := s.Validate(); err == nil {
+		t.Error("Validated a bool discriminant with case -1")
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		errs []string
+	}{
+		{
+			"Errors in several definitions",
+			"struct a { int x };\nstruct b { int y; };\ntypedef int c<;\nconst d = ;\n",
+			[]string{
+				`test.x:1:18: error: Unexpected "}" while parsing struct body (Expected one of ";")`,
+				`test.x:3:15: error: Unexpected ";" while parsing constant`,
+				`test.x:4:11: error: Unexpected ";" while parsing constant`,
+			},
+		},
+		{
+			// Parsing resumes after the definition containing the nested
+			// error, and at the next definition after a missing ";", so b is
+			// defined twice
+			"Resuming at definition boundaries",
+			"struct a { int x; union switch (int d) { case 1 int y; } u; };\nstruct b { int y; };\nconst c = 1\nstruct b { int z; };\n",
+			[]string{
+				`test.x:1:49: error: Unexpected int while parsing union (Expected one of ":")`,
+				`test.x:4:1: error: Unexpected struct while parsing const (Expected one of ";")`,
+				`test.x:4:1: error: 'b': Attempt to redefine type`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		s, err := ParseSpecification(strings.NewReader(test.spec), "test.x")
+		if err == nil {
+			t.Errorf("%s: parsed %d definitions", test.name, len(s.Definitions))
+		} else if err.Error() != strings.Join(test.errs, "\n") {
+			t.Errorf("%s: got errors\n\t%s\nexpected\n\t%s", test.name, strings.Replace(err.Error(), "\n", "\n\t", -1), strings.Join(test.errs, "\n\t"))
+		}
+	}
+}
+
+const locationSpec = `struct a {
+	int x;
+	union switch (int d) {
+	case 1:
+		int y;
+	default:
+		void;
+	} u;
+};
+`
+
+func TestLocations(t *testing.T) {
+	s := parse(t, locationSpec)
+	typ, err := s.GetType("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := typ.StructSpec.Members
+	union := members[1].Type.UnionSpec
+
+	loc := func(line, col, endLine, endCol uint32) *ast.Location {
+		return &ast.Location{File: "test.x", Line: line, Column: col, EndLine: endLine, EndColumn: endCol}
+	}
+	for name, test := range map[string]struct {
+		got, want *ast.Location
+	}{
+		"a":             {s.Definitions[0].Location, loc(1, 1, 9, 3)},
+		"a.x":           {members[0].Location, loc(2, 2, 2, 7)},
+		"a.u":           {members[1].Location, loc(3, 2, 8, 5)},
+		"a.u.d":         {union.Discriminant.Location, loc(3, 16, 3, 21)},
+		"a.u.y":         {union.Members[0].Location, loc(5, 3, 5, 8)},
+		"a.u.<default>": {union.Members[1].Location, loc(7, 3, 7, 7)},
+	} {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s is at %+v, expected %+v", name, test.got, test.want)
+		}
+	}
+}
+
+const docSpec = `/* The a struct */
+struct a {
+	// The x member
+	int x;
+	union switch (int d) {
+	// The first arm
+	case 1:
+		int y;
+	default:
+		void;
+	} u;
+};
+
+// Ignored in favour of the attribute
+[doc("Explicit")]
+enum e {
+	// The A value
+	A = 1,
+	B = 2
+};
+`
+
+func TestDocComments(t *testing.T) {
+	s := parse(t, docSpec)
+	typ, err := s.GetType("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := typ.StructSpec.Members
+	union := members[1].Type.UnionSpec
+
+	defs := make(map[string]ast.Attributes)
+	for _, d := range s.Definitions {
+		defs[d.Name] = d.Attributes
+	}
+
+	for name, test := range map[string]struct {
+		attrs ast.Attributes
+		want  string
+	}{
+		"a":           {defs["a"], "The a struct"},
+		"a.x":         {members[0].Attributes, "The x member"},
+		"a.u":         {members[1].Attributes, ""},
+		"a.u.y":       {union.Members[0].Attributes, "The first arm"},
+		"a.u.default": {union.Members[1].Attributes, ""},
+		"e":           {defs["e"], "Explicit"},
+		"A":           {defs["A"], "The A value"},
+		"B":           {defs["B"], ""},
+	} {
+		if doc := test.attrs.GetString("doc"); doc != test.want {
+			t.Errorf("%s has doc %q, expected %q", name, doc, test.want)
+		}
+	}
+}
+
+func TestQualifiedReferences(t *testing.T) {
+	s := parse(t, "struct foo { int v; struct foo *next; foo *other; };\nenum e { X = 1 };\nstruct s { enum e a; e b; };\n")
+
+	for name, decls := range map[string][]int{"foo": {1, 2}, "s": {0, 1}} {
+		typ, err := s.GetType(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		qualified := typ.StructSpec.Members[decls[0]].Type
+		plain := typ.StructSpec.Members[decls[1]].Type
+		if !reflect.DeepEqual(qualified, plain) {
+			t.Errorf("%s: qualified reference %+v differs from %+v", name, qualified, plain)
+		}
+	}
+
+	for spec, want := range map[string]string{
+		"enum e2 { X = 1 };\nstruct s { union e2 q; };\n": "test.x:2:18: error: 'e2' is referenced as union e2, but is not a union",
+		"enum e { X = 1 };\nstruct s { struct e *x; };\n": "test.x:2:19: error: 'e' is referenced as struct e, but is not a struct",
+	} {
+		if _, err := ParseSpecification(strings.NewReader(spec), "test.x"); err == nil || err.Error() != want {
+			t.Errorf("%q: got error %v, expected %q", spec, err, want)
+		}
+	}
+}
+
+func TestPassthroughs(t *testing.T) {
+	s := parse(t, "%#include <rpc/rpc.h>\nstruct a {\n%inside\n\tint x;\n};\n")
+
+	want := []*ast.Passthrough{
+		{
+			Text:     "#include <rpc/rpc.h>",
+			Position: 0,
+			Location: &ast.Location{File: "test.x", Line: 1, Column: 1, EndLine: 1, EndColumn: 22},
+		},
+		// Lines within a definition follow it
+		{
+			Text:     "inside",
+			Position: 1,
+			Location: &ast.Location{File: "test.x", Line: 3, Column: 1, EndLine: 3, EndColumn: 8},
+		},
+	}
+	if !reflect.DeepEqual(s.Passthroughs, want) {
+		for _, p := range s.Passthroughs {
+			t.Errorf("Got passthrough %+v at %+v", p, p.Location)
+		}
+		t.Errorf("Expected %d passthroughs", len(want))
+	}
+}
+
+func TestLineMarkers(t *testing.T) {
+	s := parse(t, "# 1 \"test.x\"\nconst A = 1;\n# 40 \"nfs.x\" 2\nconst B = 2;\n#line 7\nconst C = 3;\n")
+
+	for _, test := range []struct {
+		name string
+		want ast.Location
+	}{
+		{"A", ast.Location{File: "test.x", Line: 1, Column: 1, EndLine: 1, EndColumn: 13}},
+		{"B", ast.Location{File: "nfs.x", Line: 40, Column: 1, EndLine: 40, EndColumn: 13}},
+		// A marker without a file name keeps the last one
+		{"C", ast.Location{File: "nfs.x", Line: 7, Column: 1, EndLine: 7, EndColumn: 13}},
+	} {
+		d := s.NamedDefinition(test.name)
+		if d == nil {
+			t.Errorf("%s is not defined", test.name)
+		} else if !reflect.DeepEqual(*d.Location, test.want) {
+			t.Errorf("%s is at %+v, expected %+v", test.name, *d.Location, test.want)
+		}
+	}
+
+	_, err := ParseSpecification(strings.NewReader("const A = 1;\n# 40 \"nfs.x\" 2\nconst B = ;\n"), "test.x")
+	if want := "nfs.x:40:11: error: Unexpected \";\" while parsing constant"; err == nil || err.Error() != want {
+		t.Errorf("Got error %v, expected %q", err, want)
+	}
+}
@@ -0,0 +1,7 @@
+import "common.x";
+import "sub/b.x";
+
+struct a {
+	common c;
+	b x;
+};
@@ -0,0 +1,3 @@
+struct common {
+	int v;
+};
@@ -0,0 +1,5 @@
+import "common.x";
+
+struct b {
+	common c;
+};
@@ -0,0 +1,147 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// AuthFlavor identifies an authentication mechanism
+type AuthFlavor uint32
+
+const (
+	AUTH_NONE  AuthFlavor = 0
+	AUTH_SYS   AuthFlavor = 1
+	AUTH_SHORT AuthFlavor = 2
+)
+
+// OpaqueAuth is a credential or verifier. The zero value is an AUTH_NONE
+// credential
+type OpaqueAuth struct {
+	Flavor AuthFlavor
+	Body   []byte
+}
+
+// AuthStat is the reason a call was rejected due to an authentication error
+type AuthStat uint32
+
+const (
+	AUTH_OK           AuthStat = 0
+	AUTH_BADCRED      AuthStat = 1
+	AUTH_REJECTEDCRED AuthStat = 2
+	AUTH_BADVERF      AuthStat = 3
+	AUTH_REJECTEDVERF AuthStat = 4
+	AUTH_TOOWEAK      AuthStat = 5
+	AUTH_INVALIDRESP  AuthStat = 6
+	AUTH_FAILED       AuthStat = 7
+)
+
+var authStatStrings = map[AuthStat]string{
+	AUTH_OK:           "Authentication succeeded",
+	AUTH_BADCRED:      "Bad credential",
+	AUTH_REJECTEDCRED: "Credential rejected",
+	AUTH_BADVERF:      "Bad verifier",
+	AUTH_REJECTEDVERF: "Verifier rejected",
+	AUTH_TOOWEAK:      "Credential too weak",
+	AUTH_INVALIDRESP:  "Invalid response verifier",
+	AUTH_FAILED:       "Authentication failed",
+}
+
+// Error satisfies error, so that the reason a call was rejected may be
+// returned as its error
+func (s AuthStat) Error() string {
+	if str, ok := authStatStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown authentication status %d", uint32(s))
+}
+
+const (
+	maxMachineName = 255
+	maxGIDs        = 16
+)
+
+// AuthSys is the body of an AUTH_SYS credential, which identifies the
+// caller by its (unverified) user and group IDs
+type AuthSys struct {
+	Stamp       uint32
+	MachineName string
+	UID         uint32
+	GID         uint32
+	GIDs        []uint32
+}
+
+// Auth encodes the credential as an OpaqueAuth, to be sent with calls
+func (a *AuthSys) Auth() (OpaqueAuth, error) {
+	if len(a.MachineName) > maxMachineName {
+		return OpaqueAuth{}, errors.New("AUTH_SYS machine name too long")
+	} else if len(a.GIDs) > maxGIDs {
+		return OpaqueAuth{}, errors.New("AUTH_SYS credential has too many groups")
+	}
+
+	e := new(encoder)
+	e.uint32(a.Stamp)
+	e.opaque([]byte(a.MachineName))
+	e.uint32(a.UID)
+	e.uint32(a.GID)
+	e.uint32(uint32(len(a.GIDs)))
+	for _, gid := range a.GIDs {
+		e.uint32(gid)
+	}
+	return OpaqueAuth{Flavor: AUTH_SYS, Body: e.buf}, nil
+}
+
+// ParseAuthSys decodes an AUTH_SYS credential
+func ParseAuthSys(oa OpaqueAuth) (*AuthSys, error) {
+	if oa.Flavor != AUTH_SYS {
+		return nil, fmt.Errorf("Credential has flavor %d, not AUTH_SYS", oa.Flavor)
+	}
+
+	d := &decoder{buf: oa.Body}
+	a := &AuthSys{
+		Stamp:       d.uint32(),
+		MachineName: string(d.opaque(maxMachineName)),
+		UID:         d.uint32(),
+		GID:         d.uint32(),
+	}
+
+	n := d.uint32()
+	if n > maxGIDs {
+		return nil, ErrMalformedMessage
+	}
+	for i := uint32(0); i < n; i++ {
+		a.GIDs = append(a.GIDs, d.uint32())
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	} else if len(d.buf) != 0 {
+		return nil, ErrMalformedMessage
+	}
+	return a, nil
+}
+
+type authContextKey struct{}
+
+func withAuth(ctx context.Context, cred OpaqueAuth) context.Context {
+	return context.WithValue(ctx, authContextKey{}, cred)
+}
+
+// AuthFromContext returns the credential of the call being handled by a
+// server, which is passed to the handler in its context
+func AuthFromContext(ctx context.Context) (OpaqueAuth, bool) {
+	cred, ok := ctx.Value(authContextKey{}).(OpaqueAuth)
+	return cred, ok
+}
+
+// AuthSysFromContext returns the AUTH_SYS credential of the call being
+// handled by a server, if it has one
+func AuthSysFromContext(ctx context.Context) (*AuthSys, bool) {
+	cred, ok := AuthFromContext(ctx)
+	if !ok || cred.Flavor != AUTH_SYS {
+		return nil, false
+	}
+
+	a, err := ParseAuthSys(cred)
+	return a, err == nil
+}
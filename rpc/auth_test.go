@@ -0,0 +1,74 @@
+package rpc
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuthSys(t *testing.T) {
+	a := &AuthSys{
+		Stamp:       0x12345678,
+		MachineName: "host",
+		UID:         1000,
+		GID:         100,
+		GIDs:        []uint32{4, 24, 27},
+	}
+	oa, err := a.Auth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		0x12, 0x34, 0x56, 0x78,
+		0, 0, 0, 4, 'h', 'o', 's', 't',
+		0, 0, 0x03, 0xe8,
+		0, 0, 0, 100,
+		0, 0, 0, 3, 0, 0, 0, 4, 0, 0, 0, 24, 0, 0, 0, 27,
+	}
+	if oa.Flavor != AUTH_SYS || !bytes.Equal(oa.Body, want) {
+		t.Fatalf("Encoded as %d %x, expected %x", oa.Flavor, oa.Body, want)
+	}
+
+	parsed, err := ParseAuthSys(oa)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(parsed, a) {
+		t.Errorf("Parsed %+v, expected %+v", parsed, a)
+	}
+}
+
+func TestAuthSysLimits(t *testing.T) {
+	if _, err := (&AuthSys{MachineName: strings.Repeat("x", 256)}).Auth(); err == nil {
+		t.Error("Encoded a machine name of 256 bytes")
+	}
+	if _, err := (&AuthSys{GIDs: make([]uint32, 17)}).Auth(); err == nil {
+		t.Error("Encoded 17 groups")
+	}
+}
+
+func TestParseAuthSysErrors(t *testing.T) {
+	valid, err := (&AuthSys{MachineName: "host", GIDs: []uint32{1}}).Auth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		oa   OpaqueAuth
+	}{
+		{"AUTH_NONE", OpaqueAuth{}},
+		{"Truncated", OpaqueAuth{Flavor: AUTH_SYS, Body: valid.Body[:len(valid.Body)-1]}},
+		{"Trailing data", OpaqueAuth{Flavor: AUTH_SYS, Body: append(valid.Body, 0, 0, 0, 0)}},
+		{"Too many groups", OpaqueAuth{Flavor: AUTH_SYS, Body: []byte{
+			0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 17,
+		}}},
+	}
+
+	for _, test := range tests {
+		if a, err := ParseAuthSys(test.oa); err == nil {
+			t.Errorf("%s: parsed %+v", test.name, a)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.e43.eu/xdr"
+)
+
+// ErrClientClosed is returned by calls made after the client is closed
+var ErrClientClosed = errors.New("RPC client closed")
+
+// Client is a Transport which sends calls over a stream connection, such as
+// TCP, using record marking. Calls may be made concurrently, and their
+// replies are matched to them by XID
+type Client struct {
+	// Auth is the credential sent with each call. The zero value is an
+	// AUTH_NONE credential
+	Auth OpaqueAuth
+
+	conn    io.ReadWriteCloser
+	xid     uint32
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint32]chan []byte
+	err     error
+	done    chan struct{}
+}
+
+// Dial connects to the address on the named network, as for net.Dial, and
+// returns a client using the connection
+func Dial(network, address string) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient returns a client which sends calls over conn. Replies larger
+// than DefaultMaxRecordSize are treated as an error, and close the client
+func NewClient(conn io.ReadWriteCloser) *Client {
+	c := &Client{
+		conn:    conn,
+		xid:     uint32(time.Now().UnixNano()),
+		pending: make(map[uint32]chan []byte),
+		done:    make(chan struct{}),
+	}
+	go c.readReplies()
+	return c
+}
+
+// Close closes the connection. Outstanding calls fail with ErrClientClosed
+func (c *Client) Close() error {
+	c.fail(ErrClientClosed)
+	return c.conn.Close()
+}
+
+// fail records the error which stopped the client, unless it has already
+// stopped, and wakes any outstanding calls
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+}
+
+func (c *Client) readReplies() {
+	for {
+		rec, err := ReadRecord(c.conn, DefaultMaxRecordSize)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		// Replies to calls which have been abandoned, and messages too short
+		// to be replies, are dropped
+		if len(rec) < 4 {
+			continue
+		}
+		xid := binary.BigEndian.Uint32(rec)
+
+		c.mu.Lock()
+		ch, ok := c.pending[xid]
+		delete(c.pending, xid)
+		c.mu.Unlock()
+
+		if ok {
+			ch <- rec
+		}
+	}
+}
+
+// Call sends a call to procedure proc of version vers of program prog, and
+// waits for its reply. If the context is done before the reply is received,
+// the call is abandoned and the context's error returned.
+//
+// Calls which are not accepted, or are unsuccessful, return an AcceptStat,
+// AuthStat or *MismatchError
+func (c *Client) Call(ctx context.Context, prog, vers, proc uint32, args, res interface{}) error {
+	var (
+		argBuf []byte
+		err    error
+	)
+	if args != nil {
+		if argBuf, err = xdr.Marshal(args); err != nil {
+			return err
+		}
+	}
+
+	xid := atomic.AddUint32(&c.xid, 1)
+	ch := make(chan []byte, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return err
+	}
+	c.pending[xid] = ch
+	c.mu.Unlock()
+
+	msg := encodeCall(&callHeader{
+		XID:  xid,
+		Prog: prog,
+		Vers: vers,
+		Proc: proc,
+		Cred: c.Auth,
+	}, argBuf)
+
+	c.writeMu.Lock()
+	err = WriteRecord(c.conn, msg)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.abandon(xid)
+		return err
+	}
+
+	var rec []byte
+	select {
+	case rec = <-ch:
+	case <-ctx.Done():
+		c.abandon(xid)
+		return ctx.Err()
+	case <-c.done:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.err
+	}
+
+	hdr, resBuf, err := decodeReply(rec)
+	if err != nil {
+		return err
+	} else if err := hdr.err(); err != nil {
+		return err
+	}
+
+	if res != nil {
+		return xdr.Read(bytes.NewReader(resBuf), res)
+	}
+	return nil
+}
+
+func (c *Client) abandon(xid uint32) {
+	c.mu.Lock()
+	delete(c.pending, xid)
+	c.mu.Unlock()
+}
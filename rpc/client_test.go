@@ -0,0 +1,89 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestClientMatchesReplies(t *testing.T) {
+	conn, srv := net.Pipe()
+	c := NewClient(conn)
+	defer c.Close()
+
+	// The server replies to the two calls in the opposite order, after
+	// replies to an unknown call and a message too short to be a reply,
+	// which are dropped. Each result is the procedure number of the call
+	go func() {
+		defer srv.Close()
+
+		var calls []*callHeader
+		for len(calls) < 2 {
+			rec, err := ReadRecord(srv, DefaultMaxRecordSize)
+			if err != nil {
+				return
+			}
+			call, _, err := decodeCall(rec)
+			if err != nil {
+				return
+			}
+			calls = append(calls, call)
+		}
+
+		WriteRecord(srv, encodeReply(&replyHeader{XID: calls[0].XID + calls[1].XID}, []byte{0, 0, 0, 9}))
+		WriteRecord(srv, []byte{1})
+		for i := len(calls) - 1; i >= 0; i-- {
+			e := new(encoder)
+			e.uint32(calls[i].Proc)
+			WriteRecord(srv, encodeReply(&replyHeader{XID: calls[i].XID}, e.buf))
+		}
+		ReadRecord(srv, DefaultMaxRecordSize)
+	}()
+
+	results := make(chan error, 2)
+	for proc := uint32(1); proc <= 2; proc++ {
+		go func(proc uint32) {
+			var res uint32
+			err := c.Call(context.Background(), testProg, 1, proc, nil, &res)
+			if err == nil && res != proc {
+				t.Errorf("Call to procedure %d received result %d", proc, res)
+			}
+			results <- err
+		}(proc)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestClientClosed(t *testing.T) {
+	conn, srv := net.Pipe()
+	defer srv.Close()
+
+	c := NewClient(conn)
+	c.Close()
+	if err := c.Call(context.Background(), testProg, 1, 0, nil, nil); err != ErrClientClosed {
+		t.Errorf("Call after Close returned %v, expected %v", err, ErrClientClosed)
+	}
+}
+
+func TestClientReplyTooLarge(t *testing.T) {
+	conn, srv := net.Pipe()
+	defer srv.Close()
+
+	c := NewClient(conn)
+	defer c.Close()
+
+	go func() {
+		if _, err := ReadRecord(srv, DefaultMaxRecordSize); err == nil {
+			srv.Write([]byte{0x80, 0x40, 0x00, 0x01})
+		}
+	}()
+
+	if err := c.Call(context.Background(), testProg, 1, 0, nil, nil); err != ErrRecordTooLarge {
+		t.Errorf("Oversized reply returned %v, expected %v", err, ErrRecordTooLarge)
+	}
+}
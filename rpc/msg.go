@@ -0,0 +1,279 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The version of the RPC protocol implemented by this package
+const rpcVersion = 2
+
+// The maximum length of the body of an opaque_auth
+const maxAuthBody = 400
+
+type msgType uint32
+
+const (
+	msgCall  msgType = 0
+	msgReply msgType = 1
+)
+
+type replyStat uint32
+
+const (
+	msgAccepted replyStat = 0
+	msgDenied   replyStat = 1
+)
+
+// RejectStat is the reason a call was rejected by the server
+type RejectStat uint32
+
+const (
+	RPC_MISMATCH RejectStat = 0
+	AUTH_ERROR   RejectStat = 1
+)
+
+// ErrMalformedMessage is returned when a message can't be decoded
+var ErrMalformedMessage = errors.New("Malformed RPC message")
+
+// MismatchError is returned when the server does not support the requested
+// version of the RPC protocol, or of the program being called
+type MismatchError struct {
+	// Program is set if the version of the program is not supported, and
+	// clear if the version of the RPC protocol is not supported
+	Program bool
+	// Low and High are the lowest and highest supported versions
+	Low, High uint32
+}
+
+func (err *MismatchError) Error() string {
+	what := "RPC"
+	if err.Program {
+		what = "Program"
+	}
+	return fmt.Sprintf("%s version mismatch (supported versions are %d to %d)", what, err.Low, err.High)
+}
+
+// callHeader is the header of a call message, which is followed by the
+// arguments of the call
+type callHeader struct {
+	XID        uint32
+	RPCVersion uint32
+	Prog       uint32
+	Vers       uint32
+	Proc       uint32
+	Cred       OpaqueAuth
+	Verf       OpaqueAuth
+}
+
+// replyHeader is the header of a reply message, which is followed by the
+// result of the call if it was accepted and successful
+type replyHeader struct {
+	XID        uint32
+	Stat       replyStat
+	Verf       OpaqueAuth
+	AcceptStat AcceptStat
+	RejectStat RejectStat
+	AuthStat   AuthStat
+	// The range of versions supported, for RPC_MISMATCH and PROG_MISMATCH
+	Low, High uint32
+}
+
+// err returns the error corresponding to an unsuccessful reply
+func (h *replyHeader) err() error {
+	switch h.Stat {
+	case msgAccepted:
+		switch h.AcceptStat {
+		case SUCCESS:
+			return nil
+		case PROG_MISMATCH:
+			return &MismatchError{Program: true, Low: h.Low, High: h.High}
+		default:
+			return h.AcceptStat
+		}
+
+	default:
+		switch h.RejectStat {
+		case RPC_MISMATCH:
+			return &MismatchError{Low: h.Low, High: h.High}
+		default:
+			return h.AuthStat
+		}
+	}
+}
+
+// encoder appends XDR encoded values to a buffer
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) opaque(v []byte) {
+	e.uint32(uint32(len(v)))
+	e.buf = append(e.buf, v...)
+	for i := len(v); i%4 != 0; i++ {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) auth(a OpaqueAuth) {
+	e.uint32(uint32(a.Flavor))
+	e.opaque(a.Body)
+}
+
+// decoder reads XDR encoded values from a buffer. Once an error has occurred,
+// further reads return zero values, so that errors need only be checked once
+// all values have been read
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uint32() uint32 {
+	if d.err != nil || len(d.buf) < 4 {
+		d.err = ErrMalformedMessage
+		return 0
+	}
+
+	v := binary.BigEndian.Uint32(d.buf)
+	d.buf = d.buf[4:]
+	return v
+}
+
+func (d *decoder) opaque(max uint32) []byte {
+	n := d.uint32()
+	padded := (uint64(n) + 3) &^ 3
+	if d.err != nil || n > max || uint64(len(d.buf)) < padded {
+		d.err = ErrMalformedMessage
+		return nil
+	}
+
+	v := d.buf[:n:n]
+	d.buf = d.buf[padded:]
+	return v
+}
+
+func (d *decoder) auth() OpaqueAuth {
+	return OpaqueAuth{
+		Flavor: AuthFlavor(d.uint32()),
+		Body:   d.opaque(maxAuthBody),
+	}
+}
+
+func encodeCall(h *callHeader, args []byte) []byte {
+	e := &encoder{buf: make([]byte, 0, 40+len(h.Cred.Body)+len(h.Verf.Body)+len(args))}
+	e.uint32(h.XID)
+	e.uint32(uint32(msgCall))
+	e.uint32(rpcVersion)
+	e.uint32(h.Prog)
+	e.uint32(h.Vers)
+	e.uint32(h.Proc)
+	e.auth(h.Cred)
+	e.auth(h.Verf)
+	return append(e.buf, args...)
+}
+
+// decodeCall decodes the header of a call message, returning it and the
+// encoded arguments. If the message is not a call, ErrMalformedMessage is
+// returned. If the RPC version is not supported, only XID and RPCVersion
+// are decoded
+func decodeCall(msg []byte) (*callHeader, []byte, error) {
+	d := &decoder{buf: msg}
+	h := &callHeader{XID: d.uint32()}
+	if msgType(d.uint32()) != msgCall {
+		return nil, nil, ErrMalformedMessage
+	}
+
+	h.RPCVersion = d.uint32()
+	if d.err == nil && h.RPCVersion != rpcVersion {
+		return h, nil, nil
+	}
+
+	h.Prog = d.uint32()
+	h.Vers = d.uint32()
+	h.Proc = d.uint32()
+	h.Cred = d.auth()
+	h.Verf = d.auth()
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	return h, d.buf, nil
+}
+
+func encodeReply(h *replyHeader, res []byte) []byte {
+	e := &encoder{buf: make([]byte, 0, 32+len(h.Verf.Body)+len(res))}
+	e.uint32(h.XID)
+	e.uint32(uint32(msgReply))
+	e.uint32(uint32(h.Stat))
+
+	switch h.Stat {
+	case msgAccepted:
+		e.auth(h.Verf)
+		e.uint32(uint32(h.AcceptStat))
+		switch h.AcceptStat {
+		case SUCCESS:
+			e.buf = append(e.buf, res...)
+		case PROG_MISMATCH:
+			e.uint32(h.Low)
+			e.uint32(h.High)
+		}
+
+	case msgDenied:
+		e.uint32(uint32(h.RejectStat))
+		switch h.RejectStat {
+		case RPC_MISMATCH:
+			e.uint32(h.Low)
+			e.uint32(h.High)
+		case AUTH_ERROR:
+			e.uint32(uint32(h.AuthStat))
+		}
+	}
+	return e.buf
+}
+
+// decodeReply decodes the header of a reply message, returning it and the
+// encoded result
+func decodeReply(msg []byte) (*replyHeader, []byte, error) {
+	d := &decoder{buf: msg}
+	h := &replyHeader{XID: d.uint32()}
+	if msgType(d.uint32()) != msgReply {
+		return nil, nil, ErrMalformedMessage
+	}
+
+	h.Stat = replyStat(d.uint32())
+	switch h.Stat {
+	case msgAccepted:
+		h.Verf = d.auth()
+		h.AcceptStat = AcceptStat(d.uint32())
+		if h.AcceptStat == PROG_MISMATCH {
+			h.Low = d.uint32()
+			h.High = d.uint32()
+		}
+
+	case msgDenied:
+		h.RejectStat = RejectStat(d.uint32())
+		switch h.RejectStat {
+		case RPC_MISMATCH:
+			h.Low = d.uint32()
+			h.High = d.uint32()
+		case AUTH_ERROR:
+			h.AuthStat = AuthStat(d.uint32())
+		default:
+			return nil, nil, ErrMalformedMessage
+		}
+
+	default:
+		return nil, nil, ErrMalformedMessage
+	}
+
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	return h, d.buf, nil
+}
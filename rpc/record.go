@@ -0,0 +1,91 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// The bit of a fragment header which marks the last fragment of a record
+const lastFragment = 1 << 31
+
+// The maximum length of a fragment
+const maxFragment = lastFragment - 1
+
+// DefaultMaxRecordSize is the default limit on the size of records received
+const DefaultMaxRecordSize = 4 << 20
+
+// ErrRecordTooLarge is returned when a record exceeds the maximum size
+var ErrRecordTooLarge = errors.New("RPC record too large")
+
+// WriteRecord writes a record using the record marking standard for stream
+// transports such as TCP (RFC 5531 section 11)
+func WriteRecord(w io.Writer, rec []byte) error {
+	var hdr [4]byte
+	for {
+		frag, last := rec, true
+		if len(frag) > maxFragment {
+			frag, last = rec[:maxFragment], false
+		}
+
+		n := uint32(len(frag))
+		if last {
+			n |= lastFragment
+		}
+		binary.BigEndian.PutUint32(hdr[:], n)
+
+		if _, err := w.Write(hdr[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(frag); err != nil {
+			return err
+		}
+
+		rec = rec[len(frag):]
+		if last {
+			return nil
+		}
+	}
+}
+
+// ReadRecord reads a record written using the record marking standard,
+// joining its fragments. Records larger than max bytes are rejected.
+//
+// io.EOF is returned only if the stream ends before the start of a record
+func ReadRecord(r io.Reader, max int) ([]byte, error) {
+	var (
+		hdr [4]byte
+		rec []byte
+	)
+
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF && rec != nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		n := binary.BigEndian.Uint32(hdr[:])
+		size := int64(n &^ lastFragment)
+		if int64(len(rec))+size > int64(max) {
+			return nil, ErrRecordTooLarge
+		}
+
+		start := len(rec)
+		if rec == nil {
+			rec = make([]byte, 0, size)
+		}
+		rec = append(rec, make([]byte, size)...)
+		if _, err := io.ReadFull(r, rec[start:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		if n&lastFragment != 0 {
+			return rec, nil
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, rec := range [][]byte{{}, []byte("hello"), bytes.Repeat([]byte{0xa5}, 1<<16)} {
+		if err := WriteRecord(&buf, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range [][]byte{{}, []byte("hello"), bytes.Repeat([]byte{0xa5}, 1<<16)} {
+		rec, err := ReadRecord(&buf, DefaultMaxRecordSize)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(rec, want) {
+			t.Errorf("Read %d bytes, expected %d", len(rec), len(want))
+		}
+	}
+
+	if _, err := ReadRecord(&buf, DefaultMaxRecordSize); err != io.EOF {
+		t.Errorf("Read past the last record returned %v, expected EOF", err)
+	}
+}
+
+func TestReadRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		max  int
+		rec  string
+		err  error
+	}{
+		{"One fragment", "\x80\x00\x00\x03abc", 16, "abc", nil},
+		{"Fragments", "\x00\x00\x00\x03abc\x00\x00\x00\x00\x80\x00\x00\x02de", 16, "abcde", nil},
+		{"Empty last fragment", "\x00\x00\x00\x03abc\x80\x00\x00\x00", 16, "abc", nil},
+		{"Record at limit", "\x00\x00\x00\x03abc\x80\x00\x00\x01d", 4, "abcd", nil},
+		{"Fragment too large", "\x80\x00\x00\x05abcde", 4, "", ErrRecordTooLarge},
+		{"Fragments too large", "\x00\x00\x00\x03abc\x80\x00\x00\x02de", 4, "", ErrRecordTooLarge},
+		{"Huge fragment", "\xff\xff\xff\xff", DefaultMaxRecordSize, "", ErrRecordTooLarge},
+		{"Empty", "", 16, "", io.EOF},
+		{"Truncated header", "\x80\x00", 16, "", io.ErrUnexpectedEOF},
+		{"Truncated fragment", "\x80\x00\x00\x03ab", 16, "", io.ErrUnexpectedEOF},
+		{"Missing last fragment", "\x00\x00\x00\x03abc", 16, "", io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		rec, err := ReadRecord(bytes.NewReader([]byte(test.data)), test.max)
+		if err != test.err {
+			t.Errorf("%s: got error %v, expected %v", test.name, err, test.err)
+		} else if err == nil && string(rec) != test.rec {
+			t.Errorf("%s: got %q, expected %q", test.name, rec, test.rec)
+		}
+	}
+}
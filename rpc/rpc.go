@@ -0,0 +1,62 @@
+// Package rpc provides the support used by code generated for ONC RPC
+// programs (RFC 5531)
+package rpc
+
+import (
+	"context"
+	"fmt"
+)
+
+// Transport sends calls to remote programs. It is used by generated clients
+//
+// args is the value to be encoded as the arguments of the call, or nil if
+// the procedure takes no arguments. res is a pointer to the value to decode
+// the result into, or nil if the procedure returns no result
+type Transport interface {
+	Call(ctx context.Context, prog, vers, proc uint32, args, res interface{}) error
+}
+
+// Handler dispatches calls to a version of a program. Handlers are generated
+// for each program version, and call an implementation of its server interface
+type Handler interface {
+	Program() uint32
+	Version() uint32
+
+	// Dispatch calls procedure proc, and returns its result. decode is used
+	// to decode the arguments of the call into a pointer to their value.
+	//
+	// An AcceptStat is returned if the procedure is unavailable or the
+	// arguments can't be decoded. Other errors are returned by the procedure
+	// itself
+	Dispatch(ctx context.Context, proc uint32, decode func(args interface{}) error) (res interface{}, err error)
+}
+
+// AcceptStat is the status of a call which was accepted by the server
+type AcceptStat uint32
+
+const (
+	SUCCESS       AcceptStat = 0
+	PROG_UNAVAIL  AcceptStat = 1
+	PROG_MISMATCH AcceptStat = 2
+	PROC_UNAVAIL  AcceptStat = 3
+	GARBAGE_ARGS  AcceptStat = 4
+	SYSTEM_ERR    AcceptStat = 5
+)
+
+var acceptStatStrings = map[AcceptStat]string{
+	SUCCESS:       "Success",
+	PROG_UNAVAIL:  "Program unavailable",
+	PROG_MISMATCH: "Program version mismatch",
+	PROC_UNAVAIL:  "Procedure unavailable",
+	GARBAGE_ARGS:  "Arguments could not be decoded",
+	SYSTEM_ERR:    "System error",
+}
+
+// Error satisfies error, so that an AcceptStat other than SUCCESS may be
+// returned as the error of a call
+func (s AcceptStat) Error() string {
+	if str, ok := acceptStatStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown accept status %d", uint32(s))
+}
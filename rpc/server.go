@@ -0,0 +1,199 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+
+	"go.e43.eu/xdr"
+)
+
+// Server accepts calls over stream connections, such as TCP, and dispatches
+// them to the handlers registered with it
+type Server struct {
+	mu       sync.RWMutex
+	handlers map[uint32]map[uint32]Handler
+}
+
+// NewServer returns a server with no handlers registered
+func NewServer() *Server {
+	return &Server{handlers: make(map[uint32]map[uint32]Handler)}
+}
+
+// Register registers a handler for a version of a program, replacing any
+// handler previously registered for it
+func (s *Server) Register(h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := s.handlers[h.Program()]
+	if versions == nil {
+		versions = make(map[uint32]Handler)
+		s.handlers[h.Program()] = versions
+	}
+	versions[h.Version()] = h
+}
+
+// Serve accepts connections from l, serving each in its own goroutine. It
+// returns when Accept fails
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves calls received over conn until it is closed, or a
+// malformed record is received. Calls are handled concurrently, and the
+// context passed to handlers is cancelled when the connection fails.
+//
+// ServeConn closes conn before returning. It returns nil if the connection
+// was closed by the client
+func (s *Server) ServeConn(conn io.ReadWriteCloser) error {
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var writeMu sync.Mutex
+	for {
+		rec, err := ReadRecord(conn, DefaultMaxRecordSize)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		go func() {
+			reply := s.handle(ctx, rec)
+			if reply == nil {
+				return
+			}
+
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if err := WriteRecord(conn, reply); err != nil {
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// handle handles a call message, returning the reply to be sent, or nil if
+// the message should be dropped
+func (s *Server) handle(ctx context.Context, msg []byte) []byte {
+	call, args, err := decodeCall(msg)
+	if err != nil {
+		return nil
+	}
+
+	reply := &replyHeader{XID: call.XID, Stat: msgAccepted}
+	if call.RPCVersion != rpcVersion {
+		reply.Stat = msgDenied
+		reply.RejectStat = RPC_MISMATCH
+		reply.Low, reply.High = rpcVersion, rpcVersion
+		return encodeReply(reply, nil)
+	}
+
+	if stat := checkAuth(call.Cred); stat != AUTH_OK {
+		reply.Stat = msgDenied
+		reply.RejectStat = AUTH_ERROR
+		reply.AuthStat = stat
+		return encodeReply(reply, nil)
+	}
+
+	h, low, high := s.lookup(call.Prog, call.Vers)
+	if h == nil {
+		if low > high {
+			reply.AcceptStat = PROG_UNAVAIL
+		} else {
+			reply.AcceptStat = PROG_MISMATCH
+			reply.Low, reply.High = low, high
+		}
+		return encodeReply(reply, nil)
+	}
+
+	decode := func(v interface{}) error {
+		r := bytes.NewReader(args)
+		if err := xdr.Read(r, v); err != nil {
+			return err
+		} else if r.Len() != 0 {
+			return GARBAGE_ARGS
+		}
+		return nil
+	}
+
+	resBuf, err := dispatch(withAuth(ctx, call.Cred), h, call.Proc, decode)
+	switch err := err.(type) {
+	case nil:
+		reply.AcceptStat = SUCCESS
+	case AcceptStat:
+		reply.AcceptStat = err
+	default:
+		reply.AcceptStat = SYSTEM_ERR
+	}
+	return encodeReply(reply, resBuf)
+}
+
+// dispatch calls a handler, returning its encoded result. A handler which
+// panics, or returns a nil pointer or a result which can't be encoded, fails
+// with SYSTEM_ERR rather than taking down the server
+func dispatch(ctx context.Context, h Handler, proc uint32, decode func(interface{}) error) (resBuf []byte, err error) {
+	defer func() {
+		if recover() != nil {
+			resBuf, err = nil, SYSTEM_ERR
+		}
+	}()
+
+	res, err := h.Dispatch(ctx, proc, decode)
+	if err != nil || res == nil {
+		return nil, err
+	}
+	if v := reflect.ValueOf(res); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, SYSTEM_ERR
+	}
+	return xdr.Marshal(res)
+}
+
+// lookup returns the handler for a program version. If there is none, the
+// lowest and highest versions of the program are returned instead, with
+// low > high if the program isn't registered at all
+func (s *Server) lookup(prog, vers uint32) (h Handler, low, high uint32) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions := s.handlers[prog]
+	if h, ok := versions[vers]; ok {
+		return h, 0, 0
+	}
+
+	low, high = ^uint32(0), 0
+	for v := range versions {
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+	}
+	return nil, low, high
+}
+
+// checkAuth checks that a credential is of a supported flavor and well formed
+func checkAuth(cred OpaqueAuth) AuthStat {
+	switch cred.Flavor {
+	case AUTH_NONE:
+		return AUTH_OK
+	case AUTH_SYS:
+		if _, err := ParseAuthSys(cred); err == nil {
+			return AUTH_OK
+		}
+	}
+	return AUTH_BADCRED
+}
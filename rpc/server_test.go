@@ -0,0 +1,233 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+const (
+	testProg = 0x20000000
+
+	procNull   = 0
+	procAdd    = 1
+	procNil    = 2
+	procPanic  = 3
+	procWait   = 4
+	procUID    = 5
+	procFailed = 6
+)
+
+type testResult struct {
+	Value uint32
+}
+
+// testHandler handles versions 2 and 3 of a test program
+type testHandler struct {
+	vers uint32
+	// Calls to procWait send to started, then wait for wait to be closed
+	started chan struct{}
+	wait    chan struct{}
+}
+
+func (h *testHandler) Program() uint32 { return testProg }
+func (h *testHandler) Version() uint32 { return h.vers }
+
+func (h *testHandler) Dispatch(ctx context.Context, proc uint32, decode func(interface{}) error) (interface{}, error) {
+	switch proc {
+	case procNull:
+		return nil, nil
+
+	case procAdd, procWait:
+		var arg uint32
+		if err := decode(&arg); err != nil {
+			return nil, GARBAGE_ARGS
+		}
+		if proc == procWait {
+			h.started <- struct{}{}
+			select {
+			case <-h.wait:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return &testResult{arg + 1}, nil
+
+	case procNil:
+		return (*testResult)(nil), nil
+
+	case procPanic:
+		panic("handler failed")
+
+	case procUID:
+		a, ok := AuthSysFromContext(ctx)
+		if !ok {
+			return nil, errors.New("No AUTH_SYS credential")
+		}
+		return &testResult{a.UID}, nil
+
+	case procFailed:
+		return nil, errors.New("Procedure failed")
+
+	default:
+		return nil, PROC_UNAVAIL
+	}
+}
+
+// serve starts a server on a loopback listener, returning a client
+// connected to it and a function which stops it
+func serve(t *testing.T) (*Client, *testHandler, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &testHandler{vers: 2, started: make(chan struct{}, 1), wait: make(chan struct{})}
+	s := NewServer()
+	s.Register(h)
+	s.Register(&testHandler{vers: 3})
+	go s.Serve(l)
+
+	c, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		l.Close()
+		t.Fatal(err)
+	}
+	return c, h, func() {
+		c.Close()
+		l.Close()
+	}
+}
+
+func TestCall(t *testing.T) {
+	c, _, stop := serve(t)
+	defer stop()
+
+	ctx := context.Background()
+	if err := c.Call(ctx, testProg, 2, procNull, nil, nil); err != nil {
+		t.Errorf("NULL: %v", err)
+	}
+
+	var res testResult
+	if err := c.Call(ctx, testProg, 2, procAdd, uint32(41), &res); err != nil {
+		t.Errorf("ADD: %v", err)
+	} else if res.Value != 42 {
+		t.Errorf("ADD returned %d, expected 42", res.Value)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	c, _, stop := serve(t)
+	defer stop()
+
+	tests := []struct {
+		name       string
+		prog, vers uint32
+		proc       uint32
+		args       interface{}
+		err        error
+	}{
+		{"Unknown program", testProg + 1, 2, procNull, nil, PROG_UNAVAIL},
+		{"Unknown version", testProg, 4, procNull, nil, &MismatchError{Program: true, Low: 2, High: 3}},
+		{"Unknown procedure", testProg, 2, 99, nil, PROC_UNAVAIL},
+		{"Missing arguments", testProg, 2, procAdd, nil, GARBAGE_ARGS},
+		{"Extra arguments", testProg, 2, procAdd, []uint32{1, 2}, GARBAGE_ARGS},
+		{"Nil result", testProg, 2, procNil, nil, SYSTEM_ERR},
+		{"Panic", testProg, 2, procPanic, nil, SYSTEM_ERR},
+		{"Failed", testProg, 2, procFailed, nil, SYSTEM_ERR},
+		{"No credential", testProg, 2, procUID, nil, SYSTEM_ERR},
+	}
+
+	for _, test := range tests {
+		var res testResult
+		err := c.Call(context.Background(), test.prog, test.vers, test.proc, test.args, &res)
+		if !reflect.DeepEqual(err, test.err) {
+			t.Errorf("%s: got error %v, expected %v", test.name, err, test.err)
+		}
+	}
+
+	// The server still serves calls after the failures
+	var res testResult
+	if err := c.Call(context.Background(), testProg, 2, procAdd, uint32(1), &res); err != nil {
+		t.Errorf("ADD after failures: %v", err)
+	}
+}
+
+func TestCallAuthSys(t *testing.T) {
+	c, _, stop := serve(t)
+	defer stop()
+
+	var err error
+	if c.Auth, err = (&AuthSys{MachineName: "host", UID: 1000, GID: 100}).Auth(); err != nil {
+		t.Fatal(err)
+	}
+
+	var res testResult
+	if err := c.Call(context.Background(), testProg, 2, procUID, nil, &res); err != nil {
+		t.Fatal(err)
+	} else if res.Value != 1000 {
+		t.Errorf("Handler received UID %d, expected 1000", res.Value)
+	}
+
+	c.Auth = OpaqueAuth{Flavor: AUTH_SYS, Body: []byte{1, 2, 3, 4}}
+	if err := c.Call(context.Background(), testProg, 2, procUID, nil, &res); err != AUTH_BADCRED {
+		t.Errorf("Malformed AUTH_SYS credential returned %v, expected %v", err, AUTH_BADCRED)
+	}
+
+	c.Auth = OpaqueAuth{Flavor: AUTH_SHORT}
+	if err := c.Call(context.Background(), testProg, 2, procNull, nil, nil); err != AUTH_BADCRED {
+		t.Errorf("AUTH_SHORT credential returned %v, expected %v", err, AUTH_BADCRED)
+	}
+}
+
+func TestConcurrentCalls(t *testing.T) {
+	c, h, stop := serve(t)
+	defer stop()
+
+	// The reply to the waiting call is sent after that to the later call
+	type result struct {
+		res testResult
+		err error
+	}
+	waiting := make(chan result)
+	go func() {
+		var r result
+		r.err = c.Call(context.Background(), testProg, 2, procWait, uint32(10), &r.res)
+		waiting <- r
+	}()
+
+	<-h.started
+
+	var res testResult
+	if err := c.Call(context.Background(), testProg, 2, procAdd, uint32(20), &res); err != nil {
+		t.Fatal(err)
+	} else if res.Value != 21 {
+		t.Errorf("ADD returned %d, expected 21", res.Value)
+	}
+
+	close(h.wait)
+	if r := <-waiting; r.err != nil {
+		t.Fatal(r.err)
+	} else if r.res.Value != 11 {
+		t.Errorf("WAIT returned %d, expected 11", r.res.Value)
+	}
+}
+
+func TestHandleRPCMismatch(t *testing.T) {
+	msg := encodeCall(&callHeader{XID: 7, Prog: testProg, Vers: 2}, nil)
+	msg[11] = 3 // RPC version
+
+	hdr, _, err := decodeReply(NewServer().handle(context.Background(), msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.XID != 7 {
+		t.Errorf("Reply has XID %d, expected 7", hdr.XID)
+	}
+	want := &MismatchError{Low: rpcVersion, High: rpcVersion}
+	if err := hdr.err(); !reflect.DeepEqual(err, want) {
+		t.Errorf("Reply has error %v, expected %v", err, want)
+	}
+}